@@ -0,0 +1,152 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubePressDatabaseClusterSpec describes the profile of a MariaDB cluster managed by the operator
+// +kubebuilder:validation:XValidation:rule="self.replicas % 2 == 1",message="replicas must be odd to keep the quorum"
+type KubePressDatabaseClusterSpec struct {
+	// Replicas of the MariaDB, can be scaled up and down
+	// +kubebuilder:default=1
+	// +kubebuilder:validation:Minimum=1
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// Storage of each replica
+	// +kubebuilder:default={}
+	Storage DatabaseClusterStorage `json:"storage,omitempty"`
+
+	// Resources of each replica
+	// +optional
+	Resources *ResourceRequirements `json:"resources,omitempty"`
+
+	// Galera enables multi-primary replication, defaults to true if the cluster is created with more than one replica
+	// It can't be switched once the cluster exists
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="galera is immutable"
+	Galera *bool `json:"galera,omitempty"`
+
+	// MyCnf is appended to the MariaDB configuration, e.g. to tune innodb_buffer_pool_size
+	// +optional
+	MyCnf string `json:"myCnf,omitempty"`
+
+	// MaxScale puts a MaxScale proxy in front of the cluster
+	// +optional
+	MaxScale *DatabaseClusterMaxScale `json:"maxScale,omitempty"`
+
+	// BinaryLogs enables binary logging and archives the binary logs, so sites can be restored to a point in time
+	// +optional
+	BinaryLogs *DatabaseClusterBinaryLogs `json:"binaryLogs,omitempty"`
+}
+
+// DatabaseClusterStorage defines the volumes of the MariaDB replicas
+type DatabaseClusterStorage struct {
+	// Size of the volume of each replica, it can only grow
+	// +kubebuilder:default="10Gi"
+	Size string `json:"size,omitempty"`
+
+	// StorageClassName of the volumes, defaults to the default StorageClass of the cluster
+	// +optional
+	// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="storageClassName is immutable"
+	StorageClassName string `json:"storageClassName,omitempty"`
+}
+
+// DatabaseClusterMaxScale defines the MaxScale proxy of a cluster
+type DatabaseClusterMaxScale struct {
+	// Enabled creates the MaxScale proxy
+	// +kubebuilder:default=true
+	Enabled bool `json:"enabled,omitempty"`
+
+	// Replicas of MaxScale
+	// +kubebuilder:default=2
+	// +kubebuilder:validation:Minimum=1
+	Replicas int32 `json:"replicas,omitempty"`
+}
+
+// DatabaseClusterBinaryLogs defines where the binary logs of a cluster are archived
+type DatabaseClusterBinaryLogs struct {
+	// TargetSecretRef is the name of a secret in the namespace of the cluster with the S3 target,
+	// it needs the same keys as the backup target of a site: endpoint, bucket, accessKey and secretKey
+	// +kubebuilder:validation:MinLength=1
+	TargetSecretRef string `json:"targetSecretRef"`
+
+	// Schedule of the archiving in Cron format, each run closes the current binary log and uploads the closed ones
+	// it is the amount of changes that can be lost
+	// +kubebuilder:default="*/5 * * * *"
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+}
+
+// DatabaseClusterBinaryLogsStatus is the state of the binary log archive of a cluster
+type DatabaseClusterBinaryLogsStatus struct {
+	// Since is the time the binary logs were archived first, backups taken afterwards can be restored to a point in time
+	// +optional
+	Since *metav1.Time `json:"since,omitempty"`
+
+	// LastArchiveTime is the time the binary logs are archived up to
+	// +optional
+	LastArchiveTime *metav1.Time `json:"lastArchiveTime,omitempty"`
+}
+
+// KubePressDatabaseClusterStatus defines the observed state of KubePressDatabaseCluster
+type KubePressDatabaseClusterStatus struct {
+	// Conditions represent the latest available observations
+	// +optional
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+
+	// Ready indicates whether the MariaDB is ready
+	// +optional
+	Ready bool `json:"ready"`
+
+	// Replicas is the number of replicas of the MariaDB
+	// +optional
+	Replicas int32 `json:"replicas,omitempty"`
+
+	// StorageSize is the size of the volumes of the MariaDB
+	// +optional
+	StorageSize string `json:"storageSize,omitempty"`
+
+	// Galera indicates whether the MariaDB runs with Galera
+	// +optional
+	Galera bool `json:"galera,omitempty"`
+
+	// BinaryLogs is the state of the binary log archive, set if binary logs are enabled
+	// +optional
+	BinaryLogs *DatabaseClusterBinaryLogsStatus `json:"binaryLogs,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status was computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:resource:shortName=kpdc
+// +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas",description="Replicas of the MariaDB"
+// +kubebuilder:printcolumn:name="Storage",type="string",JSONPath=".status.storageSize",description="Storage of each replica"
+// +kubebuilder:printcolumn:name="Galera",type="boolean",JSONPath=".status.galera",description="Whether Galera is enabled"
+// +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Whether the MariaDB is ready"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KubePressDatabaseCluster is the Schema for the kubepressdatabaseclusters API
+// it is reconciled into a MariaDB of the same name, which sites reference with spec.database.mariaDBRef
+type KubePressDatabaseCluster struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   KubePressDatabaseClusterSpec   `json:"spec,omitempty"`
+	Status KubePressDatabaseClusterStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KubePressDatabaseClusterList contains a list of KubePressDatabaseCluster
+type KubePressDatabaseClusterList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubePressDatabaseCluster `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubePressDatabaseCluster{}, &KubePressDatabaseClusterList{})
+}
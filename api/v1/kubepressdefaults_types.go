@@ -0,0 +1,47 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// KubePressDefaultsName is the only name a KubePressDefaults resource can have, there is one per namespace
+const KubePressDefaultsName = "default"
+
+// KubePressDefaultsSpec defines the defaults for the WordPress sites of a namespace
+type KubePressDefaultsSpec struct {
+	// Resources used for sites that leave them out, fields that are not set here
+	// fall back to the operator defaults
+	// +optional
+	Resources *ResourceRequirements `json:"resources,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:shortName=kpd
+// +kubebuilder:validation:XValidation:rule="self.metadata.name == 'default'",message="KubePressDefaults must be named default"
+// +kubebuilder:printcolumn:name="CPU Request",type="string",JSONPath=".spec.resources.cpuRequest",description="Default CPU request"
+// +kubebuilder:printcolumn:name="CPU Limit",type="string",JSONPath=".spec.resources.cpuLimit",description="Default CPU limit"
+// +kubebuilder:printcolumn:name="Memory Request",type="string",JSONPath=".spec.resources.memoryRequest",description="Default memory request"
+// +kubebuilder:printcolumn:name="Memory Limit",type="string",JSONPath=".spec.resources.memoryLimit",description="Default memory limit"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// KubePressDefaults is the Schema for the kubepressdefaults API
+// it overrides the operator defaults for the WordPress sites in its namespace
+type KubePressDefaults struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec KubePressDefaultsSpec `json:"spec,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// KubePressDefaultsList contains a list of KubePressDefaults
+type KubePressDefaultsList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []KubePressDefaults `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&KubePressDefaults{}, &KubePressDefaultsList{})
+}
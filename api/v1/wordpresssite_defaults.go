@@ -0,0 +1,171 @@
+package v1
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+// SetDefaults fills in the defaults the CRD schema can not express
+// the resources are not defaulted here, the controller resolves them on every reconciliation
+// so changes to the operator or namespace defaults reach existing sites
+func (wp *WordPressSite) SetDefaults() {
+	if wp.Spec.DeletionPolicy == "" {
+		wp.Spec.DeletionPolicy = DeletionPolicyDelete
+	}
+
+	if wp.Spec.Database.TablePrefix == "" {
+		wp.Spec.Database.TablePrefix = DefaultTablePrefix
+	}
+	if wp.Spec.Database.Charset == "" {
+		wp.Spec.Database.Charset = DefaultCharset
+	}
+	if wp.Spec.Database.Collation == "" {
+		wp.Spec.Database.Collation = DefaultCollation
+	}
+}
+
+// GetDatabaseSettings returns the table prefix, charset and collation of the site with the defaults applied
+func (wp *WordPressSite) GetDatabaseSettings() DatabaseSettings {
+	settings := DatabaseSettings{
+		TablePrefix: wp.Spec.Database.TablePrefix,
+		Charset:     wp.Spec.Database.Charset,
+		Collation:   wp.Spec.Database.Collation,
+	}
+
+	if settings.TablePrefix == "" {
+		settings.TablePrefix = DefaultTablePrefix
+	}
+	if settings.Charset == "" {
+		settings.Charset = DefaultCharset
+	}
+	if settings.Collation == "" {
+		settings.Collation = DefaultCollation
+	}
+
+	return settings
+}
+
+// ValidateDatabaseSettings rejects changes to the table prefix, charset and collation once WordPress is installed
+func (wp *WordPressSite) ValidateDatabaseSettings() field.ErrorList {
+	installed := wp.Status.DatabaseSettings
+	if installed == nil {
+		return nil
+	}
+
+	var allErrs field.ErrorList
+
+	databasePath := field.NewPath("spec", "database")
+	settings := wp.GetDatabaseSettings()
+
+	if settings.TablePrefix != installed.TablePrefix {
+		allErrs = append(allErrs, field.Forbidden(databasePath.Child("tablePrefix"),
+			fmt.Sprintf("WordPress is installed with the table prefix %s", installed.TablePrefix)))
+	}
+	if settings.Charset != installed.Charset {
+		allErrs = append(allErrs, field.Forbidden(databasePath.Child("charset"),
+			fmt.Sprintf("WordPress is installed with the charset %s", installed.Charset)))
+	}
+	if settings.Collation != installed.Collation {
+		allErrs = append(allErrs, field.Forbidden(databasePath.Child("collation"),
+			fmt.Sprintf("WordPress is installed with the collation %s", installed.Collation)))
+	}
+
+	return allErrs
+}
+
+// ValidateQuantities checks that the storage size and the resources can be parsed as quantities
+func (wp *WordPressSite) ValidateQuantities() field.ErrorList {
+	var allErrs field.ErrorList
+
+	type quantity struct {
+		path  *field.Path
+		value string
+	}
+
+	wordpressPath := field.NewPath("spec", "wordpress")
+	quantities := []quantity{
+		{wordpressPath.Child("storageSize"), wp.Spec.WordPress.StorageSize},
+	}
+
+	if resources := wp.Spec.WordPress.Resources; resources != nil {
+		resourcesPath := wordpressPath.Child("resources")
+		quantities = append(quantities,
+			quantity{resourcesPath.Child("cpuRequest"), resources.CPURequest},
+			quantity{resourcesPath.Child("cpuLimit"), resources.CPULimit},
+			quantity{resourcesPath.Child("memoryRequest"), resources.MemoryRequest},
+			quantity{resourcesPath.Child("memoryLimit"), resources.MemoryLimit},
+		)
+	}
+
+	// the CRD default only applies when the field is missing, an explicitly empty storage size has no default
+	if wp.Spec.WordPress.StorageSize == "" {
+		allErrs = append(allErrs, field.Required(wordpressPath.Child("storageSize"), "the storage size can't be empty"))
+	}
+
+	for _, q := range quantities {
+		// empty resources are filled in by the defaults
+		if q.value == "" {
+			continue
+		}
+		if _, err := resource.ParseQuantity(q.value); err != nil {
+			allErrs = append(allErrs, field.Invalid(q.path, q.value, err.Error()))
+		}
+	}
+
+	return allErrs
+}
+
+// ValidateExtensions checks that every plugin and theme has at most one source and that at most one theme is activated
+func (wp *WordPressSite) ValidateExtensions() field.ErrorList {
+	var allErrs field.ErrorList
+
+	wordpressPath := field.NewPath("spec", "wordpress")
+	allErrs = append(allErrs, validateExtensionSources(wordpressPath.Child("plugins"), wp.Spec.WordPress.Plugins)...)
+	allErrs = append(allErrs, validateExtensionSources(wordpressPath.Child("themes"), wp.Spec.WordPress.Themes)...)
+
+	activated := []string{}
+	for _, theme := range wp.Spec.WordPress.Themes {
+		if theme.Activate {
+			activated = append(activated, theme.Slug)
+		}
+	}
+	if len(activated) > 1 {
+		allErrs = append(allErrs, field.Invalid(wordpressPath.Child("themes"), activated, "only one theme can be activated"))
+	}
+
+	return allErrs
+}
+
+// validateExtensionSources checks that the source of each extension sets exactly one field and is not combined with a version
+func validateExtensionSources(path *field.Path, extensions []Extension) field.ErrorList {
+	var allErrs field.ErrorList
+
+	for i, extension := range extensions {
+		if extension.Source == nil {
+			continue
+		}
+
+		sourcePath := path.Index(i).Child("source")
+		sources := 0
+		if extension.Source.URL != "" {
+			sources++
+		}
+		if extension.Source.ConfigMap != nil {
+			sources++
+		}
+		if extension.Source.PersistentVolumeClaim != nil {
+			sources++
+		}
+		if sources != 1 {
+			allErrs = append(allErrs, field.Invalid(sourcePath, sources, "exactly one of url, configMap or persistentVolumeClaim must be set"))
+		}
+
+		if extension.Version != "" {
+			allErrs = append(allErrs, field.Forbidden(path.Index(i).Child("version"), "the version can't be set together with a source"))
+		}
+	}
+
+	return allErrs
+}
@@ -0,0 +1,70 @@
+package v1
+
+import (
+	"testing"
+)
+
+func TestValidateQuantities(t *testing.T) {
+	tests := []struct {
+		name      string
+		wordpress WordPressConfig
+		errors    int
+	}{
+		{name: "valid storage size", wordpress: WordPressConfig{StorageSize: "10Gi"}, errors: 0},
+		{name: "empty storage size", wordpress: WordPressConfig{StorageSize: ""}, errors: 1},
+		{name: "invalid storage size", wordpress: WordPressConfig{StorageSize: "10 GB"}, errors: 1},
+		{name: "empty resources", wordpress: WordPressConfig{StorageSize: "10Gi", Resources: &ResourceRequirements{}}, errors: 0},
+		{
+			name: "valid resources",
+			wordpress: WordPressConfig{StorageSize: "10Gi", Resources: &ResourceRequirements{
+				CPURequest: "100m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi",
+			}},
+			errors: 0,
+		},
+		{
+			name: "invalid resources",
+			wordpress: WordPressConfig{StorageSize: "10Gi", Resources: &ResourceRequirements{
+				CPURequest: "one", MemoryLimit: "1 GiB",
+			}},
+			errors: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wp := &WordPressSite{Spec: WordPressSiteSpec{WordPress: tt.wordpress}}
+			if errs := wp.ValidateQuantities(); len(errs) != tt.errors {
+				t.Errorf("ValidateQuantities() = %v, want %d errors", errs, tt.errors)
+			}
+		})
+	}
+}
+
+func TestValidateDatabaseSettings(t *testing.T) {
+	installed := &DatabaseSettings{TablePrefix: DefaultTablePrefix, Charset: DefaultCharset, Collation: DefaultCollation}
+
+	tests := []struct {
+		name      string
+		database  DatabaseConfig
+		installed *DatabaseSettings
+		errors    int
+	}{
+		{name: "not installed", database: DatabaseConfig{TablePrefix: "site_"}, installed: nil, errors: 0},
+		{name: "defaults", database: DatabaseConfig{}, installed: installed, errors: 0},
+		{name: "unchanged", database: DatabaseConfig{TablePrefix: "wp_", Charset: "utf8mb4", Collation: "utf8mb4_unicode_ci"}, installed: installed, errors: 0},
+		{name: "changed table prefix", database: DatabaseConfig{TablePrefix: "site_"}, installed: installed, errors: 1},
+		{name: "changed charset and collation", database: DatabaseConfig{Charset: "latin1", Collation: "latin1_swedish_ci"}, installed: installed, errors: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wp := &WordPressSite{
+				Spec:   WordPressSiteSpec{Database: tt.database},
+				Status: WordPressSiteStatus{DatabaseSettings: tt.installed},
+			}
+			if errs := wp.ValidateDatabaseSettings(); len(errs) != tt.errors {
+				t.Errorf("ValidateDatabaseSettings() = %v, want %d errors", errs, tt.errors)
+			}
+		})
+	}
+}
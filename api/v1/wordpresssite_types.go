@@ -7,14 +7,14 @@ import (
 // WordPressSiteSpec defines the desired state of a WordPress site
 type WordPressSiteSpec struct {
 	// Site title for WordPress installation
-	// Changing this after creation has no effect
+	// Immutable after creation, changes are rejected by the webhook
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:MinLength=1
 	// +kubebuilder:validation:MaxLength=50
 	SiteTitle string `json:"siteTitle,omitempty"`
 
 	// Admin email
-	// Changing this after creation has no effect
+	// Immutable after creation, changes are rejected by the webhook
 	// +kubebuilder:validation:Required
 	// +kubebuilder:validation:Pattern="^[a-zA-Z0-9._%+-]+@[a-zA-Z0-9.-]+\\.[a-zA-Z]{2,}$"
 	AdminEmail string `json:"adminEmail,omitempty"`
@@ -36,8 +36,31 @@ type WordPressSiteSpec struct {
 	// Ingress configuration
 	// +kubebuilder:validation:Required
 	Ingress *IngressConfig `json:"ingress,omitempty"`
+
+	// Backup configuration, backups are disabled if not set
+	// +optional
+	Backup *BackupConfig `json:"backup,omitempty"`
+
+	// CloneFrom copies the files and the database of an existing site into this site on creation
+	// Immutable after creation, changes are rejected by the webhook
+	// +optional
+	CloneFrom *CloneSource `json:"cloneFrom,omitempty"`
+
+	// DeletionPolicy defines what happens to the resources of the site when it is deleted
+	// Delete removes all resources, Retain keeps the PVC and the database,
+	// Snapshot takes a final backup and removes all resources afterwards
+	// +kubebuilder:validation:Enum=Delete;Retain;Snapshot
+	// +kubebuilder:default=Delete
+	// +optional
+	DeletionPolicy string `json:"deletionPolicy,omitempty"`
 }
 
+const (
+	DeletionPolicyDelete   = "Delete"
+	DeletionPolicyRetain   = "Retain"
+	DeletionPolicySnapshot = "Snapshot"
+)
+
 // DatabaseConfig defines the MySQL database configuration
 type DatabaseConfig struct {
 	// Whether to create a new database or use existing one
@@ -45,6 +68,233 @@ type DatabaseConfig struct {
 	// If false, connection details need to be provided via the referenced secret
 	// +kubebuilder:default=true
 	CreateNew bool `json:"createNew,omitempty"`
+
+	// MariaDBRef references the MariaDB cluster the database is created in, only used if CreateNew is true
+	// Defaults to the cluster configured in the operator, or the "kubepress" cluster in the namespace of the site
+	// +optional
+	MariaDBRef *MariaDBRef `json:"mariaDBRef,omitempty"`
+
+	// Privileges of the database user of the site, only used if CreateNew is true
+	// Standard grants what WordPress needs: SELECT, INSERT, UPDATE, DELETE, CREATE, ALTER, INDEX, DROP,
+	// CREATE TEMPORARY TABLES and LOCK TABLES, All grants ALL PRIVILEGES for plugins that need more
+	// +kubebuilder:validation:Enum=Standard;All
+	// +kubebuilder:default=Standard
+	// +optional
+	Privileges string `json:"privileges,omitempty"`
+
+	// ReadOnlyUsers are additional users with SELECT on the database, e.g. for BI exports, only used if CreateNew is true
+	// Each user gets a secret <site>--db-<name> with its credentials
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	ReadOnlyUsers []DatabaseReadOnlyUser `json:"readOnlyUsers,omitempty"`
+
+	// PasswordRotation rotates the password of the database user regularly, only used if CreateNew is true
+	// A rotation can also be triggered with the annotation crm.hostzero.de/rotate-database-password
+	// +optional
+	PasswordRotation *PasswordRotation `json:"passwordRotation,omitempty"`
+
+	// CABundleSecretRef is a secret with the key ca.crt, the CA certificates trusted in addition to the system ones
+	// when the certificate of the database is verified, see databaseSSLMode in the admin secret
+	// +optional
+	CABundleSecretRef string `json:"caBundleSecretRef,omitempty"`
+
+	// MigrateToManaged moves the existing database into the managed MariaDB cluster, only used if CreateNew is false
+	// The database is provisioned like with CreateNew and the data is copied while WordPress is scaled down,
+	// then the site switches to the new database, CreateNew is set and this field is reset
+	// A failed import is rolled back and the site keeps the existing database
+	// +optional
+	MigrateToManaged bool `json:"migrateToManaged,omitempty"`
+
+	// TablePrefix of the WordPress tables
+	// Immutable once WordPress is installed, changes are rejected by the webhook
+	// +kubebuilder:default="wp_"
+	// +kubebuilder:validation:Pattern=`^[A-Za-z0-9_]+$`
+	// +kubebuilder:validation:MaxLength=20
+	// +optional
+	TablePrefix string `json:"tablePrefix,omitempty"`
+
+	// Charset of the database and the WordPress tables
+	// Immutable once WordPress is installed, changes are rejected by the webhook
+	// +kubebuilder:default="utf8mb4"
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]+$`
+	// +optional
+	Charset string `json:"charset,omitempty"`
+
+	// Collation of the database and the WordPress tables
+	// Immutable once WordPress is installed, changes are rejected by the webhook
+	// +kubebuilder:default="utf8mb4_unicode_ci"
+	// +kubebuilder:validation:Pattern=`^[a-z0-9_]+$`
+	// +optional
+	Collation string `json:"collation,omitempty"`
+}
+
+const (
+	DefaultTablePrefix = "wp_"
+	DefaultCharset     = "utf8mb4"
+	DefaultCollation   = "utf8mb4_unicode_ci"
+)
+
+// DatabaseSettings are the settings WordPress creates its tables with
+type DatabaseSettings struct {
+	TablePrefix string `json:"tablePrefix"`
+	Charset     string `json:"charset"`
+	Collation   string `json:"collation"`
+}
+
+// DatabaseStats are the size and content statistics of the database of a site
+type DatabaseStats struct {
+	// SizeBytes is the size of the data and the indexes of all tables
+	SizeBytes int64 `json:"sizeBytes"`
+
+	// Tables is the number of tables in the database
+	Tables int32 `json:"tables"`
+
+	// LargestTables are the largest tables by size, the row counts are estimates of the storage engine
+	// +optional
+	LargestTables []TableStats `json:"largestTables,omitempty"`
+
+	// AutoloadBytes is the size of the options WordPress loads on every request
+	AutoloadBytes int64 `json:"autoloadBytes"`
+
+	// Posts is the number of published posts
+	Posts int64 `json:"posts"`
+
+	// Users is the number of WordPress users
+	Users int64 `json:"users"`
+
+	// LastUpdateTime is the time the statistics were collected
+	// +optional
+	LastUpdateTime *metav1.Time `json:"lastUpdateTime,omitempty"`
+}
+
+// TableStats are the size and the estimated row count of a table
+type TableStats struct {
+	Name      string `json:"name"`
+	Rows      int64  `json:"rows"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// Phases of status.databaseMigration
+const (
+	DatabaseMigrationPhaseProvisioning = "Provisioning" // the managed database and its user are created
+	DatabaseMigrationPhaseImporting    = "Importing"    // WordPress is scaled down and the data is copied
+	DatabaseMigrationPhaseSwitching    = "Switching"    // the site is switched to the managed database
+	DatabaseMigrationPhaseCompleted    = "Completed"    // the site uses the managed database
+	DatabaseMigrationPhaseRollingBack  = "RollingBack"  // the managed database is removed again
+	DatabaseMigrationPhaseFailed       = "Failed"       // the migration was rolled back, the site uses the existing database
+)
+
+// DatabaseMigrationStatus tracks moving the existing database of a site into the managed MariaDB cluster
+type DatabaseMigrationStatus struct {
+	// Phase is one of Provisioning, Importing, Switching, Completed, RollingBack or Failed
+	Phase string `json:"phase"`
+
+	// Message describes the current phase or why the migration failed
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is the time the migration was started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the migration completed or was rolled back
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+const (
+	CoreUpdatePolicyNone  = "None"
+	CoreUpdatePolicyMinor = "Minor"
+	CoreUpdatePolicyMajor = "Major"
+)
+
+const (
+	CoreSourceDownload = "Download"
+	CoreSourceImage    = "Image"
+)
+
+const (
+	CoreUpdatePhaseBackingUp = "BackingUp"
+	CoreUpdatePhaseUpdating  = "Updating"
+	CoreUpdatePhaseCompleted = "Completed"
+	CoreUpdatePhaseFailed    = "Failed"
+)
+
+// CoreUpdateStatus is an update of the WordPress core
+type CoreUpdateStatus struct {
+	// Phase is one of BackingUp, Updating, Completed or Failed
+	Phase string `json:"phase"`
+
+	// FromVersion is the version before the update
+	// +optional
+	FromVersion string `json:"fromVersion,omitempty"`
+
+	// ToVersion is the version the site is updated to
+	ToVersion string `json:"toVersion"`
+
+	// Message describes the current phase or why the update failed
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// BackupName is the WordPressSiteBackup taken before the update
+	// +optional
+	BackupName string `json:"backupName,omitempty"`
+
+	// StartTime is the time the update was started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the update completed or failed
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// PasswordRotation defines how often the database password is rotated
+type PasswordRotation struct {
+	// Interval between two rotations, e.g. 720h
+	Interval metav1.Duration `json:"interval"`
+}
+
+// PasswordRotationStatus tracks a rotation of the database password, the site is switched to a new database user
+// with the new password and the previous user is removed once no pod uses it anymore
+type PasswordRotationStatus struct {
+	// Username is the new database user with the new password
+	Username string `json:"username"`
+
+	// PreviousUsername is the database user with the old password
+	PreviousUsername string `json:"previousUsername"`
+
+	// StartTime is the time the new database user was created
+	StartTime metav1.Time `json:"startTime"`
+
+	// SwitchTime is the time the site was switched to the new database user, both users are valid until the pods rolled
+	// +optional
+	SwitchTime *metav1.Time `json:"switchTime,omitempty"`
+}
+
+const (
+	DatabasePrivilegesStandard = "Standard"
+	DatabasePrivilegesAll      = "All"
+)
+
+// DatabaseReadOnlyUser declares an additional database user that can only read
+type DatabaseReadOnlyUser struct {
+	// Name of the user, it is part of the name of the MariaDB user and its secret
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	// +kubebuilder:validation:MaxLength=16
+	Name string `json:"name"`
+}
+
+// MariaDBRef references a MariaDB cluster of the mariadb-operator
+type MariaDBRef struct {
+	// Name of the MariaDB
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the MariaDB, defaults to the namespace of the site
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
 }
 
 // WordPressConfig defines WordPress deployment configuration
@@ -53,8 +303,34 @@ type WordPressConfig struct {
 	// +kubebuilder:default="wordpress:latest"
 	Image string `json:"image,omitempty"`
 
+	// CoreVersion is the WordPress core version, new sites are installed with it and existing ones are updated to it
+	// the latest release is installed if empty, older versions than the installed one are ignored
+	// +kubebuilder:validation:Pattern=`^[0-9]+\.[0-9]+(\.[0-9]+)?$`
+	// +optional
+	CoreVersion string `json:"coreVersion,omitempty"`
+
+	// UpdatePolicy updates the WordPress core to new releases if no coreVersion is set, one of None, Minor or Major
+	// Minor follows the releases of the installed branch, e.g. 6.5.x, Major also updates to the latest branch
+	// +kubebuilder:validation:Enum=None;Minor;Major
+	// +kubebuilder:default=None
+	// +optional
+	UpdatePolicy string `json:"updatePolicy,omitempty"`
+
+	// CoreSource is where new sites get the WordPress core from, one of Download or Image
+	// Download fetches it from wordpress.org, Image copies it from /usr/src/wordpress of the WordPress image,
+	// so sites are installed without internet access, defaults to CORE_SOURCE of the operator
+	// +kubebuilder:validation:Enum=Download;Image
+	// +optional
+	CoreSource string `json:"coreSource,omitempty"`
+
+	// WPCliImage is a toolbox image with wp-cli, it is copied into the pods running wp-cli instead of downloading it from GitHub
+	// defaults to WPCLI_IMAGE of the operator, the official wordpress:cli image works
+	// +optional
+	WPCliImage string `json:"wpCliImage,omitempty"`
+
 	// StorageSize for WordPress persistent volume
 	// +kubebuilder:default="1Gi"
+	// +kubebuilder:validation:MinLength=1
 	StorageSize string `json:"storageSize,omitempty"`
 
 	// PHP configuration overrides
@@ -76,8 +352,142 @@ type WordPressConfig struct {
 	Replicas int32 `json:"replicas,omitempty"`
 
 	// Resource requirements for the WordPress pod
+	// missing values are taken from the KubePressDefaults of the namespace, then from the operator defaults
+	// the PHP memory_limit and WP_MEMORY_LIMIT follow the effective memory limit
 	// +optional
 	Resources *ResourceRequirements `json:"resources,omitempty"`
+
+	// Plugins installed and activated with wp-cli once WordPress is installed
+	// +listType=map
+	// +listMapKey=slug
+	// +optional
+	Plugins []Extension `json:"plugins,omitempty"`
+
+	// Themes installed and activated with wp-cli once WordPress is installed, at most one can be activated
+	// +listType=map
+	// +listMapKey=slug
+	// +optional
+	Themes []Extension `json:"themes,omitempty"`
+
+	// Prune removes plugins and themes from the site when they are dropped from plugins or themes,
+	// otherwise they are left as they are and no longer managed
+	// +optional
+	Prune bool `json:"prune,omitempty"`
+
+	// Cron configures how the scheduled events of WordPress are run, on page loads if not set
+	// +optional
+	Cron *CronConfig `json:"cron,omitempty"`
+}
+
+const (
+	CronModeKubernetes = "kubernetes"
+	CronModeBuiltin    = "builtin"
+)
+
+// CronConfig defines how WP-Cron is run
+type CronConfig struct {
+	// Mode is kubernetes to run the due events with a CronJob and disable WP-Cron on page loads,
+	// or builtin to run them on page loads as WordPress does by default
+	// +kubebuilder:validation:Enum=kubernetes;builtin
+	// +kubebuilder:default=kubernetes
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// Schedule of the CronJob in cron format
+	// +kubebuilder:default="*/5 * * * *"
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	Schedule string `json:"schedule,omitempty"`
+
+	// ConcurrencyPolicy of the CronJob, one of Allow, Forbid or Replace
+	// Forbid skips a run while the previous one is still running
+	// +kubebuilder:validation:Enum=Allow;Forbid;Replace
+	// +kubebuilder:default=Forbid
+	// +optional
+	ConcurrencyPolicy string `json:"concurrencyPolicy,omitempty"`
+}
+
+// CronStatus is the state of the CronJob running WP-Cron
+type CronStatus struct {
+	// LastScheduleTime is the last time a run was started
+	// +optional
+	LastScheduleTime *metav1.Time `json:"lastScheduleTime,omitempty"`
+
+	// LastSuccessfulTime is the last time a run succeeded
+	// +optional
+	LastSuccessfulTime *metav1.Time `json:"lastSuccessfulTime,omitempty"`
+
+	// LastRunStatus is the state of the newest run, one of Running, Succeeded or Failed
+	// +optional
+	LastRunStatus string `json:"lastRunStatus,omitempty"`
+
+	// LastRunMessage explains why the newest run failed
+	// +optional
+	LastRunMessage string `json:"lastRunMessage,omitempty"`
+}
+
+// Extension is a plugin or theme of the site
+type Extension struct {
+	// Slug is the name of the plugin or theme on wordpress.org and its directory in wp-content
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`
+	// +kubebuilder:validation:MaxLength=100
+	Slug string `json:"slug"`
+
+	// Version installed from wordpress.org, the installed version is kept if empty
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9._-]+$`
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Source is a zip archive to install from instead of wordpress.org, it is installed again when the source changes
+	// +optional
+	Source *ExtensionSource `json:"source,omitempty"`
+
+	// Activate activates the plugin or theme, plugins are deactivated if false, themes stay active until another one is activated
+	// +kubebuilder:default=true
+	// +optional
+	Activate bool `json:"activate"`
+
+	// NetworkActivate activates the plugin for the whole network of a multisite, themes are enabled for the network
+	// +optional
+	NetworkActivate bool `json:"networkActivate,omitempty"`
+}
+
+// ExtensionSource is a zip archive of a plugin or theme, exactly one of the fields is set
+type ExtensionSource struct {
+	// URL the zip archive is downloaded from
+	// +kubebuilder:validation:Pattern=`^https?://`
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// ConfigMap with the zip archive in its binaryData
+	// +optional
+	ConfigMap *ExtensionConfigMapSource `json:"configMap,omitempty"`
+
+	// PersistentVolumeClaim with the zip archive
+	// +optional
+	PersistentVolumeClaim *ExtensionVolumeSource `json:"persistentVolumeClaim,omitempty"`
+}
+
+// ExtensionConfigMapSource is a key of a ConfigMap in the namespace of the site
+type ExtensionConfigMapSource struct {
+	// Name of the ConfigMap
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key of the zip archive in the ConfigMap
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+}
+
+// ExtensionVolumeSource is a file on a PersistentVolumeClaim in the namespace of the site
+type ExtensionVolumeSource struct {
+	// ClaimName is the name of the PersistentVolumeClaim, it is mounted read-only
+	// +kubebuilder:validation:MinLength=1
+	ClaimName string `json:"claimName"`
+
+	// Path of the zip archive on the volume
+	// +kubebuilder:validation:MinLength=1
+	Path string `json:"path"`
 }
 
 // EnvVar represents an environment variable in a container
@@ -145,6 +555,44 @@ type IngressConfig struct {
 	IngressClassName string `json:"ingressClassName,omitempty"`
 }
 
+// BackupConfig defines scheduled backups of the database and the WordPress files
+type BackupConfig struct {
+	// Schedule in cron format, e.g. "0 3 * * *"
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Retention is the number of backups to keep, older ones are removed
+	// +kubebuilder:default=7
+	// +kubebuilder:validation:Minimum=1
+	// +optional
+	Retention int32 `json:"retention,omitempty"`
+
+	// Target secret ref
+	// needs to be the name of a secret in the same namespace,
+	// secret needs an endpoint, bucket, accessKey and secretKey field of an S3 compatible storage
+	// +kubebuilder:validation:Required
+	TargetSecretRef string `json:"targetSecretRef"`
+
+	// Suspend stops the creation of new scheduled backups
+	// +optional
+	Suspend bool `json:"suspend,omitempty"`
+}
+
+// CloneSource references the WordPressSite to clone
+// the source site needs a backup configuration, its backup target is used to transfer the data
+type CloneSource struct {
+	// Name of the source WordPressSite
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the source WordPressSite
+	// defaults to the namespace of this site
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
 // WordPressSiteStatus defines the observed state of WordPressSite
 type WordPressSiteStatus struct {
 	// Conditions represent the latest available observations
@@ -164,6 +612,117 @@ type WordPressSiteStatus struct {
 	// MySQLVersion is the version of MySQL being used
 	// +optional
 	MySQLVersion string `json:"mysqlVersion,omitempty"`
+
+	// URL the site is reachable at
+	// +optional
+	URL string `json:"url,omitempty"`
+
+	// DatabaseStatus is the state of the database, one of Ready, Provisioning, NotFound or External
+	// +optional
+	DatabaseStatus string `json:"databaseStatus,omitempty"`
+
+	// MariaDBRef is the MariaDB cluster the database was created in, it is kept when the operator default changes
+	// +optional
+	MariaDBRef *MariaDBRef `json:"mariaDBRef,omitempty"`
+
+	// SFTP is the endpoint of the SFTP service, set once the LoadBalancer has an address
+	// +optional
+	SFTP *SFTPStatus `json:"sftp,omitempty"`
+
+	// WordPressVersion is the version of the WordPress core installed on the site
+	// +optional
+	WordPressVersion string `json:"wordpressVersion,omitempty"`
+
+	// PHPVersion is the PHP version the site runs with
+	// +optional
+	PHPVersion string `json:"phpVersion,omitempty"`
+
+	// DatabaseSettings are the table prefix, charset and collation WordPress was installed with, they can't change afterwards
+	// +optional
+	DatabaseSettings *DatabaseSettings `json:"databaseSettings,omitempty"`
+
+	// Database are the size and content statistics of the database, collected every DATABASE_STATS_INTERVAL
+	// +optional
+	Database *DatabaseStats `json:"database,omitempty"`
+
+	// CoreUpdate is the running or the last update of the WordPress core
+	// +optional
+	CoreUpdate *CoreUpdateStatus `json:"coreUpdate,omitempty"`
+
+	// CoreUpdateHistory are the last finished updates of the WordPress core, the newest last
+	// +optional
+	CoreUpdateHistory []CoreUpdateStatus `json:"coreUpdateHistory,omitempty"`
+
+	// Plugins are the plugins of spec.wordpress.plugins, and dropped ones that could not be pruned
+	// +optional
+	Plugins []ExtensionStatus `json:"plugins,omitempty"`
+
+	// Themes are the themes of spec.wordpress.themes, and dropped ones that could not be pruned
+	// +optional
+	Themes []ExtensionStatus `json:"themes,omitempty"`
+
+	// ExtensionsHash is the hash of the plugins and themes that were all reconciled successfully
+	// +optional
+	ExtensionsHash string `json:"extensionsHash,omitempty"`
+
+	// Cron is the state of the CronJob running WP-Cron, set if spec.wordpress.cron.mode is kubernetes
+	// +optional
+	Cron *CronStatus `json:"cron,omitempty"`
+
+	// DatabaseMigration tracks moving the existing database into the managed MariaDB cluster
+	// +optional
+	DatabaseMigration *DatabaseMigrationStatus `json:"databaseMigration,omitempty"`
+
+	// EarliestRecoverableTime is the earliest time the database can be restored to with a point-in-time restore
+	// +optional
+	EarliestRecoverableTime *metav1.Time `json:"earliestRecoverableTime,omitempty"`
+
+	// LastRotationTime is the last time the database password was rotated
+	// +optional
+	LastRotationTime *metav1.Time `json:"lastRotationTime,omitempty"`
+
+	// PasswordRotation is the rotation of the database password in progress
+	// +optional
+	PasswordRotation *PasswordRotationStatus `json:"passwordRotation,omitempty"`
+
+	// ReadyTime is the first time the site was ready and deployed
+	// +optional
+	ReadyTime *metav1.Time `json:"readyTime,omitempty"`
+
+	// ObservedGeneration is the generation of the spec the status was computed for
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// ExtensionStatus is the state of a plugin or theme managed by the site
+type ExtensionStatus struct {
+	// Slug of the plugin or theme
+	Slug string `json:"slug"`
+
+	// Version that is installed, empty if the plugin or theme is not installed
+	// +optional
+	Version string `json:"version,omitempty"`
+
+	// Status as reported by wp-cli, e.g. active, inactive, active-network or parent
+	// +optional
+	Status string `json:"status,omitempty"`
+
+	// Source the plugin or theme was installed from, empty for wordpress.org
+	// +optional
+	Source string `json:"source,omitempty"`
+
+	// Error of the last reconciliation of the plugin or theme
+	// +optional
+	Error string `json:"error,omitempty"`
+}
+
+// SFTPStatus is the address of the SFTP service of a site
+type SFTPStatus struct {
+	// Host is the IP address or hostname of the LoadBalancer
+	Host string `json:"host"`
+
+	// Port allocated for the site on the LoadBalancer
+	Port int32 `json:"port"`
 }
 
 // +kubebuilder:object:root=true
@@ -172,6 +731,8 @@ type WordPressSiteStatus struct {
 // +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="Site status"
 // +kubebuilder:printcolumn:name="Database",type="string",JSONPath=".status.databaseStatus",description="Database status"
 // +kubebuilder:printcolumn:name="Deployment",type="string",JSONPath=".status.deploymentStatus",description="Deployment status"
+// +kubebuilder:printcolumn:name="WordPress",type="string",JSONPath=".status.wordpressVersion",description="WordPress version",priority=1
+// +kubebuilder:printcolumn:name="PHP",type="string",JSONPath=".status.phpVersion",description="PHP version",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
 
 // WordPressSite is the Schema for the wordpresssites API
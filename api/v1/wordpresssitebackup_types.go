@@ -0,0 +1,91 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WordPressSiteBackupSpec defines the desired state of a WordPressSiteBackup
+type WordPressSiteBackupSpec struct {
+	// Name of the WordPressSite in the same namespace to back up
+	// The site needs a backup configuration with a target
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	SiteName string `json:"siteName"`
+}
+
+// WordPressSiteBackupStatus defines the observed state of WordPressSiteBackup
+type WordPressSiteBackupStatus struct {
+	// Phase of the backup, one of Pending, Running, Completed, Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Message with details about the current phase
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is the time the backup job was started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the backup job finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Location is the object key of the archive in the target bucket
+	// +optional
+	Location string `json:"location,omitempty"`
+
+	// Size of the archive in bytes
+	// +optional
+	Size int64 `json:"size,omitempty"`
+
+	// Checksum is the sha256 checksum of the archive
+	// +optional
+	Checksum string `json:"checksum,omitempty"`
+
+	// DatabaseTime is the time the database dump was started, point-in-time restores start from the newest backup before the point in time
+	// +optional
+	DatabaseTime *metav1.Time `json:"databaseTime,omitempty"`
+
+	// DatabaseGTID is the position of the database dump in the binary logs, point-in-time restores replay the binary logs from here
+	// only set if the database had binary logs enabled
+	// +optional
+	DatabaseGTID string `json:"databaseGTID,omitempty"`
+
+	// SiteURL is the URL of the site at the time of the backup
+	// +optional
+	SiteURL string `json:"siteURL,omitempty"`
+
+	// TablePrefix of the WordPress tables in the backup, a backup can only be restored into a site with the same prefix
+	// +optional
+	TablePrefix string `json:"tablePrefix,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Site",type="string",JSONPath=".spec.siteName",description="WordPress site"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Backup phase"
+// +kubebuilder:printcolumn:name="Size",type="integer",JSONPath=".status.size",description="Archive size in bytes"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// WordPressSiteBackup is the Schema for the wordpresssitebackups API
+type WordPressSiteBackup struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WordPressSiteBackupSpec   `json:"spec"`
+	Status WordPressSiteBackupStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// WordPressSiteBackupList contains a list of WordPressSiteBackup
+type WordPressSiteBackupList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WordPressSiteBackup `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WordPressSiteBackup{}, &WordPressSiteBackupList{})
+}
@@ -0,0 +1,95 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WordPressSiteCommandSpec defines the desired state of a WordPressSiteCommand
+// +kubebuilder:validation:XValidation:rule="self == oldSelf",message="spec is immutable, create a new command instead"
+type WordPressSiteCommandSpec struct {
+	// Name of the WordPressSite in the same namespace to run the command for
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	SiteName string `json:"siteName"`
+
+	// Args are passed to wp-cli, e.g. ["cache", "flush"] or ["search-replace", "http://old", "https://new"]
+	// the subcommand must be allowed by the operator, the command is not run in a shell
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinItems=1
+	Args []string `json:"args"`
+
+	// TTLSecondsAfterFinished is how long the command is kept after it finished, it is deleted with its job afterwards
+	// defaults to COMMAND_TTL of the operator
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	TTLSecondsAfterFinished *int32 `json:"ttlSecondsAfterFinished,omitempty"`
+}
+
+// WordPressSiteCommandStatus defines the observed state of WordPressSiteCommand
+type WordPressSiteCommandStatus struct {
+	// Phase of the command, one of Pending, Running, Succeeded, Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Message with details about the current phase
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// StartTime is the time the command job was started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the command finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Duration of the command, from the start of its job until it finished
+	// +optional
+	Duration *metav1.Duration `json:"duration,omitempty"`
+
+	// ExitCode of wp-cli
+	// +optional
+	ExitCode *int32 `json:"exitCode,omitempty"`
+
+	// Stdout is the end of the standard output of wp-cli
+	// +optional
+	Stdout string `json:"stdout,omitempty"`
+
+	// Stderr is the end of the standard error of wp-cli
+	// +optional
+	Stderr string `json:"stderr,omitempty"`
+
+	// Truncated is true if the beginning of the output was cut off, the status only holds a few KiB
+	// +optional
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Site",type="string",JSONPath=".spec.siteName",description="WordPress site"
+// +kubebuilder:printcolumn:name="Command",type="string",JSONPath=".spec.args",description="wp-cli arguments"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Command phase"
+// +kubebuilder:printcolumn:name="Exit Code",type="integer",JSONPath=".status.exitCode",description="Exit code of wp-cli"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// WordPressSiteCommand is the Schema for the wordpresssitecommands API
+type WordPressSiteCommand struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WordPressSiteCommandSpec   `json:"spec"`
+	Status WordPressSiteCommandStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// WordPressSiteCommandList contains a list of WordPressSiteCommand
+type WordPressSiteCommandList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WordPressSiteCommand `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WordPressSiteCommand{}, &WordPressSiteCommandList{})
+}
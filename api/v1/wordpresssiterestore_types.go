@@ -0,0 +1,89 @@
+package v1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// WordPressSiteRestoreSpec defines the desired state of a WordPressSiteRestore
+// +kubebuilder:validation:XValidation:rule="has(self.backupName) || has(self.pointInTime)",message="backupName or pointInTime is required"
+type WordPressSiteRestoreSpec struct {
+	// Name of the WordPressSite in the same namespace to restore into
+	// +kubebuilder:validation:Required
+	// +kubebuilder:validation:MinLength=1
+	SiteName string `json:"siteName"`
+
+	// Name of the completed WordPressSiteBackup to restore from
+	// defaults to the newest backup of the site taken before the pointInTime
+	// +kubebuilder:validation:MinLength=1
+	// +optional
+	BackupName string `json:"backupName,omitempty"`
+
+	// Namespace of the WordPressSiteBackup
+	// defaults to the namespace of the restore, a backup of another site can be restored this way
+	// +optional
+	BackupNamespace string `json:"backupNamespace,omitempty"`
+
+	// Target secret ref override
+	// defaults to the backup target secret of the site
+	// +optional
+	TargetSecretRef string `json:"targetSecretRef,omitempty"`
+
+	// PointInTime restores the database to this time, only the database is restored
+	// the backup is restored first, then the archived binary logs of the cluster are replayed for the database of the site,
+	// the site needs a database in a KubePressDatabaseCluster with binary logs
+	// +optional
+	PointInTime *metav1.Time `json:"pointInTime,omitempty"`
+}
+
+// WordPressSiteRestoreStatus defines the observed state of WordPressSiteRestore
+type WordPressSiteRestoreStatus struct {
+	// Phase of the restore, one of Pending, RestoringDatabase, ReplayingBinaryLogs, RestoringFiles, Completed, Failed
+	// +optional
+	Phase string `json:"phase,omitempty"`
+
+	// Message with details about the current phase
+	// +optional
+	Message string `json:"message,omitempty"`
+
+	// BackupName is the WordPressSiteBackup the restore uses, the one chosen for the pointInTime if spec.backupName is not set
+	// +optional
+	BackupName string `json:"backupName,omitempty"`
+
+	// StartTime is the time the restore was started
+	// +optional
+	StartTime *metav1.Time `json:"startTime,omitempty"`
+
+	// CompletionTime is the time the restore finished
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Site",type="string",JSONPath=".spec.siteName",description="WordPress site"
+// +kubebuilder:printcolumn:name="Backup",type="string",JSONPath=".status.backupName",description="Backup to restore"
+// +kubebuilder:printcolumn:name="Point in Time",type="date",JSONPath=".spec.pointInTime",description="Time the database is restored to",priority=1
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase",description="Restore phase"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp"
+
+// WordPressSiteRestore is the Schema for the wordpresssiterestores API
+type WordPressSiteRestore struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   WordPressSiteRestoreSpec   `json:"spec"`
+	Status WordPressSiteRestoreStatus `json:"status,omitempty"`
+}
+
+// +kubebuilder:object:root=true
+
+// WordPressSiteRestoreList contains a list of WordPressSiteRestore
+type WordPressSiteRestoreList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []WordPressSiteRestore `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&WordPressSiteRestore{}, &WordPressSiteRestoreList{})
+}
@@ -25,9 +25,183 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BackupConfig) DeepCopyInto(out *BackupConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BackupConfig.
+func (in *BackupConfig) DeepCopy() *BackupConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(BackupConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CloneSource) DeepCopyInto(out *CloneSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CloneSource.
+func (in *CloneSource) DeepCopy() *CloneSource {
+	if in == nil {
+		return nil
+	}
+	out := new(CloneSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CoreUpdateStatus) DeepCopyInto(out *CoreUpdateStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CoreUpdateStatus.
+func (in *CoreUpdateStatus) DeepCopy() *CoreUpdateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CoreUpdateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronConfig) DeepCopyInto(out *CronConfig) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronConfig.
+func (in *CronConfig) DeepCopy() *CronConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(CronConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CronStatus) DeepCopyInto(out *CronStatus) {
+	*out = *in
+	if in.LastScheduleTime != nil {
+		in, out := &in.LastScheduleTime, &out.LastScheduleTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastSuccessfulTime != nil {
+		in, out := &in.LastSuccessfulTime, &out.LastSuccessfulTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CronStatus.
+func (in *CronStatus) DeepCopy() *CronStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CronStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseClusterBinaryLogs) DeepCopyInto(out *DatabaseClusterBinaryLogs) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseClusterBinaryLogs.
+func (in *DatabaseClusterBinaryLogs) DeepCopy() *DatabaseClusterBinaryLogs {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClusterBinaryLogs)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseClusterBinaryLogsStatus) DeepCopyInto(out *DatabaseClusterBinaryLogsStatus) {
+	*out = *in
+	if in.Since != nil {
+		in, out := &in.Since, &out.Since
+		*out = (*in).DeepCopy()
+	}
+	if in.LastArchiveTime != nil {
+		in, out := &in.LastArchiveTime, &out.LastArchiveTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseClusterBinaryLogsStatus.
+func (in *DatabaseClusterBinaryLogsStatus) DeepCopy() *DatabaseClusterBinaryLogsStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClusterBinaryLogsStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseClusterMaxScale) DeepCopyInto(out *DatabaseClusterMaxScale) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseClusterMaxScale.
+func (in *DatabaseClusterMaxScale) DeepCopy() *DatabaseClusterMaxScale {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClusterMaxScale)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseClusterStorage) DeepCopyInto(out *DatabaseClusterStorage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseClusterStorage.
+func (in *DatabaseClusterStorage) DeepCopy() *DatabaseClusterStorage {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseClusterStorage)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DatabaseConfig) DeepCopyInto(out *DatabaseConfig) {
 	*out = *in
+	if in.MariaDBRef != nil {
+		in, out := &in.MariaDBRef, &out.MariaDBRef
+		*out = new(MariaDBRef)
+		**out = **in
+	}
+	if in.ReadOnlyUsers != nil {
+		in, out := &in.ReadOnlyUsers, &out.ReadOnlyUsers
+		*out = make([]DatabaseReadOnlyUser, len(*in))
+		copy(*out, *in)
+	}
+	if in.PasswordRotation != nil {
+		in, out := &in.PasswordRotation, &out.PasswordRotation
+		*out = new(PasswordRotation)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseConfig.
@@ -35,104 +209,699 @@ func (in *DatabaseConfig) DeepCopy() *DatabaseConfig {
 	if in == nil {
 		return nil
 	}
-	out := new(DatabaseConfig)
+	out := new(DatabaseConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseMigrationStatus) DeepCopyInto(out *DatabaseMigrationStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseMigrationStatus.
+func (in *DatabaseMigrationStatus) DeepCopy() *DatabaseMigrationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseMigrationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseReadOnlyUser) DeepCopyInto(out *DatabaseReadOnlyUser) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseReadOnlyUser.
+func (in *DatabaseReadOnlyUser) DeepCopy() *DatabaseReadOnlyUser {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseReadOnlyUser)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseSettings) DeepCopyInto(out *DatabaseSettings) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseSettings.
+func (in *DatabaseSettings) DeepCopy() *DatabaseSettings {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseSettings)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DatabaseStats) DeepCopyInto(out *DatabaseStats) {
+	*out = *in
+	if in.LargestTables != nil {
+		in, out := &in.LargestTables, &out.LargestTables
+		*out = make([]TableStats, len(*in))
+		copy(*out, *in)
+	}
+	if in.LastUpdateTime != nil {
+		in, out := &in.LastUpdateTime, &out.LastUpdateTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DatabaseStats.
+func (in *DatabaseStats) DeepCopy() *DatabaseStats {
+	if in == nil {
+		return nil
+	}
+	out := new(DatabaseStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EnvVar) DeepCopyInto(out *EnvVar) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvVar.
+func (in *EnvVar) DeepCopy() *EnvVar {
+	if in == nil {
+		return nil
+	}
+	out := new(EnvVar)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *Extension) DeepCopyInto(out *Extension) {
+	*out = *in
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(ExtensionSource)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new Extension.
+func (in *Extension) DeepCopy() *Extension {
+	if in == nil {
+		return nil
+	}
+	out := new(Extension)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtensionConfigMapSource) DeepCopyInto(out *ExtensionConfigMapSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtensionConfigMapSource.
+func (in *ExtensionConfigMapSource) DeepCopy() *ExtensionConfigMapSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtensionConfigMapSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtensionSource) DeepCopyInto(out *ExtensionSource) {
+	*out = *in
+	if in.ConfigMap != nil {
+		in, out := &in.ConfigMap, &out.ConfigMap
+		*out = new(ExtensionConfigMapSource)
+		**out = **in
+	}
+	if in.PersistentVolumeClaim != nil {
+		in, out := &in.PersistentVolumeClaim, &out.PersistentVolumeClaim
+		*out = new(ExtensionVolumeSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtensionSource.
+func (in *ExtensionSource) DeepCopy() *ExtensionSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtensionSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtensionStatus) DeepCopyInto(out *ExtensionStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtensionStatus.
+func (in *ExtensionStatus) DeepCopy() *ExtensionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtensionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ExtensionVolumeSource) DeepCopyInto(out *ExtensionVolumeSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ExtensionVolumeSource.
+func (in *ExtensionVolumeSource) DeepCopy() *ExtensionVolumeSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ExtensionVolumeSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IngressConfig) DeepCopyInto(out *IngressConfig) {
+	*out = *in
+	if in.Annotations != nil {
+		in, out := &in.Annotations, &out.Annotations
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Labels != nil {
+		in, out := &in.Labels, &out.Labels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressConfig.
+func (in *IngressConfig) DeepCopy() *IngressConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(IngressConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubePressDatabaseCluster) DeepCopyInto(out *KubePressDatabaseCluster) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubePressDatabaseCluster.
+func (in *KubePressDatabaseCluster) DeepCopy() *KubePressDatabaseCluster {
+	if in == nil {
+		return nil
+	}
+	out := new(KubePressDatabaseCluster)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubePressDatabaseCluster) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubePressDatabaseClusterList) DeepCopyInto(out *KubePressDatabaseClusterList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KubePressDatabaseCluster, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubePressDatabaseClusterList.
+func (in *KubePressDatabaseClusterList) DeepCopy() *KubePressDatabaseClusterList {
+	if in == nil {
+		return nil
+	}
+	out := new(KubePressDatabaseClusterList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubePressDatabaseClusterList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubePressDatabaseClusterSpec) DeepCopyInto(out *KubePressDatabaseClusterSpec) {
+	*out = *in
+	out.Storage = in.Storage
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(ResourceRequirements)
+		**out = **in
+	}
+	if in.Galera != nil {
+		in, out := &in.Galera, &out.Galera
+		*out = new(bool)
+		**out = **in
+	}
+	if in.MaxScale != nil {
+		in, out := &in.MaxScale, &out.MaxScale
+		*out = new(DatabaseClusterMaxScale)
+		**out = **in
+	}
+	if in.BinaryLogs != nil {
+		in, out := &in.BinaryLogs, &out.BinaryLogs
+		*out = new(DatabaseClusterBinaryLogs)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubePressDatabaseClusterSpec.
+func (in *KubePressDatabaseClusterSpec) DeepCopy() *KubePressDatabaseClusterSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubePressDatabaseClusterSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubePressDatabaseClusterStatus) DeepCopyInto(out *KubePressDatabaseClusterStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.BinaryLogs != nil {
+		in, out := &in.BinaryLogs, &out.BinaryLogs
+		*out = new(DatabaseClusterBinaryLogsStatus)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubePressDatabaseClusterStatus.
+func (in *KubePressDatabaseClusterStatus) DeepCopy() *KubePressDatabaseClusterStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(KubePressDatabaseClusterStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubePressDefaults) DeepCopyInto(out *KubePressDefaults) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubePressDefaults.
+func (in *KubePressDefaults) DeepCopy() *KubePressDefaults {
+	if in == nil {
+		return nil
+	}
+	out := new(KubePressDefaults)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubePressDefaults) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubePressDefaultsList) DeepCopyInto(out *KubePressDefaultsList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]KubePressDefaults, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubePressDefaultsList.
+func (in *KubePressDefaultsList) DeepCopy() *KubePressDefaultsList {
+	if in == nil {
+		return nil
+	}
+	out := new(KubePressDefaultsList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *KubePressDefaultsList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *KubePressDefaultsSpec) DeepCopyInto(out *KubePressDefaultsSpec) {
+	*out = *in
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(ResourceRequirements)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubePressDefaultsSpec.
+func (in *KubePressDefaultsSpec) DeepCopy() *KubePressDefaultsSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(KubePressDefaultsSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MariaDBRef) DeepCopyInto(out *MariaDBRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MariaDBRef.
+func (in *MariaDBRef) DeepCopy() *MariaDBRef {
+	if in == nil {
+		return nil
+	}
+	out := new(MariaDBRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordRotation) DeepCopyInto(out *PasswordRotation) {
+	*out = *in
+	out.Interval = in.Interval
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordRotation.
+func (in *PasswordRotation) DeepCopy() *PasswordRotation {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordRotation)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PasswordRotationStatus) DeepCopyInto(out *PasswordRotationStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+	if in.SwitchTime != nil {
+		in, out := &in.SwitchTime, &out.SwitchTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PasswordRotationStatus.
+func (in *PasswordRotationStatus) DeepCopy() *PasswordRotationStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PasswordRotationStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceRequirements) DeepCopyInto(out *ResourceRequirements) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceRequirements.
+func (in *ResourceRequirements) DeepCopy() *ResourceRequirements {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceRequirements)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SFTPStatus) DeepCopyInto(out *SFTPStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SFTPStatus.
+func (in *SFTPStatus) DeepCopy() *SFTPStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SFTPStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TableStats) DeepCopyInto(out *TableStats) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TableStats.
+func (in *TableStats) DeepCopy() *TableStats {
+	if in == nil {
+		return nil
+	}
+	out := new(TableStats)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressConfig) DeepCopyInto(out *WordPressConfig) {
+	*out = *in
+	if in.PHPConfig != nil {
+		in, out := &in.PHPConfig, &out.PHPConfig
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]EnvVar, len(*in))
+		copy(*out, *in)
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(ResourceRequirements)
+		**out = **in
+	}
+	if in.Plugins != nil {
+		in, out := &in.Plugins, &out.Plugins
+		*out = make([]Extension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Themes != nil {
+		in, out := &in.Themes, &out.Themes
+		*out = make([]Extension, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Cron != nil {
+		in, out := &in.Cron, &out.Cron
+		*out = new(CronConfig)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressConfig.
+func (in *WordPressConfig) DeepCopy() *WordPressConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSite) DeepCopyInto(out *WordPressSite) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSite.
+func (in *WordPressSite) DeepCopy() *WordPressSite {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSite)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WordPressSite) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *EnvVar) DeepCopyInto(out *EnvVar) {
+func (in *WordPressSiteBackup) DeepCopyInto(out *WordPressSiteBackup) {
 	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EnvVar.
-func (in *EnvVar) DeepCopy() *EnvVar {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteBackup.
+func (in *WordPressSiteBackup) DeepCopy() *WordPressSiteBackup {
 	if in == nil {
 		return nil
 	}
-	out := new(EnvVar)
+	out := new(WordPressSiteBackup)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WordPressSiteBackup) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *IngressConfig) DeepCopyInto(out *IngressConfig) {
+func (in *WordPressSiteBackupList) DeepCopyInto(out *WordPressSiteBackupList) {
 	*out = *in
-	if in.Annotations != nil {
-		in, out := &in.Annotations, &out.Annotations
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
-	}
-	if in.Labels != nil {
-		in, out := &in.Labels, &out.Labels
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WordPressSiteBackup, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IngressConfig.
-func (in *IngressConfig) DeepCopy() *IngressConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteBackupList.
+func (in *WordPressSiteBackupList) DeepCopy() *WordPressSiteBackupList {
 	if in == nil {
 		return nil
 	}
-	out := new(IngressConfig)
+	out := new(WordPressSiteBackupList)
 	in.DeepCopyInto(out)
 	return out
 }
 
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WordPressSiteBackupList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *ResourceRequirements) DeepCopyInto(out *ResourceRequirements) {
+func (in *WordPressSiteBackupSpec) DeepCopyInto(out *WordPressSiteBackupSpec) {
 	*out = *in
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceRequirements.
-func (in *ResourceRequirements) DeepCopy() *ResourceRequirements {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteBackupSpec.
+func (in *WordPressSiteBackupSpec) DeepCopy() *WordPressSiteBackupSpec {
 	if in == nil {
 		return nil
 	}
-	out := new(ResourceRequirements)
+	out := new(WordPressSiteBackupSpec)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *WordPressConfig) DeepCopyInto(out *WordPressConfig) {
+func (in *WordPressSiteBackupStatus) DeepCopyInto(out *WordPressSiteBackupStatus) {
 	*out = *in
-	if in.PHPConfig != nil {
-		in, out := &in.PHPConfig, &out.PHPConfig
-		*out = make(map[string]string, len(*in))
-		for key, val := range *in {
-			(*out)[key] = val
-		}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
 	}
-	if in.Env != nil {
-		in, out := &in.Env, &out.Env
-		*out = make([]EnvVar, len(*in))
-		copy(*out, *in)
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
 	}
-	if in.Resources != nil {
-		in, out := &in.Resources, &out.Resources
-		*out = new(ResourceRequirements)
-		**out = **in
+	if in.DatabaseTime != nil {
+		in, out := &in.DatabaseTime, &out.DatabaseTime
+		*out = (*in).DeepCopy()
 	}
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressConfig.
-func (in *WordPressConfig) DeepCopy() *WordPressConfig {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteBackupStatus.
+func (in *WordPressSiteBackupStatus) DeepCopy() *WordPressSiteBackupStatus {
 	if in == nil {
 		return nil
 	}
-	out := new(WordPressConfig)
+	out := new(WordPressSiteBackupStatus)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
-func (in *WordPressSite) DeepCopyInto(out *WordPressSite) {
+func (in *WordPressSiteCommand) DeepCopyInto(out *WordPressSiteCommand) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
@@ -140,24 +909,114 @@ func (in *WordPressSite) DeepCopyInto(out *WordPressSite) {
 	in.Status.DeepCopyInto(&out.Status)
 }
 
-// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSite.
-func (in *WordPressSite) DeepCopy() *WordPressSite {
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteCommand.
+func (in *WordPressSiteCommand) DeepCopy() *WordPressSiteCommand {
 	if in == nil {
 		return nil
 	}
-	out := new(WordPressSite)
+	out := new(WordPressSiteCommand)
 	in.DeepCopyInto(out)
 	return out
 }
 
 // DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
-func (in *WordPressSite) DeepCopyObject() runtime.Object {
+func (in *WordPressSiteCommand) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSiteCommandList) DeepCopyInto(out *WordPressSiteCommandList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WordPressSiteCommand, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteCommandList.
+func (in *WordPressSiteCommandList) DeepCopy() *WordPressSiteCommandList {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSiteCommandList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WordPressSiteCommandList) DeepCopyObject() runtime.Object {
 	if c := in.DeepCopy(); c != nil {
 		return c
 	}
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSiteCommandSpec) DeepCopyInto(out *WordPressSiteCommandSpec) {
+	*out = *in
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TTLSecondsAfterFinished != nil {
+		in, out := &in.TTLSecondsAfterFinished, &out.TTLSecondsAfterFinished
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteCommandSpec.
+func (in *WordPressSiteCommandSpec) DeepCopy() *WordPressSiteCommandSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSiteCommandSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSiteCommandStatus) DeepCopyInto(out *WordPressSiteCommandStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.ExitCode != nil {
+		in, out := &in.ExitCode, &out.ExitCode
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteCommandStatus.
+func (in *WordPressSiteCommandStatus) DeepCopy() *WordPressSiteCommandStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSiteCommandStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WordPressSiteList) DeepCopyInto(out *WordPressSiteList) {
 	*out = *in
@@ -190,16 +1049,127 @@ func (in *WordPressSiteList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSiteRestore) DeepCopyInto(out *WordPressSiteRestore) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteRestore.
+func (in *WordPressSiteRestore) DeepCopy() *WordPressSiteRestore {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSiteRestore)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WordPressSiteRestore) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSiteRestoreList) DeepCopyInto(out *WordPressSiteRestoreList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]WordPressSiteRestore, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteRestoreList.
+func (in *WordPressSiteRestoreList) DeepCopy() *WordPressSiteRestoreList {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSiteRestoreList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *WordPressSiteRestoreList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSiteRestoreSpec) DeepCopyInto(out *WordPressSiteRestoreSpec) {
+	*out = *in
+	if in.PointInTime != nil {
+		in, out := &in.PointInTime, &out.PointInTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteRestoreSpec.
+func (in *WordPressSiteRestoreSpec) DeepCopy() *WordPressSiteRestoreSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSiteRestoreSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *WordPressSiteRestoreStatus) DeepCopyInto(out *WordPressSiteRestoreStatus) {
+	*out = *in
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteRestoreStatus.
+func (in *WordPressSiteRestoreStatus) DeepCopy() *WordPressSiteRestoreStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(WordPressSiteRestoreStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *WordPressSiteSpec) DeepCopyInto(out *WordPressSiteSpec) {
 	*out = *in
-	out.Database = in.Database
+	in.Database.DeepCopyInto(&out.Database)
 	in.WordPress.DeepCopyInto(&out.WordPress)
 	if in.Ingress != nil {
 		in, out := &in.Ingress, &out.Ingress
 		*out = new(IngressConfig)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Backup != nil {
+		in, out := &in.Backup, &out.Backup
+		*out = new(BackupConfig)
+		**out = **in
+	}
+	if in.CloneFrom != nil {
+		in, out := &in.CloneFrom, &out.CloneFrom
+		*out = new(CloneSource)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteSpec.
@@ -226,6 +1196,75 @@ func (in *WordPressSiteStatus) DeepCopyInto(out *WordPressSiteStatus) {
 		in, out := &in.LastReconcileTime, &out.LastReconcileTime
 		*out = (*in).DeepCopy()
 	}
+	if in.MariaDBRef != nil {
+		in, out := &in.MariaDBRef, &out.MariaDBRef
+		*out = new(MariaDBRef)
+		**out = **in
+	}
+	if in.SFTP != nil {
+		in, out := &in.SFTP, &out.SFTP
+		*out = new(SFTPStatus)
+		**out = **in
+	}
+	if in.DatabaseSettings != nil {
+		in, out := &in.DatabaseSettings, &out.DatabaseSettings
+		*out = new(DatabaseSettings)
+		**out = **in
+	}
+	if in.Database != nil {
+		in, out := &in.Database, &out.Database
+		*out = new(DatabaseStats)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CoreUpdate != nil {
+		in, out := &in.CoreUpdate, &out.CoreUpdate
+		*out = new(CoreUpdateStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.CoreUpdateHistory != nil {
+		in, out := &in.CoreUpdateHistory, &out.CoreUpdateHistory
+		*out = make([]CoreUpdateStatus, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Plugins != nil {
+		in, out := &in.Plugins, &out.Plugins
+		*out = make([]ExtensionStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Themes != nil {
+		in, out := &in.Themes, &out.Themes
+		*out = make([]ExtensionStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.Cron != nil {
+		in, out := &in.Cron, &out.Cron
+		*out = new(CronStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.DatabaseMigration != nil {
+		in, out := &in.DatabaseMigration, &out.DatabaseMigration
+		*out = new(DatabaseMigrationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.EarliestRecoverableTime != nil {
+		in, out := &in.EarliestRecoverableTime, &out.EarliestRecoverableTime
+		*out = (*in).DeepCopy()
+	}
+	if in.LastRotationTime != nil {
+		in, out := &in.LastRotationTime, &out.LastRotationTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PasswordRotation != nil {
+		in, out := &in.PasswordRotation, &out.PasswordRotation
+		*out = new(PasswordRotationStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadyTime != nil {
+		in, out := &in.ReadyTime, &out.ReadyTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new WordPressSiteStatus.
@@ -7,11 +7,15 @@ import (
 	crmv1 "hostzero.de/m/v2/api/v1"
 	"hostzero.de/m/v2/internal/config"
 	controller "hostzero.de/m/v2/internal/controller"
+	"hostzero.de/m/v2/internal/dbprobe"
+	"hostzero.de/m/v2/internal/metrics"
+	webhookv1 "hostzero.de/m/v2/internal/webhook/v1"
 	"os"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
 
 func main() {
@@ -19,6 +23,8 @@ func main() {
 	var metricsAddr string
 	var healthProbeAddr string
 	var enableLeaderElection bool
+	var webhookCertPath string
+	var defaultResources crmv1.ResourceRequirements
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8443",
 		"The address the metric endpoint binds to.")
@@ -26,6 +32,16 @@ func main() {
 		"The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager.")
+	flag.StringVar(&webhookCertPath, "webhook-cert-path", "",
+		"The directory that contains the webhook certificate (tls.crt and tls.key).")
+	flag.StringVar(&defaultResources.CPURequest, "default-cpu-request", "",
+		"The CPU request of sites without one, overrides DEFAULT_CPU_REQUEST.")
+	flag.StringVar(&defaultResources.CPULimit, "default-cpu-limit", "",
+		"The CPU limit of sites without one, overrides DEFAULT_CPU_LIMIT.")
+	flag.StringVar(&defaultResources.MemoryRequest, "default-memory-request", "",
+		"The memory request of sites without one, overrides DEFAULT_MEMORY_REQUEST.")
+	flag.StringVar(&defaultResources.MemoryLimit, "default-memory-limit", "",
+		"The memory limit of sites without one, overrides DEFAULT_MEMORY_LIMIT.")
 
 	// Set up zap logger options with better defaults for development
 	opts := zap.Options{
@@ -74,6 +90,11 @@ func main() {
 
 	config.Load()
 
+	if err := config.SetDefaultResources(defaultResources); err != nil {
+		logger.Error(err, "Invalid default resources")
+		os.Exit(1)
+	}
+
 	// log app version
 	version := os.Getenv("VERSION")
 
@@ -85,7 +106,8 @@ func main() {
 		"environment", environment,
 		"tls-cluster-issuer", TlsClusterIssuer,
 		"mariadb-replicas", MariaDBReplicas,
-		"storage-class-name", StorageClassName)
+		"storage-class-name", StorageClassName,
+		"default-resources", config.AppConfig.DefaultResources)
 
 	// Create manager with health probe
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
@@ -95,6 +117,9 @@ func main() {
 		HealthProbeBindAddress: healthProbeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "kubepress-leader-election",
+		WebhookServer: webhook.NewServer(webhook.Options{
+			CertDir: webhookCertPath,
+		}),
 	})
 	if err != nil {
 		logger.Error(err, "Unable to start manager")
@@ -129,11 +154,72 @@ func main() {
 		Client:   mgr.GetClient(),
 		Scheme:   mgr.GetScheme(),
 		Recorder: mgr.GetEventRecorderFor("wordpresssite-controller"),
+		Prober: dbprobe.NewProber(dbprobe.Options{
+			TTL:      config.AppConfig.DatabaseProbeTTL,
+			StatsTTL: config.AppConfig.DatabaseStatsInterval,
+			Rate:     config.AppConfig.DatabaseProbeRate,
+		}),
 	}).SetupWithManager(mgr); err != nil {
 		logger.Error(err, "Unable to create controller", "controller", "WordPressSite")
 		os.Exit(1)
 	}
 
+	// Register the WordPressSiteBackupReconciler with the manager
+	if err := (&controller.WordPressSiteBackupReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("wordpresssitebackup-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		logger.Error(err, "Unable to create controller", "controller", "WordPressSiteBackup")
+		os.Exit(1)
+	}
+
+	// Register the WordPressSiteRestoreReconciler with the manager
+	if err := (&controller.WordPressSiteRestoreReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("wordpresssiterestore-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		logger.Error(err, "Unable to create controller", "controller", "WordPressSiteRestore")
+		os.Exit(1)
+	}
+
+	// Register the WordPressSiteCommandReconciler with the manager
+	if err := (&controller.WordPressSiteCommandReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("wordpresssitecommand-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		logger.Error(err, "Unable to create controller", "controller", "WordPressSiteCommand")
+		os.Exit(1)
+	}
+
+	// Register the KubePressDatabaseClusterReconciler with the manager
+	if err := (&controller.KubePressDatabaseClusterReconciler{
+		Client:   mgr.GetClient(),
+		Scheme:   mgr.GetScheme(),
+		Recorder: mgr.GetEventRecorderFor("kubepressdatabasecluster-controller"),
+	}).SetupWithManager(mgr); err != nil {
+		logger.Error(err, "Unable to create controller", "controller", "KubePressDatabaseCluster")
+		os.Exit(1)
+	}
+
+	// Register the metrics counting the sites, they are read from the cache of the manager
+	if err := metrics.RegisterSiteCollector(mgr.GetCache()); err != nil {
+		logger.Error(err, "Unable to register metrics")
+		os.Exit(1)
+	}
+
+	// Register the admission webhooks, only if enabled as they need a serving certificate
+	if config.AppConfig.EnableWebhooks {
+		if err := webhookv1.SetupWordPressSiteWebhookWithManager(mgr); err != nil {
+			logger.Error(err, "Unable to create webhook", "webhook", "WordPressSite")
+			os.Exit(1)
+		}
+	} else {
+		logger.Info("ENABLE_WEBHOOKS variable is not set to true. Admission webhooks are disabled.")
+	}
+
 	// Start the manager
 	logger.Info("Starting manager")
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
@@ -1,16 +1,73 @@
 package config
 
 import (
+	"fmt"
+	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
 )
 
 // Config holds the application settings
 type Config struct {
 	PhpMyAdminEnabled bool
 	PhpMyAdminDomain  string
+
+	// images used by the backup jobs
+	BackupImage       string
+	BackupUploadImage string
+
+	// DefaultResources are used for sites that leave out resources and are not covered by
+	// the KubePressDefaults of their namespace, all fields are set
+	DefaultResources crmv1.ResourceRequirements
+
+	// DefaultMariaDBRef is the MariaDB cluster new databases are created in, if the site does not reference one
+	// nil keeps the "kubepress" cluster that is created in the namespace of each site
+	DefaultMariaDBRef *crmv1.MariaDBRef
+
+	// DatabaseUserHost is the host the database users created by the operator are restricted to,
+	// the pod network from POD_CIDR in the IP/netmask notation of MariaDB, or "%" for every host
+	DatabaseUserHost string
+
+	// DatabaseProbeTTL is how long successful database probes of a site are cached
+	DatabaseProbeTTL time.Duration
+	// DatabaseStatsInterval is how often the size and content statistics of the database of a site are collected
+	DatabaseStatsInterval time.Duration
+	// DatabaseProbeRate is the number of database probes per second over all sites
+	DatabaseProbeRate float64
+
+	// CoreReleasesURL lists the released WordPress versions in the format of the stable-check API of wordpress.org
+	CoreReleasesURL string
+	// CoreUpdateCheckInterval is how often the released WordPress versions are checked for sites with an update policy
+	CoreUpdateCheckInterval time.Duration
+
+	// CoreSource is where new sites get the WordPress core from, Download or Image, if they don't set it
+	CoreSource string
+	// WPCliImage is the toolbox image wp-cli is copied from, empty downloads wp-cli from GitHub
+	WPCliImage string
+	// WPCliPath is the path of the wp-cli phar in the toolbox image
+	WPCliPath string
+
+	// CommandAllowedSubcommands are the wp-cli subcommands a WordPressSiteCommand may run, e.g. "cache flush" or "cron",
+	// a command is allowed if its arguments start with one of them, "*" allows every subcommand
+	CommandAllowedSubcommands []string
+	// CommandTTL is how long finished WordPressSiteCommands are kept, if they don't set their own TTL
+	CommandTTL time.Duration
+
+	// EnableWebhooks registers the admission webhooks, they need a serving certificate
+	EnableWebhooks bool
 }
 
+// defaultCommandAllowedSubcommands are the wp-cli subcommands that maintain a site without running arbitrary code
+const defaultCommandAllowedSubcommands = "cache,transient,rewrite flush,cron event run,cron event list,search-replace," +
+	"user list,user reset-password,option get,plugin list,theme list,core version,core verify-checksums,db check,db optimize"
+
 // AppConfig is the global instance accessible by other packages
 var AppConfig Config
 var logger = log.Log.WithName("config")
@@ -29,6 +86,116 @@ func Load() {
 		}
 	}
 
+	AppConfig.BackupImage = getEnv("BACKUP_IMAGE", "mariadb:11.4")
+	AppConfig.BackupUploadImage = getEnv("BACKUP_UPLOAD_IMAGE", "minio/mc:latest")
+
+	AppConfig.DefaultResources = crmv1.ResourceRequirements{
+		CPURequest:    getEnv("DEFAULT_CPU_REQUEST", "250m"),
+		CPULimit:      getEnv("DEFAULT_CPU_LIMIT", "500m"),
+		MemoryRequest: getEnv("DEFAULT_MEMORY_REQUEST", "512Mi"),
+		MemoryLimit:   getEnv("DEFAULT_MEMORY_LIMIT", "1Gi"),
+	}
+
+	if name := os.Getenv("DEFAULT_MARIADB_NAME"); name != "" {
+		AppConfig.DefaultMariaDBRef = &crmv1.MariaDBRef{
+			Name:      name,
+			Namespace: os.Getenv("DEFAULT_MARIADB_NAMESPACE"),
+		}
+	}
+
+	AppConfig.DatabaseUserHost = "%"
+	if podCIDR := os.Getenv("POD_CIDR"); podCIDR != "" {
+		_, network, err := net.ParseCIDR(podCIDR)
+		if err != nil || network.IP.To4() == nil {
+			logger.Error(err, "POD_CIDR must be an IPv4 CIDR, MariaDB only restricts hosts by IPv4 netmasks.")
+			os.Exit(1)
+		}
+		AppConfig.DatabaseUserHost = fmt.Sprintf("%s/%s", network.IP.String(), net.IP(network.Mask).String())
+	}
+
+	probeTTL, err := time.ParseDuration(getEnv("DATABASE_PROBE_TTL", "5m"))
+	if err != nil {
+		logger.Error(err, "DATABASE_PROBE_TTL is not a valid duration.")
+		os.Exit(1)
+	}
+	AppConfig.DatabaseProbeTTL = probeTTL
+
+	statsInterval, err := time.ParseDuration(getEnv("DATABASE_STATS_INTERVAL", "15m"))
+	if err != nil {
+		logger.Error(err, "DATABASE_STATS_INTERVAL is not a valid duration.")
+		os.Exit(1)
+	}
+	AppConfig.DatabaseStatsInterval = statsInterval
+
+	probeRate, err := strconv.ParseFloat(getEnv("DATABASE_PROBE_RATE", "10"), 64)
+	if err != nil || probeRate <= 0 {
+		logger.Error(err, "DATABASE_PROBE_RATE must be a positive number.")
+		os.Exit(1)
+	}
+	AppConfig.DatabaseProbeRate = probeRate
+
+	AppConfig.CoreReleasesURL = getEnv("CORE_RELEASES_URL", "https://api.wordpress.org/core/stable-check/1.0/")
+
+	coreUpdateCheckInterval, err := time.ParseDuration(getEnv("CORE_UPDATE_CHECK_INTERVAL", "6h"))
+	if err != nil {
+		logger.Error(err, "CORE_UPDATE_CHECK_INTERVAL is not a valid duration.")
+		os.Exit(1)
+	}
+	AppConfig.CoreUpdateCheckInterval = coreUpdateCheckInterval
+
+	AppConfig.CoreSource = getEnv("CORE_SOURCE", crmv1.CoreSourceDownload)
+	if AppConfig.CoreSource != crmv1.CoreSourceDownload && AppConfig.CoreSource != crmv1.CoreSourceImage {
+		logger.Info("CORE_SOURCE must be Download or Image.")
+		os.Exit(1)
+	}
+
+	AppConfig.WPCliImage = os.Getenv("WPCLI_IMAGE")
+	AppConfig.WPCliPath = getEnv("WPCLI_PATH", "/usr/local/bin/wp")
+
+	AppConfig.CommandAllowedSubcommands = []string{}
+	for _, subcommand := range strings.Split(getEnv("COMMAND_ALLOWED_SUBCOMMANDS", defaultCommandAllowedSubcommands), ",") {
+		if subcommand = strings.Join(strings.Fields(subcommand), " "); subcommand != "" {
+			AppConfig.CommandAllowedSubcommands = append(AppConfig.CommandAllowedSubcommands, subcommand)
+		}
+	}
+
+	commandTTL, err := time.ParseDuration(getEnv("COMMAND_TTL", "24h"))
+	if err != nil {
+		logger.Error(err, "COMMAND_TTL is not a valid duration.")
+		os.Exit(1)
+	}
+	AppConfig.CommandTTL = commandTTL
+
+	AppConfig.EnableWebhooks = os.Getenv("ENABLE_WEBHOOKS") == "true"
+}
+
+// SetDefaultResources overrides the default resources with the values that are set,
+// the command line flags take precedence over the environment
+// returns an error if one of the resulting defaults is not a valid quantity
+func SetDefaultResources(overrides crmv1.ResourceRequirements) error {
+	defaults := &AppConfig.DefaultResources
+
+	fields := []struct {
+		name     string
+		value    *string
+		override string
+	}{
+		{"cpu request", &defaults.CPURequest, overrides.CPURequest},
+		{"cpu limit", &defaults.CPULimit, overrides.CPULimit},
+		{"memory request", &defaults.MemoryRequest, overrides.MemoryRequest},
+		{"memory limit", &defaults.MemoryLimit, overrides.MemoryLimit},
+	}
+
+	for _, f := range fields {
+		if f.override != "" {
+			*f.value = f.override
+		}
+		if _, err := resource.ParseQuantity(*f.value); err != nil {
+			return fmt.Errorf("invalid default %s %q: %w", f.name, *f.value, err)
+		}
+	}
+
+	return nil
 }
 
 func getEnv(key, fallback string) string {
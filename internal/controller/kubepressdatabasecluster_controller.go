@@ -0,0 +1,330 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// KubePressDatabaseCluster resources
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=kubepressdatabaseclusters,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=kubepressdatabaseclusters/status,verbs=get;update;patch
+
+const (
+	ConditionClusterReady  = "Ready"  // The MariaDB is ready
+	ConditionClusterSynced = "Synced" // The spec was applied to the MariaDB
+)
+
+type KubePressDatabaseClusterReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// Reconcile applies the profile of a KubePressDatabaseCluster to the MariaDB of the same name
+// replicas and storage follow the spec over time, changes the MariaDB can't make are reported in the Synced condition
+func (r *KubePressDatabaseClusterReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	cluster := &crmv1.KubePressDatabaseCluster{}
+	if err := r.Get(ctx, req.NamespacedName, cluster); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get KubePressDatabaseCluster")
+		return ctrl.Result{}, err
+	}
+
+	size, err := resource.ParseQuantity(cluster.Spec.Storage.Size)
+	if err != nil {
+		return ctrl.Result{}, r.rejectSpec(ctx, cluster, "InvalidStorageSize", fmt.Sprintf("Invalid storage size %q: %s", cluster.Spec.Storage.Size, err))
+	}
+
+	resources, err := getDatabaseClusterResources(cluster.Spec.Resources)
+	if err != nil {
+		return ctrl.Result{}, r.rejectSpec(ctx, cluster, "InvalidResources", fmt.Sprintf("Invalid resources: %s", err))
+	}
+
+	// changes that are left out, because the MariaDB can't make them
+	var skipped []string
+
+	mariadb := &mariadbv1alpha1.MariaDB{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cluster.Name,
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	_, err = ctrl.CreateOrUpdate(ctx, r.Client, mariadb, func() error {
+		creating := mariadb.CreationTimestamp.IsZero()
+
+		if mariadb.Labels == nil {
+			mariadb.Labels = map[string]string{}
+		}
+		mariadb.Labels["app.kubernetes.io/managed-by"] = "kubepress-operator"
+
+		// the root password and the storage class can only be set when the MariaDB is created
+		if creating {
+			mariadb.Spec.RootPasswordSecretKeyRef = mariadbv1alpha1.GeneratedSecretKeyRef{
+				SecretKeySelector: mariadbv1alpha1.SecretKeySelector{
+					LocalObjectReference: mariadbv1alpha1.LocalObjectReference{
+						Name: getDatabaseClusterRootSecretName(cluster.Name),
+					},
+					Key: "password",
+				},
+				Generate: true,
+			}
+			mariadb.Spec.Storage.StorageClassName = cluster.Spec.Storage.StorageClassName
+		}
+
+		// the volumes can only grow
+		if current := mariadb.Spec.Storage.Size; current != nil && size.Cmp(*current) < 0 {
+			skipped = append(skipped, fmt.Sprintf("storage can't shrink from %s to %s", current.String(), size.String()))
+		} else {
+			mariadb.Spec.Storage.Size = &size
+		}
+
+		// Galera can't be switched once the MariaDB exists
+		galera := mariadb.Spec.Galera != nil && mariadb.Spec.Galera.Enabled
+		if creating {
+			galera = cluster.Spec.Replicas > 1
+			if cluster.Spec.Galera != nil {
+				galera = *cluster.Spec.Galera
+			}
+			mariadb.Spec.Galera = &mariadbv1alpha1.Galera{
+				Enabled: galera,
+			}
+		} else if cluster.Spec.Galera != nil && *cluster.Spec.Galera != galera {
+			skipped = append(skipped, "galera can't be switched on an existing cluster")
+		}
+
+		// without Galera the replicas would not be kept in sync
+		switch {
+		case cluster.Spec.Replicas > 1 && !galera:
+			skipped = append(skipped, "more than one replica needs galera")
+			if creating {
+				mariadb.Spec.Replicas = 1
+			}
+		default:
+			mariadb.Spec.Replicas = cluster.Spec.Replicas
+		}
+
+		mariadb.Spec.Resources = resources
+
+		mariadb.Spec.MyCnf = wordpress.GetDatabaseClusterMyCnf(cluster, galera)
+
+		mariadb.Spec.MaxScale = nil
+		if cluster.Spec.MaxScale != nil {
+			replicas := cluster.Spec.MaxScale.Replicas
+			mariadb.Spec.MaxScale = &mariadbv1alpha1.MariaDBMaxScaleSpec{
+				Enabled:  cluster.Spec.MaxScale.Enabled,
+				Replicas: &replicas,
+			}
+		}
+
+		return controllerutil.SetControllerReference(cluster, mariadb, r.Scheme)
+	})
+	if err != nil {
+		logger.Error(err, "Failed to reconcile MariaDB", "name", mariadb.Name)
+		return ctrl.Result{}, err
+	}
+
+	if len(skipped) > 0 {
+		message := "Not applied: " + strings.Join(skipped, ", ")
+		if !meta.IsStatusConditionPresentAndEqual(cluster.Status.Conditions, ConditionClusterSynced, metav1.ConditionFalse) {
+			r.Recorder.Event(cluster, v1.EventTypeWarning, "ChangeSkipped", message)
+		}
+		setClusterCondition(cluster, ConditionClusterSynced, metav1.ConditionFalse, "ChangeSkipped", message)
+	} else {
+		setClusterCondition(cluster, ConditionClusterSynced, metav1.ConditionTrue, "Applied", "The spec is applied to the MariaDB")
+	}
+
+	// take over the readiness of the MariaDB operator
+	if ready := meta.FindStatusCondition(mariadb.Status.Conditions, mariadbv1alpha1.ConditionTypeReady); ready != nil {
+		setClusterCondition(cluster, ConditionClusterReady, ready.Status, ready.Reason, ready.Message)
+	} else {
+		setClusterCondition(cluster, ConditionClusterReady, metav1.ConditionFalse, "Provisioning", "The MariaDB is being created")
+	}
+
+	if err := r.reconcileBinaryLogs(ctx, cluster, mariadb); err != nil {
+		logger.Error(err, "Failed to reconcile the binary log archive")
+		return ctrl.Result{}, err
+	}
+
+	cluster.Status.Ready = mariadb.IsReady()
+	cluster.Status.Replicas = mariadb.Spec.Replicas
+	cluster.Status.StorageSize = mariadb.Spec.Storage.Size.String()
+	cluster.Status.Galera = mariadb.Spec.Galera != nil && mariadb.Spec.Galera.Enabled
+	cluster.Status.ObservedGeneration = cluster.Generation
+
+	if err := r.Status().Update(ctx, cluster); err != nil {
+		logger.Error(err, "Failed to update KubePressDatabaseCluster status")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// reconcileBinaryLogs creates the cron job that archives the binary logs, or removes it if binary logs are disabled
+// the archived time is taken from the jobs, a job started after the binary log it closed
+func (r *KubePressDatabaseClusterReconciler) reconcileBinaryLogs(ctx context.Context, cluster *crmv1.KubePressDatabaseCluster, mariadb *mariadbv1alpha1.MariaDB) error {
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      wordpress.GetBinlogArchiveCronJobName(cluster.Name),
+			Namespace: cluster.Namespace,
+		},
+	}
+
+	if cluster.Spec.BinaryLogs == nil {
+		cluster.Status.BinaryLogs = nil
+		return client.IgnoreNotFound(r.Delete(ctx, cronJob))
+	}
+
+	_, err := ctrl.CreateOrUpdate(ctx, r.Client, cronJob, func() error {
+		successfulJobsHistoryLimit := int32(3)
+		failedJobsHistoryLimit := int32(1)
+
+		cronJob.Labels = wordpress.GetBinlogArchiveLabels(cluster)
+		cronJob.Spec.Schedule = cluster.Spec.BinaryLogs.Schedule
+		cronJob.Spec.ConcurrencyPolicy = batchv1.ForbidConcurrent
+		cronJob.Spec.SuccessfulJobsHistoryLimit = &successfulJobsHistoryLimit
+		cronJob.Spec.FailedJobsHistoryLimit = &failedJobsHistoryLimit
+		cronJob.Spec.JobTemplate = batchv1.JobTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: wordpress.GetBinlogArchiveLabels(cluster),
+			},
+			Spec: wordpress.BuildBinlogArchiveJobSpec(cluster, mariadb),
+		}
+
+		return controllerutil.SetControllerReference(cluster, cronJob, r.Scheme)
+	})
+	if err != nil {
+		return err
+	}
+
+	jobList := &batchv1.JobList{}
+	if err := r.List(ctx, jobList, client.InNamespace(cluster.Namespace), client.MatchingLabels(wordpress.GetBinlogArchiveLabels(cluster))); err != nil {
+		return err
+	}
+
+	if cluster.Status.BinaryLogs == nil {
+		cluster.Status.BinaryLogs = &crmv1.DatabaseClusterBinaryLogsStatus{}
+	}
+	binaryLogs := cluster.Status.BinaryLogs
+
+	for _, job := range jobList.Items {
+		if job.Status.StartTime == nil || job.Status.Succeeded == 0 {
+			continue
+		}
+		if binaryLogs.LastArchiveTime == nil || binaryLogs.LastArchiveTime.Before(job.Status.StartTime) {
+			binaryLogs.LastArchiveTime = job.Status.StartTime.DeepCopy()
+		}
+	}
+
+	// backups taken before the first archive may miss the binary logs they need
+	if binaryLogs.Since == nil && binaryLogs.LastArchiveTime != nil {
+		binaryLogs.Since = binaryLogs.LastArchiveTime.DeepCopy()
+	}
+
+	return nil
+}
+
+// rejectSpec reports a spec that can't be applied at all, the MariaDB is left untouched until the spec is fixed
+func (r *KubePressDatabaseClusterReconciler) rejectSpec(ctx context.Context, cluster *crmv1.KubePressDatabaseCluster, reason, message string) error {
+	log.FromContext(ctx).Info("KubePressDatabaseCluster can't be applied", "reason", message)
+
+	r.Recorder.Event(cluster, v1.EventTypeWarning, reason, message)
+	setClusterCondition(cluster, ConditionClusterSynced, metav1.ConditionFalse, reason, message)
+	cluster.Status.ObservedGeneration = cluster.Generation
+
+	return r.Status().Update(ctx, cluster)
+}
+
+// setClusterCondition sets a condition of the KubePressDatabaseCluster for its current generation
+func setClusterCondition(cluster *crmv1.KubePressDatabaseCluster, conditionType string, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&cluster.Status.Conditions, metav1.Condition{
+		Type:               conditionType,
+		Status:             status,
+		ObservedGeneration: cluster.Generation,
+		Reason:             reason,
+		Message:            message,
+	})
+}
+
+// getDatabaseClusterResources converts the resources of a cluster to the resources of the MariaDB
+// returns nil if none are set
+func getDatabaseClusterResources(resources *crmv1.ResourceRequirements) (*mariadbv1alpha1.ResourceRequirements, error) {
+	if resources == nil {
+		return nil, nil
+	}
+
+	result := &mariadbv1alpha1.ResourceRequirements{
+		Requests: v1.ResourceList{},
+		Limits:   v1.ResourceList{},
+	}
+
+	fields := []struct {
+		value string
+		list  v1.ResourceList
+		name  v1.ResourceName
+	}{
+		{resources.CPURequest, result.Requests, v1.ResourceCPU},
+		{resources.MemoryRequest, result.Requests, v1.ResourceMemory},
+		{resources.CPULimit, result.Limits, v1.ResourceCPU},
+		{resources.MemoryLimit, result.Limits, v1.ResourceMemory},
+	}
+
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		quantity, err := resource.ParseQuantity(f.value)
+		if err != nil {
+			return nil, fmt.Errorf("%s %q: %w", f.name, f.value, err)
+		}
+		f.list[f.name] = quantity
+	}
+
+	return result, nil
+}
+
+// getDatabaseClusterRootSecretName returns the name of the secret with the root password of the MariaDB
+func getDatabaseClusterRootSecretName(clusterName string) string {
+	return clusterName + "-mariadb-root-secret"
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *KubePressDatabaseClusterReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&crmv1.KubePressDatabaseCluster{}).
+		Owns(&mariadbv1alpha1.MariaDB{}).
+		Owns(&batchv1.CronJob{}).
+		// the jobs of the binary log archive report the archived time
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			if obj.GetLabels()["app.kubernetes.io/name"] != "binlog-archive" {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetLabels()["app.kubernetes.io/instance"], Namespace: obj.GetNamespace()}}}
+		})).
+		Complete(r)
+}
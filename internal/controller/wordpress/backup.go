@@ -0,0 +1,290 @@
+package wordpress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+const (
+	BackupWorkVolumeName = "backup-work"
+	BackupDumpContainer  = "dump"
+)
+
+// BackupResult is written by the dump container as termination message
+// and picked up by the controller to fill the WordPressSiteBackup status
+type BackupResult struct {
+	Location string `json:"location"`
+	Size     int64  `json:"size"`
+	Checksum string `json:"checksum"`
+
+	// DatabaseTime is the time the dump was started in RFC 3339
+	DatabaseTime string `json:"databaseTime"`
+
+	// DatabaseGTID is the GTID position of the dump, empty if the database has no binary logs
+	DatabaseGTID string `json:"databaseGTID"`
+}
+
+// the dump container writes the database dump and the WordPress files into one archive
+// and reports the location, size and checksum of the archive as termination message
+const backupDumpScript = `set -e
+` + databaseClientTLSScript + `
+mkdir -p /backup/archive
+echo "Dumping database $WORDPRESS_DB_NAME..."
+export MYSQL_PWD="$WORDPRESS_DB_PASSWORD"
+DB_CONNECTION="-h $WORDPRESS_DB_HOST -P ${WORDPRESS_DB_PORT:-3306} -u $WORDPRESS_DB_USER $(db_tls_options "$WORDPRESS_DB_SSL_MODE" "$WORDPRESS_DB_SSL_CA")"
+
+# with binary logs the dump records its GTID position as comment, it is consistent with the snapshot of the dump
+BINLOG_FLAGS=""
+if [ "$(mariadb $DB_CONNECTION -N -e 'SELECT @@log_bin')" = "1" ]; then
+	BINLOG_FLAGS="--master-data=2 --gtid"
+fi
+
+DATABASE_TIME=$(date -u +%Y-%m-%dT%H:%M:%SZ)
+mariadb-dump --single-transaction --quick --routines --triggers $BINLOG_FLAGS $DB_CONNECTION \
+	"$WORDPRESS_DB_NAME" > /backup/archive/database.sql
+DATABASE_GTID=$(head -n 50 /backup/archive/database.sql | sed -n "s/^-- SET GLOBAL gtid_slave_pos='\(.*\)';$/\1/p")
+echo "Archiving WordPress files..."
+tar -C /var/www/html -cf /backup/archive/files.tar .
+tar -C /backup/archive -czf /backup/backup.tar.gz database.sql files.tar
+rm -rf /backup/archive
+
+KEY="$BACKUP_PREFIX/$(date -u +%Y%m%dT%H%M%SZ).tar.gz"
+SIZE=$(stat -c %s /backup/backup.tar.gz)
+CHECKSUM=$(sha256sum /backup/backup.tar.gz | cut -d' ' -f1)
+echo "$KEY" > /backup/key
+printf '{"location":"%s","size":%s,"checksum":"%s","databaseTime":"%s","databaseGTID":"%s"}' \
+	"$KEY" "$SIZE" "$CHECKSUM" "$DATABASE_TIME" "$DATABASE_GTID" > /dev/termination-log
+`
+
+// the upload container copies the archive to the S3 target, old archives are removed by the prune job
+const backupUploadScript = `set -e
+mc alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY" >/dev/null
+KEY=$(cat /backup/key)
+echo "Uploading $KEY..."
+mc cp /backup/backup.tar.gz "target/$S3_BUCKET/$KEY"
+`
+
+// the prune job removes the archives of the pruned backups, archives removed by an earlier attempt are skipped
+const backupPruneScript = `set -e
+mc alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY" >/dev/null
+for KEY in $BACKUP_LOCATIONS; do
+	if mc stat "target/$S3_BUCKET/$KEY" >/dev/null 2>&1; then
+		echo "Removing old backup $KEY"
+		mc rm "target/$S3_BUCKET/$KEY"
+	fi
+done
+`
+
+// ReconcileBackupCronJob creates, updates or removes the CronJob for scheduled backups
+func ReconcileBackupCronJob(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "backup")
+
+	cronJobName := GetBackupCronJobName(wp.Name)
+
+	if wp.Spec.Backup == nil {
+		// backups are disabled, remove an existing cron job
+		cronJob := &batchv1.CronJob{}
+		err := r.Get(ctx, types.NamespacedName{Name: cronJobName, Namespace: wp.Namespace}, cronJob)
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			logger.Error(err, "Failed to get backup CronJob")
+			return err
+		}
+
+		logger.Info("Backups are disabled, deleting backup CronJob", "name", cronJobName)
+		if err := r.Delete(ctx, cronJob); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete backup CronJob")
+			return err
+		}
+		return nil
+	}
+
+	labels := GetBackupLabels(wp, map[string]string{
+		"app.kubernetes.io/name": "backup-cronjob",
+	})
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cronJobName,
+			Namespace: wp.Namespace,
+		},
+	}
+
+	_, err := ctrl.CreateOrUpdate(ctx, r, cronJob, func() error {
+		successfulJobsHistoryLimit := int32(3)
+		failedJobsHistoryLimit := int32(1)
+		suspend := wp.Spec.Backup.Suspend
+
+		cronJob.Labels = labels
+		cronJob.Spec.Schedule = wp.Spec.Backup.Schedule
+		cronJob.Spec.Suspend = &suspend
+		cronJob.Spec.ConcurrencyPolicy = batchv1.ForbidConcurrent
+		cronJob.Spec.SuccessfulJobsHistoryLimit = &successfulJobsHistoryLimit
+		cronJob.Spec.FailedJobsHistoryLimit = &failedJobsHistoryLimit
+		cronJob.Spec.JobTemplate = batchv1.JobTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetBackupLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "backup-job",
+				}),
+			},
+			Spec: BuildBackupJobSpec(wp),
+		}
+
+		return controllerutil.SetControllerReference(wp, cronJob, scheme)
+	})
+
+	if err != nil {
+		logger.Error(err, "Failed to reconcile backup CronJob", "name", cronJobName)
+		return err
+	}
+
+	return nil
+}
+
+// BuildBackupJobSpec returns the job spec that backs up the database and the files of the site
+// the site needs a backup configuration, the caller has to check this
+func BuildBackupJobSpec(wp *crmv1.WordPressSite) batchv1.JobSpec {
+	backoffLimit := int32(1)
+	targetSecretName := wp.Spec.Backup.TargetSecretRef
+
+	prefix := fmt.Sprintf("%s/%s", wp.Namespace, wp.Name)
+
+	volumes := []corev1.Volume{
+		{
+			Name: DefaultVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: GetPVCName(wp.Name),
+					ReadOnly:  true,
+				},
+			},
+		},
+		{
+			Name: BackupWorkVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+
+	dumpContainer := corev1.Container{
+		Name:    BackupDumpContainer,
+		Image:   config.AppConfig.BackupImage,
+		Command: []string{"sh", "-c", backupDumpScript},
+		Env: append(append(getDatabaseEnv(wp), getDatabaseTLSEnv(wp)...),
+			corev1.EnvVar{Name: "BACKUP_PREFIX", Value: prefix},
+		),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: DefaultVolumeName, MountPath: "/var/www/html", ReadOnly: true},
+			{Name: BackupWorkVolumeName, MountPath: "/backup"},
+		},
+	}
+
+	uploadContainer := corev1.Container{
+		Name:    "upload",
+		Image:   config.AppConfig.BackupUploadImage,
+		Command: []string{"sh", "-c", backupUploadScript},
+		Env: append(getBackupTargetEnv(targetSecretName),
+			corev1.EnvVar{Name: "BACKUP_PREFIX", Value: prefix},
+		),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: BackupWorkVolumeName, MountPath: "/backup"},
+		},
+	}
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy:  corev1.RestartPolicyNever,
+		InitContainers: []corev1.Container{dumpContainer},
+		Containers:     []corev1.Container{uploadContainer},
+		Volumes:        volumes,
+	}
+	// the dump verifies the certificate of the database with the CA bundle of the site
+	setDatabaseCAVolume(&podSpec, wp)
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetBackupLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "backup-job",
+				}),
+			},
+			Spec: podSpec,
+		},
+	}
+}
+
+// BuildBackupPruneJobSpec returns the job spec that removes the archives at the locations from the backup target of the site
+// the site needs a backup configuration, the caller has to check this
+func BuildBackupPruneJobSpec(wp *crmv1.WordPressSite, locations []string) batchv1.JobSpec {
+	backoffLimit := int32(3)
+	// the pruned backups are gone, the job is kept for a day to read its logs
+	ttl := int32(24 * 60 * 60)
+
+	container := corev1.Container{
+		Name:    "prune",
+		Image:   config.AppConfig.BackupUploadImage,
+		Command: []string{"sh", "-c", backupPruneScript},
+		Env: append(getBackupTargetEnv(wp.Spec.Backup.TargetSecretRef),
+			corev1.EnvVar{Name: "BACKUP_LOCATIONS", Value: strings.Join(locations, "\n")},
+		),
+	}
+
+	return batchv1.JobSpec{
+		BackoffLimit:            &backoffLimit,
+		TTLSecondsAfterFinished: &ttl,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetBackupPruneLabels(wp),
+			},
+			Spec: corev1.PodSpec{
+				RestartPolicy: corev1.RestartPolicyNever,
+				Containers:    []corev1.Container{container},
+			},
+		},
+	}
+}
+
+// getBackupTargetEnv returns the environment variables with the S3 target from the referenced secret
+func getBackupTargetEnv(secretName string) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: "S3_ENDPOINT", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "endpoint"}}},
+		{Name: "S3_BUCKET", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "bucket"}}},
+		{Name: "S3_ACCESS_KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "accessKey"}}},
+		{Name: "S3_SECRET_KEY", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "secretKey"}}},
+	}
+}
+
+// GetBackupResult reads the result the dump container of a finished backup pod reported
+func GetBackupResult(pod *corev1.Pod) (*BackupResult, error) {
+	for _, status := range pod.Status.InitContainerStatuses {
+		if status.Name != BackupDumpContainer || status.State.Terminated == nil {
+			continue
+		}
+
+		result := &BackupResult{}
+		if err := json.Unmarshal([]byte(status.State.Terminated.Message), result); err != nil {
+			return nil, fmt.Errorf("failed to parse backup result: %w", err)
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("backup pod %s has no result", pod.Name)
+}
@@ -0,0 +1,261 @@
+package wordpress
+
+import (
+	"fmt"
+	"time"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+const BinlogWorkVolumeName = "binlog-work"
+
+// binaryLogsMyCnf enables the binary logs, Galera nodes also log the changes replicated from the other nodes,
+// so the logs of the first node contain all changes of the cluster
+const binaryLogsMyCnf = `[mariadb]
+log_bin=mariadb-bin
+binlog_format=ROW
+log_slave_updates=ON
+expire_logs_days=7
+`
+
+// galeraGTIDMyCnf gives the changes replicated by Galera the same GTID on every node,
+// so the GTID position of a dump taken from any node can be found in the logs of the first node
+const galeraGTIDMyCnf = `wsrep_gtid_mode=ON
+`
+
+// the list container writes the names of the binary logs that are archived already
+const binlogListScript = `set -e
+mc alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY" >/dev/null
+mc ls "target/$S3_BUCKET/$BINLOG_PREFIX/" | awk '{print $NF}' > /archive/archived
+`
+
+// the fetch container closes the current binary log and fetches the closed ones that are not archived yet
+const binlogFetchScript = `set -e
+export MYSQL_PWD="$MARIADB_ROOT_PASSWORD"
+MYSQL="mariadb -h $MARIADB_HOST -u root -N"
+
+$MYSQL -e "FLUSH BINARY LOGS"
+
+# the last binary log is still written to
+mkdir -p /archive/logs
+$MYSQL -e "SHOW BINARY LOGS" | awk '{print $1}' | head -n -1 | while read -r LOG; do
+	grep -qx "$LOG" /archive/archived && continue
+	echo "Fetching $LOG..."
+	mariadb-binlog --read-from-remote-server --raw --host="$MARIADB_HOST" --user=root --result-file=/archive/logs/ "$LOG"
+done
+`
+
+// the upload container copies the fetched binary logs to the S3 target
+const binlogUploadScript = `set -e
+mc alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY" >/dev/null
+for LOG in /archive/logs/*; do
+	[ -e "$LOG" ] || continue
+	echo "Uploading $(basename "$LOG")..."
+	mc cp "$LOG" "target/$S3_BUCKET/$BINLOG_PREFIX/$(basename "$LOG")"
+done
+`
+
+// the download container fetches all archived binary logs of the cluster
+const binlogDownloadScript = `set -e
+mc alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY" >/dev/null
+mkdir -p /restore/binlogs
+mc mirror --quiet "target/$S3_BUCKET/$BINLOG_PREFIX/" /restore/binlogs/
+`
+
+// the replay container applies the changes of the site database between the backup and the point in time
+// any error fails the job, a partly replayed database must not be reported as restored
+const binlogReplayScript = `set -e
+export MYSQL_PWD="$MARIADB_ROOT_PASSWORD"
+cd /restore/binlogs
+
+LOGS=$(ls | sort)
+[ -z "$LOGS" ] && { echo "No archived binary logs found"; exit 1; }
+
+echo "Reading the changes of $DATABASE from GTID $START_GTID to $STOP_TIME..."
+mariadb-binlog --database="$DATABASE" --start-position="$START_GTID" --stop-datetime="$STOP_TIME" $LOGS > /restore/replay.sql
+
+echo "Replaying the changes..."
+mariadb -h "$MARIADB_HOST" -u root < /restore/replay.sql
+`
+
+// GetDatabaseClusterMyCnf returns the configuration of the MariaDB of a cluster, nil if there is none
+func GetDatabaseClusterMyCnf(cluster *crmv1.KubePressDatabaseCluster, galera bool) *string {
+	myCnf := cluster.Spec.MyCnf
+	if cluster.Spec.BinaryLogs != nil {
+		if galera {
+			myCnf = galeraGTIDMyCnf + myCnf
+		}
+		myCnf = binaryLogsMyCnf + myCnf
+	}
+
+	if myCnf == "" {
+		return nil
+	}
+	return &myCnf
+}
+
+// GetBinlogPrefix returns the prefix of the binary logs of a cluster in the archive
+func GetBinlogPrefix(cluster *crmv1.KubePressDatabaseCluster) string {
+	return fmt.Sprintf("binlogs/%s/%s", cluster.Namespace, cluster.Name)
+}
+
+// BuildBinlogArchiveJobSpec returns the job spec that archives the closed binary logs of the first node of the MariaDB
+// the cluster needs binary logs, the caller has to check this
+func BuildBinlogArchiveJobSpec(cluster *crmv1.KubePressDatabaseCluster, mariadb *mariadbv1alpha1.MariaDB) batchv1.JobSpec {
+	backoffLimit := int32(1)
+	prefix := corev1.EnvVar{Name: "BINLOG_PREFIX", Value: GetBinlogPrefix(cluster)}
+	mounts := []corev1.VolumeMount{
+		{Name: BinlogWorkVolumeName, MountPath: "/archive"},
+	}
+
+	// the binary logs are read from the first node, they differ between the nodes
+	host := fmt.Sprintf("%s-0.%s.%s.svc.cluster.local", mariadb.Name, mariadbv1alpha1.InternalServiceName(mariadb.Name), mariadb.Namespace)
+
+	listContainer := corev1.Container{
+		Name:         "list",
+		Image:        config.AppConfig.BackupUploadImage,
+		Command:      []string{"sh", "-c", binlogListScript},
+		Env:          append(getBackupTargetEnv(cluster.Spec.BinaryLogs.TargetSecretRef), prefix),
+		VolumeMounts: mounts,
+	}
+
+	fetchContainer := corev1.Container{
+		Name:    "fetch",
+		Image:   config.AppConfig.BackupImage,
+		Command: []string{"sh", "-c", binlogFetchScript},
+		Env: []corev1.EnvVar{
+			{Name: "MARIADB_HOST", Value: host},
+			getRootPasswordEnv(mariadb),
+		},
+		VolumeMounts: mounts,
+	}
+
+	uploadContainer := corev1.Container{
+		Name:         "upload",
+		Image:        config.AppConfig.BackupUploadImage,
+		Command:      []string{"sh", "-c", binlogUploadScript},
+		Env:          append(getBackupTargetEnv(cluster.Spec.BinaryLogs.TargetSecretRef), prefix),
+		VolumeMounts: mounts,
+	}
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetBinlogArchiveLabels(cluster),
+			},
+			Spec: corev1.PodSpec{
+				RestartPolicy:  corev1.RestartPolicyNever,
+				InitContainers: []corev1.Container{listContainer, fetchContainer},
+				Containers:     []corev1.Container{uploadContainer},
+				Volumes: []corev1.Volume{
+					{
+						Name: BinlogWorkVolumeName,
+						VolumeSource: corev1.VolumeSource{
+							EmptyDir: &corev1.EmptyDirVolumeSource{},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// BuildBinlogReplayJobSpec returns the job spec that replays the archived binary logs of the cluster
+// for the database of the site from the GTID position of the backup up to the point in time
+// the job runs in the namespace of the cluster, replaying row events needs the root user
+func BuildBinlogReplayJobSpec(wp *crmv1.WordPressSite, cluster *crmv1.KubePressDatabaseCluster, mariadb *mariadbv1alpha1.MariaDB,
+	startGTID string, stop metav1.Time) batchv1.JobSpec {
+	backoffLimit := int32(0)
+	// failed jobs are kept for a day to read their logs, the restore does not own them
+	ttl := int32(24 * 60 * 60)
+	mariaDBRef := GetMariaDBRef(wp)
+
+	downloadContainer := corev1.Container{
+		Name:    "download",
+		Image:   config.AppConfig.BackupUploadImage,
+		Command: []string{"sh", "-c", binlogDownloadScript},
+		Env: append(getBackupTargetEnv(cluster.Spec.BinaryLogs.TargetSecretRef),
+			corev1.EnvVar{Name: "BINLOG_PREFIX", Value: GetBinlogPrefix(cluster)},
+		),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: RestoreWorkVolumeName, MountPath: "/restore"},
+		},
+	}
+
+	// mariadb-binlog reads the stop time in the local time zone
+	replayContainer := corev1.Container{
+		Name:    "replay",
+		Image:   config.AppConfig.BackupImage,
+		Command: []string{"sh", "-c", binlogReplayScript},
+		Env: []corev1.EnvVar{
+			{Name: "TZ", Value: "UTC"},
+			{Name: "MARIADB_HOST", Value: GetMariaDBHost(mariaDBRef)},
+			{Name: "DATABASE", Value: GetDatabaseResourceName(wp, mariaDBRef)},
+			{Name: "START_GTID", Value: startGTID},
+			{Name: "STOP_TIME", Value: stop.UTC().Format(time.DateTime)},
+			getRootPasswordEnv(mariadb),
+		},
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: RestoreWorkVolumeName, MountPath: "/restore"},
+		},
+	}
+
+	return batchv1.JobSpec{
+		BackoffLimit:            &backoffLimit,
+		TTLSecondsAfterFinished: &ttl,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetRestoreLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "restore-binlogs-job",
+				}),
+			},
+			Spec: corev1.PodSpec{
+				RestartPolicy:  corev1.RestartPolicyNever,
+				InitContainers: []corev1.Container{downloadContainer},
+				Containers:     []corev1.Container{replayContainer},
+				Volumes: []corev1.Volume{
+					{
+						Name: RestoreWorkVolumeName,
+						VolumeSource: corev1.VolumeSource{
+							EmptyDir: &corev1.EmptyDirVolumeSource{},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// GetBinlogArchiveLabels returns the labels of the binary log archive of a cluster
+func GetBinlogArchiveLabels(cluster *crmv1.KubePressDatabaseCluster) map[string]string {
+	return map[string]string{
+		"app.kubernetes.io/managed-by": "kubepress-operator",
+		"app.kubernetes.io/part-of":    "kubepress",
+		"app.kubernetes.io/name":       "binlog-archive",
+		"app.kubernetes.io/instance":   cluster.Name,
+	}
+}
+
+// getRootPasswordEnv returns the environment variable with the root password of the MariaDB
+func getRootPasswordEnv(mariadb *mariadbv1alpha1.MariaDB) corev1.EnvVar {
+	ref := mariadb.Spec.RootPasswordSecretKeyRef
+	if ref == (mariadbv1alpha1.GeneratedSecretKeyRef{}) {
+		// set by the MariaDB operator, a MariaDB that was not reconciled yet uses the default
+		ref = mariadb.RootPasswordSecretKeyRef()
+	}
+
+	return corev1.EnvVar{
+		Name: "MARIADB_ROOT_PASSWORD",
+		ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: ref.Name},
+			Key:                  ref.Key,
+		}},
+	}
+}
@@ -0,0 +1,335 @@
+package wordpress
+
+import (
+	"context"
+	"fmt"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+// databaseSecretKeys are the keys ReconcileDatabase writes into the database secret,
+// older versions of the operator wrote them into the admin secret
+var databaseSecretKeys = []string{"databaseUsername", "database", "databaseHost", "databasePassword"}
+
+// getDatabaseObjects returns the MariaDB objects created for the site
+// the grant has to be removed before the user, the user before the database
+func getDatabaseObjects(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) ([]client.Object, error) {
+	mariaDBRef := GetMariaDBRef(wp)
+
+	// the read-only users have grants on the database as well
+	objects, err := getReadOnlyUserObjects(ctx, r, wp)
+	if err != nil {
+		return nil, err
+	}
+
+	// sites that were not reconciled since the keys moved out of the admin secret still have them there
+	secret := &corev1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		err = r.Get(ctx, types.NamespacedName{Name: wp.Spec.AdminUserSecretKeyRef, Namespace: wp.Namespace}, secret)
+	}
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	username := string(secret.Data["databaseUsername"])
+	if username != "" {
+		objects = append(objects,
+			&mariadbv1alpha1.Grant{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("grant-%s", username), Namespace: mariaDBRef.Namespace}},
+			&mariadbv1alpha1.User{ObjectMeta: metav1.ObjectMeta{Name: username, Namespace: mariaDBRef.Namespace}},
+		)
+	}
+
+	// a rotation of the password in progress has a second user
+	if rotation := wp.Status.PasswordRotation; rotation != nil {
+		for _, other := range []string{rotation.Username, rotation.PreviousUsername} {
+			if other != username {
+				objects = append(objects, getDatabaseUserObjects(mariaDBRef, other)...)
+			}
+		}
+	}
+
+	objects = append(objects, &mariadbv1alpha1.Database{ObjectMeta: metav1.ObjectMeta{Name: GetDatabaseResourceName(wp, mariaDBRef), Namespace: mariaDBRef.Namespace}})
+
+	// the copy of the password next to a cluster in another namespace is needed until the user is gone
+	if username != "" && mariaDBRef.Namespace != wp.Namespace {
+		objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: GetDatabaseUserSecretName(username), Namespace: mariaDBRef.Namespace}})
+	}
+
+	return objects, nil
+}
+
+// getDatabaseUserObjects returns the grant, the user and the password secret of a database user in the order they are removed
+func getDatabaseUserObjects(mariaDBRef types.NamespacedName, username string) []client.Object {
+	return []client.Object{
+		&mariadbv1alpha1.Grant{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("grant-%s", username), Namespace: mariaDBRef.Namespace}},
+		&mariadbv1alpha1.User{ObjectMeta: metav1.ObjectMeta{Name: username, Namespace: mariaDBRef.Namespace}},
+		&corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: GetDatabaseUserSecretName(username), Namespace: mariaDBRef.Namespace}},
+	}
+}
+
+// CleanupDatabase removes the database, the users and the grants of the site from MariaDB
+// returns true once all of them are gone, the MariaDB operator drops them from the server before
+func CleanupDatabase(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	if !wp.Spec.Database.CreateNew {
+		// the database is not managed by us, only a managed one of a migration that did not complete has to go
+		if wp.Status.DatabaseMigration != nil {
+			return RollbackDatabaseMigration(ctx, r, wp)
+		}
+		return true, nil
+	}
+
+	objects, err := getDatabaseObjects(ctx, r, wp)
+	if err != nil {
+		logger.Error(err, "Failed to get database objects")
+		return false, err
+	}
+
+	return deleteDatabaseObjects(ctx, r, objects)
+}
+
+// deleteDatabaseObjects deletes the objects one after another in the given order
+// returns true once all of them are gone, the MariaDB operator drops them from the server before
+func deleteDatabaseObjects(ctx context.Context, r client.Client, objects []client.Object) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	deletePolicy := mariadbv1alpha1.CleanupPolicyDelete
+	done := true
+
+	for _, obj := range objects {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			logger.Error(err, "Failed to get database object", "name", obj.GetName())
+			return false, err
+		}
+
+		done = false
+
+		if !obj.GetDeletionTimestamp().IsZero() {
+			// wait until the MariaDB operator removed it
+			break
+		}
+
+		// make sure the objects are dropped from the server and not only from the cluster
+		switch o := obj.(type) {
+		case *mariadbv1alpha1.Grant:
+			o.Spec.CleanupPolicy = &deletePolicy
+		case *mariadbv1alpha1.User:
+			o.Spec.CleanupPolicy = &deletePolicy
+		case *mariadbv1alpha1.Database:
+			o.Spec.CleanupPolicy = &deletePolicy
+		}
+		if _, isSecret := obj.(*corev1.Secret); !isSecret {
+			if err := r.Update(ctx, obj); err != nil {
+				logger.Error(err, "Failed to set cleanup policy", "name", obj.GetName())
+				return false, err
+			}
+		}
+
+		logger.Info("Deleting database object", "name", obj.GetName())
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete database object", "name", obj.GetName())
+			return false, err
+		}
+
+		// delete one after another, the grant needs the user and the user needs the database
+		break
+	}
+
+	return done, nil
+}
+
+// CleanupAdminSecret removes the database keys older versions of the operator added to the admin secret
+// the secret itself belongs to the user, the keys live in the database secret now
+func CleanupAdminSecret(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	if !wp.Spec.Database.CreateNew {
+		// the keys were supplied by the user
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: wp.Spec.AdminUserSecretKeyRef, Namespace: wp.Namespace}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	changed := false
+	for _, key := range databaseSecretKeys {
+		if _, ok := secret.Data[key]; ok {
+			delete(secret.Data, key)
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	if err := r.Update(ctx, secret); err != nil {
+		logger.Error(err, "Failed to remove database keys from admin secret")
+		return err
+	}
+
+	return nil
+}
+
+// MigrateAdminSecret removes the database keys from the admin secret of sites created by older versions of the operator,
+// once they were moved into the database secret and the deployment reads them from there
+func MigrateAdminSecret(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) error {
+	if !wp.Spec.Database.CreateNew {
+		return nil
+	}
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}, secret); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if _, ok := secret.Data["databaseUsername"]; !ok {
+		// the keys were not moved yet
+		return nil
+	}
+
+	return CleanupAdminSecret(ctx, r, wp)
+}
+
+// OrphanResources removes the owner references of the site from the PVC, the database objects and their secrets,
+// so they are kept by the garbage collector when the site is deleted
+func OrphanResources(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	objects := []client.Object{
+		&corev1.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: GetPVCName(wp.Name), Namespace: wp.Namespace}},
+	}
+
+	if wp.Spec.Database.CreateNew {
+		// the retained database is useless without its credentials
+		objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}})
+
+		databaseObjects, err := getDatabaseObjects(ctx, r, wp)
+		if err != nil {
+			logger.Error(err, "Failed to get database objects")
+			return err
+		}
+		objects = append(objects, databaseObjects...)
+	}
+
+	for _, obj := range objects {
+		if err := r.Get(ctx, client.ObjectKeyFromObject(obj), obj); err != nil {
+			if errors.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+
+		if !removeOwnerReference(obj, wp) {
+			continue
+		}
+
+		logger.Info("Retaining resource", "name", obj.GetName())
+		if err := r.Update(ctx, obj); err != nil {
+			logger.Error(err, "Failed to remove owner reference", "name", obj.GetName())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CleanupSharedResources handles the resources shared by all sites of a namespace
+// the last site removes them, otherwise the SSH host keys are handed over to one of the remaining sites
+func CleanupSharedResources(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	siteList := &crmv1.WordPressSiteList{}
+	if err := r.List(ctx, siteList, client.InNamespace(wp.Namespace)); err != nil {
+		logger.Error(err, "Failed to list WordPress sites")
+		return err
+	}
+
+	var remaining *crmv1.WordPressSite
+	for i := range siteList.Items {
+		if siteList.Items[i].UID != wp.UID && siteList.Items[i].DeletionTimestamp.IsZero() {
+			remaining = &siteList.Items[i]
+			break
+		}
+	}
+
+	sshSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: SFTPHostKeysSecretName, Namespace: wp.Namespace}, sshSecret)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get SSH host key Secret")
+		return err
+	}
+
+	if remaining != nil {
+		// the secret is owned by the site that created it, the garbage collector would remove it together with this site
+		if err == nil && metav1.IsControlledBy(sshSecret, wp) {
+			removeOwnerReference(sshSecret, wp)
+			if err := controllerutil.SetControllerReference(remaining, sshSecret, scheme); err != nil {
+				logger.Error(err, "Unable to set owner reference to SSH Secret", "object", sshSecret.GetName())
+				return err
+			}
+
+			logger.Info("Handing over SSH host key Secret", "site", remaining.Name)
+			if err := r.Update(ctx, sshSecret); err != nil {
+				logger.Error(err, "Failed to hand over SSH host key Secret")
+				return err
+			}
+		}
+		return nil
+	}
+
+	objects := []client.Object{
+		&appsv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: PHPMyAdminName, Namespace: wp.Namespace}},
+		&corev1.Service{ObjectMeta: metav1.ObjectMeta{Name: PHPMyAdminName, Namespace: wp.Namespace}},
+		&networkingv1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: PHPMyAdminName, Namespace: wp.Namespace}},
+	}
+	if err == nil {
+		objects = append(objects, sshSecret)
+	}
+
+	for _, obj := range objects {
+		if err := r.Delete(ctx, obj); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete shared resource", "name", obj.GetName())
+			return err
+		}
+	}
+
+	return nil
+}
+
+// removeOwnerReference removes the owner reference of the site from the object
+// returns true if the object had one
+func removeOwnerReference(obj client.Object, wp *crmv1.WordPressSite) bool {
+	ownerReferences := []metav1.OwnerReference{}
+	for _, ref := range obj.GetOwnerReferences() {
+		if ref.UID != wp.UID {
+			ownerReferences = append(ownerReferences, ref)
+		}
+	}
+
+	if len(ownerReferences) == len(obj.GetOwnerReferences()) {
+		return false
+	}
+
+	obj.SetOwnerReferences(ownerReferences)
+	return true
+}
@@ -0,0 +1,142 @@
+package wordpress
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+const CommandContainer = "command"
+
+// CommandResult is written by the command container as termination message
+type CommandResult struct {
+	ExitCode  int32  `json:"exitCode"`
+	Stdout    string `json:"stdout"`
+	Stderr    string `json:"stderr"`
+	Truncated bool   `json:"truncated"`
+}
+
+// forbiddenCommandParams are parameters of wp-cli that run code, leave the site or write to a file,
+// they are rejected for every subcommand
+// a file written into the web root would be run as PHP, e.g. by "search-replace --export=/var/www/html/x.php"
+var forbiddenCommandParams = []string{"--exec", "--require", "--path", "--ssh", "--http", "--context", "--export", "--log"}
+
+// the command container runs wp-cli with the arguments of the command, they are passed as positional
+// parameters of the script and never reach a shell
+// the termination message is limited to 4 KiB, so only the end of the output is kept, stderr gets a third of it
+const commandScript = wpCliSetupScript + `
+/tmp/wp-cli --path=/var/www/html --allow-root "$@" >/tmp/command-stdout 2>/tmp/command-stderr
+EXIT_CODE=$?
+cat /tmp/command-stdout
+cat /tmp/command-stderr >&2
+chown -R 33:33 /var/www/html
+
+php -r '
+$stdout = file_get_contents("/tmp/command-stdout");
+$stderr = file_get_contents("/tmp/command-stderr");
+$flags = JSON_UNESCAPED_SLASHES | JSON_UNESCAPED_UNICODE | JSON_INVALID_UTF8_SUBSTITUTE;
+for ($budget = 3072; ; $budget = intdiv($budget, 2)) {
+	$stderrLength = min(strlen($stderr), intdiv($budget, 3));
+	$stdoutLength = min(strlen($stdout), $budget - $stderrLength);
+	$stderrLength = min(strlen($stderr), $budget - $stdoutLength);
+	$result = json_encode(array(
+		"exitCode" => (int) $argv[1],
+		"stdout" => $stdoutLength > 0 ? substr($stdout, -$stdoutLength) : "",
+		"stderr" => $stderrLength > 0 ? substr($stderr, -$stderrLength) : "",
+		"truncated" => $stdoutLength < strlen($stdout) || $stderrLength < strlen($stderr),
+	), $flags);
+	if (strlen($result) <= 4000) {
+		break;
+	}
+}
+echo $result;
+' "$EXIT_CODE" > /dev/termination-log
+
+exit $EXIT_CODE
+`
+
+// ValidateCommandArgs checks the arguments of a WordPressSiteCommand against the subcommands allowed by the operator
+// the subcommand is made of the positional arguments, so "--url=example.com cache flush" runs "cache flush"
+func ValidateCommandArgs(args []string) error {
+	positional := []string{}
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			positional = append(positional, arg)
+			continue
+		}
+
+		name, _, _ := strings.Cut(arg, "=")
+		for _, forbidden := range forbiddenCommandParams {
+			if name == forbidden {
+				return fmt.Errorf("the parameter %s is not allowed", forbidden)
+			}
+		}
+	}
+
+	for _, subcommand := range config.AppConfig.CommandAllowedSubcommands {
+		if subcommand == "*" {
+			return nil
+		}
+
+		words := strings.Fields(subcommand)
+		if len(words) <= len(positional) && strings.Join(positional[:len(words)], " ") == subcommand {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("the subcommand %q is not allowed, allowed are: %s",
+		strings.Join(positional, " "), strings.Join(config.AppConfig.CommandAllowedSubcommands, ", "))
+}
+
+// BuildCommandJobSpec returns the job spec that runs wp-cli with the arguments for the site
+func BuildCommandJobSpec(wp *crmv1.WordPressSite, args []string) batchv1.JobSpec {
+	// a command is never run twice, e.g. a search-replace
+	backoffLimit := int32(0)
+
+	// the database connection of the site is available like in the WordPress container
+	container := corev1.Container{
+		Name:    CommandContainer,
+		Command: append([]string{"sh", "-c", commandScript, "wp"}, args...),
+		Env:     append(getDatabaseEnv(wp), getDatabaseTLSEnv(wp)...),
+	}
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetCommandLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "command-job",
+				}),
+			},
+			Spec: buildWPCliPodSpec(wp, container),
+		},
+	}
+}
+
+// GetCommandResult reads the exit code and the output the command container of a finished pod reported
+// a container that was killed has no termination message, only its exit code is known then
+func GetCommandResult(pod *corev1.Pod) (*CommandResult, error) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != CommandContainer || status.State.Terminated == nil {
+			continue
+		}
+
+		result := &CommandResult{ExitCode: status.State.Terminated.ExitCode}
+		if status.State.Terminated.Message == "" {
+			return result, nil
+		}
+		if err := json.Unmarshal([]byte(status.State.Terminated.Message), result); err != nil {
+			return nil, fmt.Errorf("failed to parse command result: %w", err)
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("command pod %s has no result", pod.Name)
+}
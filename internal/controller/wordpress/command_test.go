@@ -0,0 +1,54 @@
+package wordpress
+
+import (
+	"testing"
+
+	"hostzero.de/m/v2/internal/config"
+)
+
+func TestValidateCommandArgs(t *testing.T) {
+	previous := config.AppConfig.CommandAllowedSubcommands
+	t.Cleanup(func() { config.AppConfig.CommandAllowedSubcommands = previous })
+	config.AppConfig.CommandAllowedSubcommands = []string{"cache", "user reset-password", "search-replace"}
+
+	tests := []struct {
+		name    string
+		args    []string
+		allowed bool
+	}{
+		{name: "allowed subcommand", args: []string{"cache", "flush"}, allowed: true},
+		{name: "global parameter before the subcommand", args: []string{"--url=example.com", "cache", "flush"}, allowed: true},
+		{name: "multi-word subcommand", args: []string{"user", "reset-password", "admin"}, allowed: true},
+		{name: "other subcommand of the same command", args: []string{"user", "create", "admin", "admin@example.com"}, allowed: false},
+		{name: "subcommand not allowed", args: []string{"eval", "phpinfo();"}, allowed: false},
+		{name: "no subcommand", args: []string{"--info"}, allowed: false},
+		{name: "search-replace", args: []string{"search-replace", "http://old", "https://new", "--dry-run"}, allowed: true},
+		{name: "export into the web root", args: []string{"search-replace", "a", "<?php", "--export=/var/www/html/x.php"}, allowed: false},
+		{name: "export as separate argument", args: []string{"search-replace", "a", "b", "--export"}, allowed: false},
+		{name: "log into the web root", args: []string{"search-replace", "a", "b", "--log=/var/www/html/x.php"}, allowed: false},
+		{name: "export insert size", args: []string{"search-replace", "a", "b", "--export_insert_size=100"}, allowed: true},
+		{name: "exec", args: []string{"--exec=system('id');", "cache", "flush"}, allowed: false},
+		{name: "require", args: []string{"cache", "flush", "--require=/tmp/x.php"}, allowed: false},
+		{name: "ssh", args: []string{"--ssh=other.host", "cache", "flush"}, allowed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateCommandArgs(tt.args)
+			if tt.allowed && err != nil {
+				t.Errorf("ValidateCommandArgs(%q) = %v, want nil", tt.args, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Errorf("ValidateCommandArgs(%q) = nil, want an error", tt.args)
+			}
+		})
+	}
+
+	config.AppConfig.CommandAllowedSubcommands = []string{"*"}
+	if err := ValidateCommandArgs([]string{"plugin", "install", "akismet"}); err != nil {
+		t.Errorf("ValidateCommandArgs with * = %v, want nil", err)
+	}
+	if err := ValidateCommandArgs([]string{"search-replace", "a", "b", "--export=/var/www/html/x.php"}); err == nil {
+		t.Error("ValidateCommandArgs with * allowed --export, want an error")
+	}
+}
@@ -6,6 +6,9 @@ import (
 	"os"
 )
 
+// SiteNamespaceLabel is the namespace of the site an object belongs to, set on objects that may live in another namespace
+const SiteNamespaceLabel = "hostzero.com/site-namespace"
+
 // GetIndependentCommonLabels returns common labels that are independent of e.g. the application version, of new custom labels on the CRD, ...
 // this is useful for searching resources that belong to a specific WordPressSite, they may have been created before such labels were added
 func GetIndependentCommonLabels(wp *crmv1.WordPressSite) map[string]string {
@@ -83,6 +86,8 @@ func GetWordpressLabelsForMatching(wp *crmv1.WordPressSite, extraLabels ...map[s
 func GetDatabaseLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]string) map[string]string {
 	labels := GetCommonLabels(wp, extraLabels...)
 	labels["app.kubernetes.io/component"] = "database"
+	// database objects may live next to a MariaDB cluster in another namespace
+	labels[SiteNamespaceLabel] = wp.Namespace
 	return labels
 }
 
@@ -112,6 +117,58 @@ func GetPHPMyAdminLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]stri
 	return labels
 }
 
+func GetBackupLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]string) map[string]string {
+	labels := GetCommonLabels(wp, extraLabels...)
+	labels["app.kubernetes.io/component"] = "backup"
+	return labels
+}
+
+// GetBackupPruneLabels returns the labels of the job that removes old archives,
+// it has its own component as the jobs of the backup component are recorded as backups
+func GetBackupPruneLabels(wp *crmv1.WordPressSite) map[string]string {
+	labels := GetCommonLabels(wp, map[string]string{
+		"app.kubernetes.io/name": "backup-prune-job",
+	})
+	labels["app.kubernetes.io/component"] = "backup-prune"
+	return labels
+}
+
+func GetRestoreLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]string) map[string]string {
+	labels := GetCommonLabels(wp, extraLabels...)
+	labels["app.kubernetes.io/component"] = "restore"
+	return labels
+}
+
+func GetExtensionsLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]string) map[string]string {
+	labels := GetCommonLabels(wp, extraLabels...)
+	labels["app.kubernetes.io/component"] = "extensions"
+	return labels
+}
+
+func GetCoreUpdateLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]string) map[string]string {
+	labels := GetCommonLabels(wp, extraLabels...)
+	labels["app.kubernetes.io/component"] = "core-update"
+	return labels
+}
+
+func GetCommandLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]string) map[string]string {
+	labels := GetCommonLabels(wp, extraLabels...)
+	labels["app.kubernetes.io/component"] = "command"
+	return labels
+}
+
+func GetCronLabels(wp *crmv1.WordPressSite, extraLabels ...map[string]string) map[string]string {
+	labels := GetCommonLabels(wp, extraLabels...)
+	labels["app.kubernetes.io/component"] = "cron"
+	return labels
+}
+
+func GetCronLabelsForMatching(wp *crmv1.WordPressSite) map[string]string {
+	labels := GetIndependentCommonLabels(wp)
+	labels["app.kubernetes.io/component"] = "cron"
+	return labels
+}
+
 // SetCondition sets or updates a status condition
 func SetCondition(wp *crmv1.WordPressSite, conditionType string, status metav1.ConditionStatus, reason, message string) {
 	now := metav1.Now()
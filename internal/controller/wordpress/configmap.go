@@ -35,12 +35,13 @@ func ReconcileConfigMap(ctx context.Context, r client.Client, scheme *runtime.Sc
 		},
 	}
 
-	// convert memory limit from Go format to PHP format
-	memoryLimit, err := GoMemoryToPHPMemory(wp.Spec.WordPress.Resources.MemoryLimit)
+	// the PHP memory limit follows the memory limit of the container
+	resources, err := GetEffectiveResources(ctx, r, wp)
 	if err != nil {
-		logger.Error(err, "Failed to convert memory limit", "value", wp.Spec.WordPress.Resources.MemoryLimit)
+		logger.Error(err, "Failed to resolve resources")
 		return err
 	}
+	memoryLimit := resources.PHPMemoryLimit()
 
 	maxUploadLimit := wp.Spec.WordPress.MaxUploadLimit
 	if maxUploadLimit == "" {
@@ -1,5 +1,10 @@
 package wordpress
 
+import (
+	"fmt"
+	"time"
+)
+
 // GetResourceName returns the prefixed resource name
 func GetResourceName(wpName string) string {
 	return wpName
@@ -31,7 +36,134 @@ func GetTLSSecretName(wpName string) string {
 	return GetResourceName(wpName) + "--tls"
 }
 
-// GetDatabaseSecretName returns the name for the shared WordPress/database secret
+// GetDatabaseSecretName returns the name for the secret with the generated database connection data, owned by the site
 func GetDatabaseSecretName(wpName string) string {
-	return GetResourceName(wpName)
+	return GetResourceName(wpName) + "--db"
+}
+
+// GetBackupCronJobName returns the name for the backup cron job
+func GetBackupCronJobName(wpName string) string {
+	if len(wpName) > 52-8 { // cron job names are limited to 52 characters, 8 is for the suffix "--backup"
+		wpName = wpName[:52-8]
+	}
+
+	return GetResourceName(wpName) + "--backup"
+}
+
+// GetBackupPruneJobName returns the name for the job that removes the archives of pruned backups,
+// named after the newest pruned backup, so every pruning gets its own job
+func GetBackupPruneJobName(backupName string) string {
+	if len(backupName) > 63-7 { // job names are limited to 63 characters, 7 is for the suffix "--prune"
+		backupName = backupName[:63-7]
+	}
+
+	return backupName + "--prune"
+}
+
+// GetRestoreJobName returns the name for the job of a restore step, e.g. "database" or "files"
+func GetRestoreJobName(restoreName string, step string) string {
+	if len(restoreName) > 63-len(step)-1 {
+		restoreName = restoreName[:63-len(step)-1]
+	}
+
+	return restoreName + "-" + step
+}
+
+// GetCloneName returns the name of the backup and the restore used to clone a site
+func GetCloneName(wpName string) string {
+	if len(wpName) > 63-7 { // job names are limited to 63 characters, 7 is for the suffix "--clone"
+		wpName = wpName[:63-7]
+	}
+
+	return GetResourceName(wpName) + "--clone"
+}
+
+// GetCloneTargetSecretName returns the name for the copy of the backup target secret of the clone source
+func GetCloneTargetSecretName(wpName string) string {
+	return GetResourceName(wpName) + "--clone-target"
+}
+
+// GetFinalBackupName returns the name of the backup taken before a site with the Snapshot deletion policy is deleted
+func GetFinalBackupName(wpName string) string {
+	if len(wpName) > 63-7 { // job names are limited to 63 characters, 7 is for the suffix "--final"
+		wpName = wpName[:63-7]
+	}
+
+	return GetResourceName(wpName) + "--final"
+}
+
+// GetReadOnlyUserSecretName returns the name of the secret with the credentials of a read-only database user
+func GetReadOnlyUserSecretName(wpName string, userName string) string {
+	return GetResourceName(wpName) + "--db-" + userName
+}
+
+// GetBinlogArchiveCronJobName returns the name for the cron job that archives the binary logs of a database cluster
+func GetBinlogArchiveCronJobName(clusterName string) string {
+	if len(clusterName) > 52-16 { // cron job names are limited to 52 characters, 16 is for the suffix "--binlog-archive"
+		clusterName = clusterName[:52-16]
+	}
+
+	return clusterName + "--binlog-archive"
+}
+
+// GetBinlogReplayJobName returns the name for the job that replays the binary logs of a restore,
+// it runs in the namespace of the database cluster, so the namespace of the restore is part of the name
+func GetBinlogReplayJobName(restoreNamespace string, restoreName string) string {
+	return GetRestoreJobName(restoreNamespace+"--"+restoreName, "binlogs")
+}
+
+// GetDatabaseMigrationJobName returns the name for the job that copies an existing database into the managed cluster
+func GetDatabaseMigrationJobName(wpName string) string {
+	if len(wpName) > 63-14 { // job names are limited to 63 characters, 14 is for the suffix "--db-migration"
+		wpName = wpName[:63-14]
+	}
+
+	return GetResourceName(wpName) + "--db-migration"
+}
+
+// GetExtensionsJobName returns the name for the job that installs the plugins and themes of a site
+func GetExtensionsJobName(wpName string) string {
+	if len(wpName) > 63-12 { // job names are limited to 63 characters, 12 is for the suffix "--extensions"
+		wpName = wpName[:63-12]
+	}
+
+	return GetResourceName(wpName) + "--extensions"
+}
+
+// GetCoreUpdateJobName returns the name for the job that updates the WordPress core of a site
+func GetCoreUpdateJobName(wpName string) string {
+	if len(wpName) > 63-13 { // job names are limited to 63 characters, 13 is for the suffix "--core-update"
+		wpName = wpName[:63-13]
+	}
+
+	return GetResourceName(wpName) + "--core-update"
+}
+
+// GetCoreUpdateBackupName returns the name for the backup taken before an update of the WordPress core,
+// the backup and its job share the name, the time keeps the backups of several updates apart
+func GetCoreUpdateBackupName(wpName string, t time.Time) string {
+	suffix := fmt.Sprintf("--core-update-%d", t.Unix())
+	if len(wpName) > 63-len(suffix) {
+		wpName = wpName[:63-len(suffix)]
+	}
+
+	return GetResourceName(wpName) + suffix
+}
+
+// GetCommandJobName returns the name for the job that runs a WordPressSiteCommand
+func GetCommandJobName(commandName string) string {
+	if len(commandName) > 63-5 { // job names are limited to 63 characters, 5 is for the suffix "--cli"
+		commandName = commandName[:63-5]
+	}
+
+	return commandName + "--cli"
+}
+
+// GetWPCronJobName returns the name for the cron job that runs the scheduled events of WordPress
+func GetWPCronJobName(wpName string) string {
+	if len(wpName) > 52-6 { // cron job names are limited to 52 characters, 6 is for the suffix "--cron"
+		wpName = wpName[:52-6]
+	}
+
+	return GetResourceName(wpName) + "--cron"
 }
@@ -0,0 +1,262 @@
+package wordpress
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+const (
+	// CoreVersionAnnotation is set on the core update job, it is the version the job updates to
+	CoreVersionAnnotation = "crm.hostzero.de/core-version"
+
+	CoreUpdateContainer = "core-update"
+)
+
+// CoreUpdateResult is written by the core update container as termination message
+type CoreUpdateResult struct {
+	FromVersion string `json:"fromVersion"`
+	ToVersion   string `json:"toVersion"`
+}
+
+// the core update container updates the files and then the database of WordPress,
+// WordPress shows its maintenance page while the files are replaced
+// plugins and themes are not loaded, a broken one must not stop the update
+const coreUpdateScript = `set -e
+` + wpCliSetupScript + `
+WP="/tmp/wp-cli --path=/var/www/html --allow-root --skip-plugins --skip-themes"
+
+FROM_VERSION=$($WP core version)
+echo "Updating WordPress $FROM_VERSION to $WORDPRESS_CORE_VERSION..."
+if [ "$WORDPRESS_CORE_SOURCE" = "Image" ]; then
+	# the core files are copied from the WordPress image, which has to contain the version
+	IMAGE_VERSION=$(php -r 'include "/usr/src/wordpress/wp-includes/version.php"; echo $wp_version;')
+	if [ "$IMAGE_VERSION" != "$WORDPRESS_CORE_VERSION" ]; then
+		echo "ERROR: the image contains WordPress $IMAGE_VERSION, not $WORDPRESS_CORE_VERSION"
+		exit 1
+	fi
+	# the site must not stay in maintenance mode when the copy fails
+	$WP maintenance-mode activate
+	trap '$WP maintenance-mode deactivate' EXIT
+	(cd /usr/src/wordpress && tar -cf - --exclude=./wp-content .) | tar -xf - -C /var/www/html
+	$WP maintenance-mode deactivate
+	trap - EXIT
+else
+	$WP core update --version="$WORDPRESS_CORE_VERSION"
+fi
+$WP core update-db
+if $WP core is-installed --network 2>/dev/null; then
+	$WP core update-db --network
+fi
+
+TO_VERSION=$($WP core version)
+chown -R 33:33 /var/www/html
+printf '{"fromVersion":"%s","toVersion":"%s"}' "$FROM_VERSION" "$TO_VERSION" > /dev/termination-log
+`
+
+// releaseVersionPattern matches final releases, betas and release candidates are never installed
+var releaseVersionPattern = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)?$`)
+
+// coreReleases caches the released WordPress versions for all sites
+// a failed fetch is cached as well, so an unreachable URL is only requested once per check interval
+var coreReleases struct {
+	mu        sync.Mutex
+	versions  []string
+	latest    string
+	err       error
+	fetchedAt time.Time
+}
+
+var releasesClient = &http.Client{Timeout: 10 * time.Second}
+
+// GetCoreReleases returns the released WordPress versions and the latest one from CORE_RELEASES_URL,
+// they are fetched at most once per CORE_UPDATE_CHECK_INTERVAL
+func GetCoreReleases(ctx context.Context) (versions []string, latest string, err error) {
+	coreReleases.mu.Lock()
+	defer coreReleases.mu.Unlock()
+
+	if coreReleases.fetchedAt.IsZero() || time.Since(coreReleases.fetchedAt) >= config.AppConfig.CoreUpdateCheckInterval {
+		coreReleases.versions, coreReleases.latest, coreReleases.err = fetchCoreReleases(ctx)
+		coreReleases.fetchedAt = time.Now()
+	}
+
+	return coreReleases.versions, coreReleases.latest, coreReleases.err
+}
+
+// fetchCoreReleases requests the released WordPress versions and the latest one from CORE_RELEASES_URL
+func fetchCoreReleases(ctx context.Context) (versions []string, latest string, err error) {
+	url := config.AppConfig.CoreReleasesURL
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := releasesClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to request %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read %s: %w", url, err)
+	}
+
+	// every version is mapped to latest, outdated or insecure
+	releases := map[string]string{}
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return nil, "", fmt.Errorf("failed to parse %s: %w", url, err)
+	}
+
+	versions = []string{}
+	latest = ""
+	for version, state := range releases {
+		if !releaseVersionPattern.MatchString(version) {
+			continue
+		}
+		versions = append(versions, version)
+		if state == "latest" {
+			latest = version
+		}
+	}
+	if latest == "" {
+		return nil, "", fmt.Errorf("%s does not name the latest version", url)
+	}
+
+	return versions, latest, nil
+}
+
+// GetCoreUpdateTarget returns the version the WordPress core of the site should be updated to, empty if it is up to date
+// a pinned coreVersion wins over the update policy, the installed version is read from the running site
+func GetCoreUpdateTarget(ctx context.Context, wp *crmv1.WordPressSite) (string, error) {
+	installed := wp.Status.WordPressVersion
+	if installed == "" {
+		return "", nil
+	}
+
+	if wp.Spec.WordPress.CoreVersion != "" {
+		if CompareVersions(wp.Spec.WordPress.CoreVersion, installed) > 0 {
+			return wp.Spec.WordPress.CoreVersion, nil
+		}
+		return "", nil
+	}
+
+	policy := wp.Spec.WordPress.UpdatePolicy
+	if policy != crmv1.CoreUpdatePolicyMinor && policy != crmv1.CoreUpdatePolicyMajor {
+		return "", nil
+	}
+
+	versions, latest, err := GetCoreReleases(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	target := ""
+	if policy == crmv1.CoreUpdatePolicyMajor {
+		target = latest
+	} else {
+		branch := getVersionBranch(installed)
+		for _, version := range versions {
+			if getVersionBranch(version) == branch && (target == "" || CompareVersions(version, target) > 0) {
+				target = version
+			}
+		}
+	}
+
+	if target == "" || CompareVersions(target, installed) <= 0 {
+		return "", nil
+	}
+	return target, nil
+}
+
+// CompareVersions compares two WordPress versions, missing parts count as 0, so 6.5 equals 6.5.0
+// returns a negative number if a is older than b, a positive one if it is newer and 0 if they are equal
+func CompareVersions(a string, b string) int {
+	partsA := strings.Split(a, ".")
+	partsB := strings.Split(b, ".")
+
+	for i := 0; i < max(len(partsA), len(partsB)); i++ {
+		var numberA, numberB int
+		if i < len(partsA) {
+			numberA, _ = strconv.Atoi(partsA[i])
+		}
+		if i < len(partsB) {
+			numberB, _ = strconv.Atoi(partsB[i])
+		}
+		if numberA != numberB {
+			return numberA - numberB
+		}
+	}
+
+	return 0
+}
+
+// getVersionBranch returns the major version of WordPress, e.g. 6.5 for 6.5.3
+func getVersionBranch(version string) string {
+	parts := strings.SplitN(version, ".", 3)
+	if len(parts) < 2 {
+		return version
+	}
+	return parts[0] + "." + parts[1]
+}
+
+// BuildCoreUpdateJobSpec returns the job spec that updates the WordPress core of the site to the version
+func BuildCoreUpdateJobSpec(wp *crmv1.WordPressSite, version string) batchv1.JobSpec {
+	backoffLimit := int32(0)
+
+	container := corev1.Container{
+		Name:    CoreUpdateContainer,
+		Command: []string{"sh", "-c", coreUpdateScript},
+		Env: append(getDatabaseTLSEnv(wp),
+			corev1.EnvVar{Name: "WORDPRESS_CORE_VERSION", Value: version},
+			corev1.EnvVar{Name: "WORDPRESS_CORE_SOURCE", Value: GetCoreSource(wp)},
+		),
+	}
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetCoreUpdateLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "core-update-job",
+				}),
+			},
+			Spec: buildWPCliPodSpec(wp, container),
+		},
+	}
+}
+
+// GetCoreUpdateResult reads the versions the core update container of a finished pod reported
+func GetCoreUpdateResult(pod *corev1.Pod) (*CoreUpdateResult, error) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != CoreUpdateContainer || status.State.Terminated == nil {
+			continue
+		}
+
+		result := &CoreUpdateResult{}
+		if err := json.Unmarshal([]byte(status.State.Terminated.Message), result); err != nil {
+			return nil, fmt.Errorf("failed to parse core update result: %w", err)
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("core update pod %s has no result", pod.Name)
+}
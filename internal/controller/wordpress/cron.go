@@ -0,0 +1,158 @@
+package wordpress
+
+import (
+	"context"
+	"strconv"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+const WPCronContainer = "cron"
+
+// the cron container runs the due events of every site of a multisite, wp-cli only runs the ones of the main site by default
+const wpCronScript = `set -e
+` + wpCliSetupScript + `
+WP="/tmp/wp-cli --path=/var/www/html"
+
+if $WP core is-installed --network 2>/dev/null; then
+	for URL in $($WP site list --field=url); do
+		$WP cron event run --due-now --url="$URL"
+	done
+else
+	$WP cron event run --due-now
+fi
+`
+
+// IsKubernetesCron returns true if the scheduled events of the site are run by a CronJob instead of on page loads
+func IsKubernetesCron(wp *crmv1.WordPressSite) bool {
+	return wp.Spec.WordPress.Cron != nil && wp.Spec.WordPress.Cron.Mode != crmv1.CronModeBuiltin
+}
+
+// getCronEnv returns the environment variable the init container sets DISABLE_WP_CRON in wp-config.php from
+func getCronEnv(wp *crmv1.WordPressSite) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: "WORDPRESS_DISABLE_CRON", Value: strconv.FormatBool(IsKubernetesCron(wp))},
+	}
+}
+
+// ReconcileWPCronJob creates, updates or removes the CronJob that runs the scheduled events of WordPress
+func ReconcileWPCronJob(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "cron")
+
+	cronJobName := GetWPCronJobName(wp.Name)
+
+	if !IsKubernetesCron(wp) {
+		// WP-Cron runs on page loads, remove an existing cron job
+		cronJob := &batchv1.CronJob{}
+		err := r.Get(ctx, types.NamespacedName{Name: cronJobName, Namespace: wp.Namespace}, cronJob)
+		if errors.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			logger.Error(err, "Failed to get WP-Cron CronJob")
+			return err
+		}
+
+		logger.Info("WP-Cron runs on page loads, deleting WP-Cron CronJob", "name", cronJobName)
+		if err := r.Delete(ctx, cronJob, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete WP-Cron CronJob")
+			return err
+		}
+		return nil
+	}
+
+	cron := wp.Spec.WordPress.Cron
+
+	cronJob := &batchv1.CronJob{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cronJobName,
+			Namespace: wp.Namespace,
+		},
+	}
+
+	_, err := ctrl.CreateOrUpdate(ctx, r, cronJob, func() error {
+		successfulJobsHistoryLimit := int32(3)
+		failedJobsHistoryLimit := int32(1)
+		// missed runs are not caught up, the next run picks up all due events
+		startingDeadlineSeconds := int64(300)
+
+		concurrencyPolicy := batchv1.ForbidConcurrent
+		if cron.ConcurrencyPolicy != "" {
+			concurrencyPolicy = batchv1.ConcurrencyPolicy(cron.ConcurrencyPolicy)
+		}
+		schedule := cron.Schedule
+		if schedule == "" {
+			schedule = "*/5 * * * *"
+		}
+
+		cronJob.Labels = GetCronLabels(wp, map[string]string{
+			"app.kubernetes.io/name": "cron-cronjob",
+		})
+		cronJob.Spec.Schedule = schedule
+		cronJob.Spec.ConcurrencyPolicy = concurrencyPolicy
+		cronJob.Spec.StartingDeadlineSeconds = &startingDeadlineSeconds
+		cronJob.Spec.SuccessfulJobsHistoryLimit = &successfulJobsHistoryLimit
+		cronJob.Spec.FailedJobsHistoryLimit = &failedJobsHistoryLimit
+		// no events run while the site is scaled down for a restore or the import of a database migration
+		suspend := GetDesiredReplicas(wp) == 0
+		cronJob.Spec.Suspend = &suspend
+		cronJob.Spec.JobTemplate = batchv1.JobTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetCronLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "cron-job",
+				}),
+			},
+			Spec: BuildWPCronJobSpec(wp),
+		}
+
+		return controllerutil.SetControllerReference(wp, cronJob, scheme)
+	})
+
+	if err != nil {
+		logger.Error(err, "Failed to reconcile WP-Cron CronJob", "name", cronJobName)
+		return err
+	}
+
+	return nil
+}
+
+// BuildWPCronJobSpec returns the job spec that runs the due scheduled events of the site
+func BuildWPCronJobSpec(wp *crmv1.WordPressSite) batchv1.JobSpec {
+	// the next run is the retry
+	backoffLimit := int32(0)
+
+	// the events run as www-data, so the files they write can be changed by WordPress
+	wwwData := int64(33)
+
+	container := corev1.Container{
+		Name:    WPCronContainer,
+		Command: []string{"sh", "-c", wpCronScript},
+		Env:     append(getDatabaseEnv(wp), getDatabaseTLSEnv(wp)...),
+		SecurityContext: &corev1.SecurityContext{
+			RunAsUser:  &wwwData,
+			RunAsGroup: &wwwData,
+		},
+	}
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetCronLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "cron-job",
+				}),
+			},
+			Spec: buildWPCliPodSpec(wp, container),
+		},
+	}
+}
@@ -3,26 +3,112 @@ package wordpress
 import (
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	stderrors "errors"
 	"fmt"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"os"
+	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"slices"
 	"strconv"
 	"strings"
 
 	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
 	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
 )
 
 const MariaDBClusterName = "kubepress"
 
+// StandardPrivileges are the privileges WordPress needs on its database
+var StandardPrivileges = []string{
+	"SELECT", "INSERT", "UPDATE", "DELETE", "CREATE", "ALTER", "INDEX", "DROP", "CREATE TEMPORARY TABLES", "LOCK TABLES",
+}
+
+// GetDatabasePrivileges returns the privileges of the database user of the site
+func GetDatabasePrivileges(wp *crmv1.WordPressSite) []string {
+	if wp.Spec.Database.Privileges == crmv1.DatabasePrivilegesAll {
+		return []string{"ALL PRIVILEGES"}
+	}
+	return StandardPrivileges
+}
+
+// ErrMariaDBNotFound is returned by ReconcileDatabase if the referenced MariaDB cluster does not exist
+var ErrMariaDBNotFound = stderrors.New("MariaDB cluster not found")
+
+// GetMariaDBRef returns the MariaDB cluster the database of the site lives in
+// the cluster recorded in the status comes first, then spec.database.mariaDBRef and the operator default,
+// otherwise it is the "kubepress" cluster in the namespace of the site
+func GetMariaDBRef(wp *crmv1.WordPressSite) types.NamespacedName {
+	ref := wp.Status.MariaDBRef
+	if ref == nil {
+		ref = wp.Spec.Database.MariaDBRef
+	}
+	if ref == nil {
+		ref = config.AppConfig.DefaultMariaDBRef
+	}
+	if ref == nil {
+		return getNamespaceMariaDBRef(wp)
+	}
+
+	namespace := ref.Namespace
+	if namespace == "" {
+		namespace = wp.Namespace
+	}
+
+	return types.NamespacedName{Name: ref.Name, Namespace: namespace}
+}
+
+// getNamespaceMariaDBRef returns the "kubepress" cluster the operator creates in the namespace of the site
+func getNamespaceMariaDBRef(wp *crmv1.WordPressSite) types.NamespacedName {
+	return types.NamespacedName{Name: MariaDBClusterName, Namespace: wp.Namespace}
+}
+
+// GetMariaDBHost returns the host the MariaDB cluster is reachable at
+func GetMariaDBHost(ref types.NamespacedName) string {
+	return fmt.Sprintf("%s.%s.svc.cluster.local", ref.Name, ref.Namespace)
+}
+
+// GetDatabaseResourceName returns the name of the Database of the site, which is also the name of the database on the server
+// databases next to a cluster in another namespace are prefixed with the namespace of the site, as many namespaces share the cluster
+// longer names are shortened and get a hash of the full name, so sites with the same beginning don't share a database
+func GetDatabaseResourceName(wp *crmv1.WordPressSite, ref types.NamespacedName) string {
+	if ref.Namespace == wp.Namespace {
+		return wp.Name
+	}
+
+	name := wp.Namespace + "--" + wp.Name
+	if len(name) > 64 { // MariaDB limits database names to 64 characters, 9 is for the suffix "-<hash>"
+		sum := sha256.Sum256([]byte(name))
+		name = name[:64-9] + "-" + hex.EncodeToString(sum[:4])
+	}
+
+	return name
+}
+
+// GetDatabaseUserSecretName returns the name of the copy of the database password next to the MariaDB cluster
+func GetDatabaseUserSecretName(username string) string {
+	return username + "--password"
+}
+
+// setDatabaseOwnerReference sets the site as the owner of a database object
+// objects next to a cluster in another namespace can't be owned, the finalizer of the site removes them
+func setDatabaseOwnerReference(wp *crmv1.WordPressSite, obj client.Object, scheme *runtime.Scheme) error {
+	if obj.GetNamespace() != wp.Namespace {
+		return nil
+	}
+
+	return controllerutil.SetControllerReference(wp, obj, scheme)
+}
+
 func GenerateRandomString(length int) (string, error) {
 	const charset = "abcdefghijklmnopqrstuvwxyz0123456789"
 	b := make([]byte, length)
@@ -44,51 +130,58 @@ func GenerateRandomString(length int) (string, error) {
 func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) error {
 	logger := log.FromContext(ctx).WithValues("component", "database")
 
-	// Create database resource name
-	dbResourceName := wp.Name
-
-	if !wp.Spec.Database.CreateNew {
+	// the managed database is also provisioned while the existing one is migrated into it
+	if !wp.Spec.Database.CreateNew && !IsMigratingDatabase(wp) {
 		return nil
 	}
 
-	// Check if MariaDBCluster named "kubepress" exists in the namespace
-	mariadbCluster := &mariadbv1alpha1.MariaDB{}
-	size := resource.MustParse("10Gi")
-	err := r.Get(ctx, types.NamespacedName{Name: MariaDBClusterName, Namespace: wp.Namespace}, mariadbCluster)
+	// the admin secret of the user is only read, the connection data lives in a secret of our own
+	adminSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: wp.Spec.AdminUserSecretKeyRef, Namespace: wp.Namespace}, adminSecret)
 	if err != nil {
-		if errors.IsNotFound(err) {
-			// No MariaDBCluster named "kubepress" found, create one
+		logger.Error(err, "Failed to get WP secret")
+		return err
+	}
 
-			// create root secret first
-			rootSecretName := "kubepress-mariadb-root-secret"
+	// Check if we have a database user in the secret
+	secret, err := getOrCreateDatabaseSecret(ctx, r, scheme, wp, adminSecret)
+	if err != nil {
+		logger.Error(err, "Failed to get database secret")
+		return err
+	}
 
-			rootPassword, err := GenerateRandomString(30)
-			if err != nil {
-				logger.Error(err, "Failed to generate random root password for MariaDB")
-				return err
-			}
+	mariaDBRef := GetMariaDBRef(wp)
 
-			labels := map[string]string{}
-			labels["app.kubernetes.io/managed-by"] = "kubepress-operator"
+	// sites created before the cluster could be chosen live in the "kubepress" cluster of their namespace
+	if wp.Status.MariaDBRef == nil && string(secret.Data["databaseHost"]) == GetMariaDBHost(getNamespaceMariaDBRef(wp)) {
+		mariaDBRef = getNamespaceMariaDBRef(wp)
+	}
 
-			rootSecret := &corev1.Secret{
-				ObjectMeta: metav1.ObjectMeta{
-					Name:      rootSecretName,
-					Namespace: wp.Namespace,
-					Labels:    labels,
-				},
-				StringData: map[string]string{
-					"password": rootPassword,
-				},
-			}
+	logger = logger.WithValues("mariadb", mariaDBRef.String())
 
-			if err := r.Create(ctx, rootSecret); err != nil {
-				if !errors.IsAlreadyExists(err) {
-					logger.Error(err, "Failed to create root secret for MariaDB")
-					return err
+	// Create database resource name
+	dbResourceName := GetDatabaseResourceName(wp, mariaDBRef)
+
+	// Check if the MariaDB cluster exists
+	mariadbCluster := &mariadbv1alpha1.MariaDB{}
+	err = r.Get(ctx, mariaDBRef, mariadbCluster)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get MariaDB cluster")
+			return err
+		}
+
+		if mariaDBRef != getNamespaceMariaDBRef(wp) {
+			// referenced clusters are not ours to create, a KubePressDatabaseCluster creates its MariaDB on its own
+			if err := r.Get(ctx, mariaDBRef, &crmv1.KubePressDatabaseCluster{}); err != nil {
+				if errors.IsNotFound(err) {
+					return fmt.Errorf("%w: %s", ErrMariaDBNotFound, mariaDBRef)
 				}
+				logger.Error(err, "Failed to get KubePressDatabaseCluster")
+				return err
 			}
-
+		} else {
+			// No MariaDBCluster named "kubepress" found, create one through a KubePressDatabaseCluster
 			MariaDBReplicas := os.Getenv("MARIADB_REPLICAS")
 			replicas, err := strconv.Atoi(MariaDBReplicas)
 
@@ -97,46 +190,45 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 				replicas = 1
 			}
 
-			mariadbCluster = &mariadbv1alpha1.MariaDB{
+			if replicas%2 == 0 {
+				logger.Info("MARIADB_REPLICAS must be odd to keep the quorum, using one replica less")
+				replicas--
+			}
+
+			labels := map[string]string{}
+			labels["app.kubernetes.io/managed-by"] = "kubepress-operator"
+
+			cluster := &crmv1.KubePressDatabaseCluster{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      MariaDBClusterName,
 					Namespace: wp.Namespace,
 					Labels:    labels,
 				},
-				Spec: mariadbv1alpha1.MariaDBSpec{
+				Spec: crmv1.KubePressDatabaseClusterSpec{
 					Replicas: int32(replicas),
-					Storage: mariadbv1alpha1.Storage{
-						Size: &size,
-					},
-					RootPasswordSecretKeyRef: mariadbv1alpha1.GeneratedSecretKeyRef{
-						SecretKeySelector: mariadbv1alpha1.SecretKeySelector{
-							LocalObjectReference: mariadbv1alpha1.LocalObjectReference{
-								Name: rootSecretName,
-							},
-							Key: "password",
-						},
-					},
-					Galera: &mariadbv1alpha1.Galera{
-						Enabled: replicas > 1,
+					Storage: crmv1.DatabaseClusterStorage{
+						Size: "10Gi",
 					},
 				},
 			}
 
-			if err := r.Create(ctx, mariadbCluster); err != nil {
-				logger.Error(err, "Failed to create MariaDBCluster 'kubepress'")
-				return err
+			if err := r.Create(ctx, cluster); err != nil {
+				if !errors.IsAlreadyExists(err) {
+					logger.Error(err, "Failed to create KubePressDatabaseCluster 'kubepress'")
+					return err
+				}
+			} else {
+				logger.Info("Created KubePressDatabaseCluster", "name", cluster.Name)
 			}
-			logger.Info("Created MariaDBCluster", "name", mariadbCluster.Name)
-			// Optionally, return here if you want to wait for cluster readiness before proceeding
-		} else {
-			logger.Error(err, "Failed to get MariaDBCluster 'kubepress'")
-			return err
 		}
 	}
 
+	// record the cluster, so the database stays where it is when the operator default changes
+	wp.Status.MariaDBRef = &crmv1.MariaDBRef{Name: mariaDBRef.Name, Namespace: mariaDBRef.Namespace}
+
 	// Check if MariaDB Database already exists
 	mdb := &mariadbv1alpha1.Database{}
-	err = r.Get(ctx, types.NamespacedName{Name: dbResourceName, Namespace: wp.Namespace}, mdb)
+	err = r.Get(ctx, types.NamespacedName{Name: dbResourceName, Namespace: mariaDBRef.Namespace}, mdb)
 	if err != nil {
 		if !errors.IsNotFound(err) {
 			logger.Error(err, "Failed to get MariaDB Database")
@@ -151,24 +243,23 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 		mdb = &mariadbv1alpha1.Database{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      dbResourceName,
-				Namespace: wp.Namespace,
+				Namespace: mariaDBRef.Namespace,
 				Labels:    labels,
 			},
 			Spec: mariadbv1alpha1.DatabaseSpec{
 				MariaDBRef: mariadbv1alpha1.MariaDBRef{
 					ObjectReference: mariadbv1alpha1.ObjectReference{
-						Name:      MariaDBClusterName, // The name of the cluster you created
-						Namespace: wp.Namespace,
+						Name:      mariaDBRef.Name,
+						Namespace: mariaDBRef.Namespace,
 					},
 				},
-				// Optionally set Charset, Collate, etc.
-				// Charset: "utf8mb4",
-				// Collate: "utf8mb4_unicode_ci",
+				CharacterSet: wp.GetDatabaseSettings().Charset,
+				Collate:      wp.GetDatabaseSettings().Collation,
 			},
 		}
 
 		// Set owner reference
-		if err := controllerutil.SetControllerReference(wp, mdb, scheme); err != nil {
+		if err := setDatabaseOwnerReference(wp, mdb, scheme); err != nil {
 			logger.Error(err, "Unable to set owner reference to MariaDB Database", "object", mdb.GetName())
 			return err
 		}
@@ -179,30 +270,6 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 		}
 	}
 
-	// Check if we have a database user in the secret
-	secretName := GetDatabaseSecretName(wp.Name)
-	secret := &corev1.Secret{}
-	err = r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: wp.Namespace}, secret)
-	if err != nil {
-		logger.Error(err, "Failed to get WP secret")
-		return err
-	}
-
-	// check whether we have a databasePassword key in the secret
-	if _, exists := secret.Data["databasePassword"]; !exists {
-		// Update the secret with the database password
-		if secret.Data == nil {
-			secret.Data = make(map[string][]byte)
-		}
-
-		secret.Data["databasePassword"] = secret.Data["password"]
-
-		if err := r.Update(ctx, secret); err != nil {
-			logger.Error(err, "Failed to update WP secret with database password")
-			return err
-		}
-	}
-
 	// checks whether the databaseUsername key exists in the secret
 	if _, exists := secret.Data["databaseUsername"]; !exists {
 		// no databaseUsername found in secret
@@ -210,7 +277,7 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 		// use the username from the admin user secret as name
 
 		// get the WordPress admin username from Spec
-		adminUsername := string(secret.Data["username"])
+		adminUsername := string(adminSecret.Data["username"])
 		if adminUsername == "" {
 			return fmt.Errorf("username in associated secret is empty")
 		}
@@ -236,7 +303,7 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 
 		// check if the username exists already
 		existingUser := &mariadbv1alpha1.User{}
-		err = r.Get(ctx, types.NamespacedName{Name: mySqlUniqueUsername, Namespace: wp.Namespace}, existingUser)
+		err = r.Get(ctx, types.NamespacedName{Name: mySqlUniqueUsername, Namespace: mariaDBRef.Namespace}, existingUser)
 		if err == nil {
 			// user already exists, this is very unlikely because of the random suffix, but just in case
 			logger.Info("Generated MySQL username already exists, generating a new one", "username", mySqlUniqueUsername)
@@ -249,7 +316,7 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 		}
 
 		// user not found, create it
-		err = CreateDatabaseUser(ctx, r, scheme, wp, dbResourceName, mySqlUniqueUsername, secretName)
+		err = CreateDatabaseUser(ctx, r, scheme, wp, mariaDBRef, dbResourceName, mySqlUniqueUsername, secret)
 
 		if err != nil {
 			logger.Error(err, "Failed to create database user")
@@ -263,7 +330,7 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 
 		secret.Data["databaseUsername"] = []byte(mySqlUniqueUsername)
 		secret.Data["database"] = []byte(dbResourceName)
-		secret.Data["databaseHost"] = []byte(fmt.Sprintf("%s.%s.svc.cluster.local", MariaDBClusterName, wp.Namespace))
+		secret.Data["databaseHost"] = []byte(GetMariaDBHost(mariaDBRef))
 
 		if err := r.Update(ctx, secret); err != nil {
 			logger.Error(err, "Failed to update WP secret with database username")
@@ -273,15 +340,29 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 		// existing databaseUsername found in secret
 		databaseUsername := string(secret.Data["databaseUsername"])
 
+		// keep the copy of the password next to the cluster up to date
+		if err := reconcileDatabaseUserSecret(ctx, r, wp, mariaDBRef, databaseUsername, secret); err != nil {
+			return err
+		}
+
 		// databaseUsername exists, check if also the user exists in MariaDB, if not, create it
 		// check if the username exists already
 		existingUser := &mariadbv1alpha1.User{}
-		err = r.Get(ctx, types.NamespacedName{Name: databaseUsername, Namespace: wp.Namespace}, existingUser)
+		err = r.Get(ctx, types.NamespacedName{Name: databaseUsername, Namespace: mariaDBRef.Namespace}, existingUser)
 
 		if err == nil {
-			// user already exists
-			// we don't need to do anything here
-			return nil
+			// users created by older versions of the operator read the password from the admin secret
+			if passwordSecretName := getDatabaseUserSecretName(wp, mariaDBRef, databaseUsername, secret); existingUser.Spec.PasswordSecretKeyRef != nil && existingUser.Spec.PasswordSecretKeyRef.Name != passwordSecretName {
+				existingUser.Spec.PasswordSecretKeyRef.Name = passwordSecretName
+				existingUser.Spec.PasswordSecretKeyRef.Key = "databasePassword"
+				if err := r.Update(ctx, existingUser); err != nil {
+					logger.Error(err, "Failed to move the password of the MySQL user to the database secret")
+					return err
+				}
+			}
+
+			// user already exists, only the privileges may have changed
+			return reconcileDatabaseGrantPrivileges(ctx, r, mariaDBRef, databaseUsername, GetDatabasePrivileges(wp))
 		}
 
 		if !errors.IsNotFound(err) {
@@ -290,7 +371,7 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 		}
 
 		// user not found, create it
-		err = CreateDatabaseUser(ctx, r, scheme, wp, dbResourceName, databaseUsername, secretName)
+		err = CreateDatabaseUser(ctx, r, scheme, wp, mariaDBRef, dbResourceName, databaseUsername, secret)
 
 		if err != nil {
 			logger.Error(err, "Failed to create database user")
@@ -304,7 +385,7 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 
 		secret.Data["databaseUsername"] = []byte(databaseUsername)
 		secret.Data["database"] = []byte(dbResourceName)
-		secret.Data["databaseHost"] = []byte(fmt.Sprintf("%s.%s.svc.cluster.local", MariaDBClusterName, wp.Namespace))
+		secret.Data["databaseHost"] = []byte(GetMariaDBHost(mariaDBRef))
 
 		if err := r.Update(ctx, secret); err != nil {
 			logger.Error(err, "Failed to update WP secret with database username")
@@ -315,10 +396,113 @@ func ReconcileDatabase(ctx context.Context, r client.Client, scheme *runtime.Sch
 	return nil
 }
 
+// getOrCreateDatabaseSecret returns the secret with the connection data of the database of the site
+// it is created with a random password, sites of older versions of the operator get the keys from their admin secret
+func getOrCreateDatabaseSecret(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite, adminSecret *corev1.Secret) (*corev1.Secret, error) {
+	logger := log.FromContext(ctx).WithValues("component", "database")
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}, secret)
+	if err == nil || !errors.IsNotFound(err) {
+		return secret, err
+	}
+
+	password, err := GenerateRandomString(30)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string][]byte{
+		"databasePassword": []byte(password),
+	}
+
+	// sites of older versions kept the keys in the admin secret, users may also supply the database user there
+	// during a migration the admin secret holds the existing database, the managed one gets a new user
+	if _, ok := adminSecret.Data["databaseUsername"]; ok && wp.Spec.Database.CreateNew {
+		for _, key := range databaseSecretKeys {
+			if value, ok := adminSecret.Data[key]; ok {
+				data[key] = value
+			}
+		}
+		logger.Info("Moving the database keys of the admin secret into the database secret", "name", adminSecret.Name)
+	}
+
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetDatabaseSecretName(wp.Name),
+			Namespace: wp.Namespace,
+			Labels: GetDatabaseLabels(wp, map[string]string{
+				"app.kubernetes.io/name": "mariadb-credentials",
+				mariaDBWatchLabel:        "",
+			}),
+		},
+		Data: data,
+	}
+
+	if err := controllerutil.SetControllerReference(wp, secret, scheme); err != nil {
+		return nil, err
+	}
+
+	if err := r.Create(ctx, secret); err != nil {
+		return nil, err
+	}
+
+	return secret, nil
+}
+
+// getDatabaseUserSecretName returns the name of the secret a database user reads its password from
+func getDatabaseUserSecretName(wp *crmv1.WordPressSite, mariaDBRef types.NamespacedName, username string, secret *corev1.Secret) string {
+	if mariaDBRef.Namespace != wp.Namespace {
+		return GetDatabaseUserSecretName(username)
+	}
+	return secret.Name
+}
+
+// reconcileDatabaseUserSecret copies the database password next to a MariaDB cluster in another namespace,
+// the User can only reference secrets in its own namespace
+func reconcileDatabaseUserSecret(ctx context.Context, r client.Client, wp *crmv1.WordPressSite, mariaDBRef types.NamespacedName, username string, secret *corev1.Secret) error {
+	if mariaDBRef.Namespace == wp.Namespace {
+		return nil
+	}
+
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetDatabaseUserSecretName(username),
+			Namespace: mariaDBRef.Namespace,
+		},
+	}
+
+	_, err := ctrl.CreateOrUpdate(ctx, r, userSecret, func() error {
+		userSecret.Labels = GetDatabaseLabels(wp, map[string]string{
+			"app.kubernetes.io/name": "mariadb-user-password",
+		})
+		// copies of read-only users are removed together with them
+		if name, ok := secret.Labels[ReadOnlyUserLabel]; ok {
+			userSecret.Labels[ReadOnlyUserLabel] = name
+		}
+		userSecret.Labels[mariaDBWatchLabel] = ""
+		userSecret.Data = map[string][]byte{
+			"databasePassword": secret.Data["databasePassword"],
+		}
+		return nil
+	})
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to reconcile database password secret", "name", userSecret.Name)
+		return err
+	}
+
+	return nil
+}
+
 // create user function
-func CreateDatabaseUser(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite, dbResourceName string, username string, secretName string) error {
+func CreateDatabaseUser(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite, mariaDBRef types.NamespacedName, dbResourceName string, username string, secret *corev1.Secret) error {
 	logger := log.FromContext(ctx).WithValues("component", "database-user")
 
+	// the user reads its password from the database secret, or from a copy if the cluster lives in another namespace
+	if err := reconcileDatabaseUserSecret(ctx, r, wp, mariaDBRef, username, secret); err != nil {
+		return err
+	}
+	passwordSecretName := getDatabaseUserSecretName(wp, mariaDBRef, username, secret)
+
 	labels := GetDatabaseLabels(wp, map[string]string{
 		"app.kubernetes.io/name": "mariadb-user",
 	})
@@ -326,27 +510,27 @@ func CreateDatabaseUser(ctx context.Context, r client.Client, scheme *runtime.Sc
 	user := &mariadbv1alpha1.User{}
 	user.ObjectMeta = metav1.ObjectMeta{
 		Name:      username,
-		Namespace: wp.Namespace,
+		Namespace: mariaDBRef.Namespace,
 		Labels:    labels,
 	}
 	user.Spec = mariadbv1alpha1.UserSpec{
 		MariaDBRef: mariadbv1alpha1.MariaDBRef{
 			ObjectReference: mariadbv1alpha1.ObjectReference{
-				Name:      MariaDBClusterName,
-				Namespace: wp.Namespace,
+				Name:      mariaDBRef.Name,
+				Namespace: mariaDBRef.Namespace,
 			},
 		},
-		Host: "%", // Allow access from any host, adjust as needed
+		Host: config.AppConfig.DatabaseUserHost,
 		PasswordSecretKeyRef: &mariadbv1alpha1.SecretKeySelector{
 			LocalObjectReference: mariadbv1alpha1.LocalObjectReference{
-				Name: secretName,
+				Name: passwordSecretName,
 			},
 			Key: "databasePassword",
 		},
 	}
 
 	// Set owner reference
-	if err := controllerutil.SetControllerReference(wp, user, scheme); err != nil {
+	if err := setDatabaseOwnerReference(wp, user, scheme); err != nil {
 		logger.Error(err, "Unable to set owner reference to MariaDB User", "object", user.GetName())
 		return err
 	}
@@ -361,30 +545,28 @@ func CreateDatabaseUser(ctx context.Context, r client.Client, scheme *runtime.Sc
 		"app.kubernetes.io/name": "mariadb-grant",
 	})
 	grant := &mariadbv1alpha1.Grant{}
-	HostString := "%"
+	HostString := config.AppConfig.DatabaseUserHost
 	grant.ObjectMeta = metav1.ObjectMeta{
 		Name:      fmt.Sprintf("grant-%s", username),
-		Namespace: wp.Namespace,
+		Namespace: mariaDBRef.Namespace,
 		Labels:    labels,
 	}
 	grant.Spec = mariadbv1alpha1.GrantSpec{
 		MariaDBRef: mariadbv1alpha1.MariaDBRef{
 			ObjectReference: mariadbv1alpha1.ObjectReference{
-				Name:      MariaDBClusterName,
-				Namespace: wp.Namespace,
+				Name:      mariaDBRef.Name,
+				Namespace: mariaDBRef.Namespace,
 			},
 		},
-		Database: dbResourceName,
-		Username: username,
-		Privileges: []string{
-			"ALL PRIVILEGES",
-		},
-		Table: "*",
-		Host:  &HostString,
+		Database:   dbResourceName,
+		Username:   username,
+		Privileges: GetDatabasePrivileges(wp),
+		Table:      "*",
+		Host:       &HostString,
 	}
 
 	// Set owner reference
-	if err := controllerutil.SetControllerReference(wp, grant, scheme); err != nil {
+	if err := setDatabaseOwnerReference(wp, grant, scheme); err != nil {
 		logger.Error(err, "Unable to set owner reference", "object", grant.GetName())
 		return err
 	}
@@ -396,3 +578,25 @@ func CreateDatabaseUser(ctx context.Context, r client.Client, scheme *runtime.Sc
 
 	return nil
 }
+
+// reconcileDatabaseGrantPrivileges updates the privileges of the grant of a database user
+// the host and the user of a grant can't be changed
+func reconcileDatabaseGrantPrivileges(ctx context.Context, r client.Client, mariaDBRef types.NamespacedName, username string, privileges []string) error {
+	grant := &mariadbv1alpha1.Grant{}
+	if err := r.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("grant-%s", username), Namespace: mariaDBRef.Namespace}, grant); err != nil {
+		// a missing grant is created together with its user
+		return client.IgnoreNotFound(err)
+	}
+
+	if slices.Equal(grant.Spec.Privileges, privileges) {
+		return nil
+	}
+
+	grant.Spec.Privileges = privileges
+	if err := r.Update(ctx, grant); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update privileges of MySQL grant", "name", grant.Name)
+		return err
+	}
+
+	return nil
+}
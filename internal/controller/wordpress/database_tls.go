@@ -0,0 +1,175 @@
+package wordpress
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+const (
+	// DatabaseCAKey is the key of the CA certificates in the secret of spec.database.caBundleSecretRef
+	DatabaseCAKey = "ca.crt"
+
+	DatabaseCAVolumeName = "database-ca"
+	databaseCAMountPath  = "/etc/kubepress/database-ca"
+
+	// systemCABundle is the CA bundle of the Debian based WordPress images, used if the site has no CA bundle
+	systemCABundle = "/etc/ssl/certs/ca-certificates.crt"
+
+	// databaseTLSDropInMarker marks the db.php drop-in written by the init container
+	databaseTLSDropInMarker = "kubepress-database-tls"
+)
+
+// databaseTLSDropIn replaces the database connection of WordPress with one that verifies the certificate of the server,
+// wpdb only passes MYSQL_CLIENT_FLAGS to mysqli and can't be given a CA
+const databaseTLSDropIn = `<?php
+// ` + databaseTLSDropInMarker + `: written by KubePress to verify the certificate of the database server,
+// it is replaced on every start of a pod, remove this line to keep a modified copy
+class KubePress_TLS_wpdb extends wpdb {
+	public function db_connect( $allow_bail = true ) {
+		$this->is_mysql = true;
+		mysqli_report( MYSQLI_REPORT_OFF );
+
+		$this->dbh = mysqli_init();
+		mysqli_ssl_set( $this->dbh, null, null, KUBEPRESS_DB_SSL_CA, null, null );
+		mysqli_options( $this->dbh, MYSQLI_OPT_SSL_VERIFY_SERVER_CERT, true );
+
+		$host_data = $this->parse_db_host( $this->dbhost );
+		list( $host, $port, $socket, $is_ipv6 ) = $host_data ? $host_data : array( $this->dbhost, null, null, false );
+		if ( $is_ipv6 && extension_loaded( 'mysqlnd' ) ) {
+			$host = "[$host]";
+		}
+
+		$flags = defined( 'MYSQL_CLIENT_FLAGS' ) ? MYSQL_CLIENT_FLAGS : MYSQLI_CLIENT_SSL;
+		if ( ! @mysqli_real_connect( $this->dbh, $host, $this->dbuser, $this->dbpassword, null, $port, $socket, $flags ) ) {
+			$this->dbh = null;
+			if ( $allow_bail ) {
+				wp_load_translations_early();
+				$this->bail( '<h1>Error establishing a secure database connection</h1>', 'db_connect_fail' );
+			}
+			return false;
+		}
+
+		$this->has_connected = true;
+		$this->set_charset( $this->dbh );
+		$this->ready = true;
+		$this->set_sql_mode();
+		$this->select( $this->dbname, $this->dbh );
+
+		return true;
+	}
+}
+
+$wpdb = new KubePress_TLS_wpdb( DB_USER, DB_PASSWORD, DB_NAME, DB_HOST );
+`
+
+// databaseTLSScript configures the TLS connection to the database in wp-config.php, it is part of the init script
+// REQUIRED only encrypts, the verifying modes install the drop-in unless a plugin brought its own db.php
+const databaseTLSScript = `
+DROPIN=/var/www/html/wp-content/db.php
+case "$WORDPRESS_DB_SSL_MODE" in
+	REQUIRED) DB_CLIENT_FLAGS="MYSQLI_CLIENT_SSL | MYSQLI_CLIENT_SSL_DONT_VERIFY_SERVER_CERT" ;;
+	VERIFY_CA|VERIFY_IDENTITY) DB_CLIENT_FLAGS="MYSQLI_CLIENT_SSL" ;;
+	*) DB_CLIENT_FLAGS="" ;;
+esac
+
+if [ -n "$DB_CLIENT_FLAGS" ]; then
+	/tmp/wp-cli config set MYSQL_CLIENT_FLAGS "$DB_CLIENT_FLAGS" --raw --path="/var/www/html/" --allow-root
+elif /tmp/wp-cli config has MYSQL_CLIENT_FLAGS --path="/var/www/html/" --allow-root 2>/dev/null; then
+	/tmp/wp-cli config delete MYSQL_CLIENT_FLAGS --path="/var/www/html/" --allow-root
+fi
+
+if [ "$DB_CLIENT_FLAGS" = "MYSQLI_CLIENT_SSL" ]; then
+	/tmp/wp-cli config set KUBEPRESS_DB_SSL_CA "$WORDPRESS_DB_SSL_CA" --path="/var/www/html/" --allow-root
+	if [ ! -f "$DROPIN" ] || grep -q ` + databaseTLSDropInMarker + ` "$DROPIN"; then
+		cat > "$DROPIN" <<'PHP'
+` + databaseTLSDropIn + `PHP
+	else
+		echo "WARNING: wp-content/db.php belongs to a plugin, the certificate of the database is not verified"
+	fi
+elif [ -f "$DROPIN" ] && grep -q ` + databaseTLSDropInMarker + ` "$DROPIN"; then
+	rm "$DROPIN"
+fi
+`
+
+// databaseClientTLSScript defines db_tls_options, which prints the options of the MariaDB client for an SSL mode and a CA bundle
+// the verifying modes check the host name like PHP does, without a mode the defaults of the client apply
+const databaseClientTLSScript = `
+db_tls_options() {
+	case "$1" in
+		REQUIRED) echo "--ssl --skip-ssl-verify-server-cert" ;;
+		VERIFY_CA|VERIFY_IDENTITY) echo "--ssl --ssl-ca=$2 --ssl-verify-server-cert" ;;
+	esac
+}
+`
+
+// getDatabaseTLSEnv returns the environment variables with the CA bundle the database certificate is verified with
+func getDatabaseTLSEnv(wp *crmv1.WordPressSite) []corev1.EnvVar {
+	caBundle := systemCABundle
+	if wp.Spec.Database.CABundleSecretRef != "" {
+		caBundle = databaseCAMountPath + "/" + DatabaseCAKey
+	}
+
+	return []corev1.EnvVar{
+		{Name: "WORDPRESS_DB_SSL_CA", Value: caBundle},
+	}
+}
+
+// setDatabaseCAVolume mounts the CA bundle of spec.database.caBundleSecretRef into all containers of the pod,
+// or removes it if the site has none
+// returns true if the pod changed
+func setDatabaseCAVolume(spec *corev1.PodSpec, wp *crmv1.WordPressSite) bool {
+	changed := false
+	secretName := wp.Spec.Database.CABundleSecretRef
+
+	index := slices.IndexFunc(spec.Volumes, func(v corev1.Volume) bool { return v.Name == DatabaseCAVolumeName })
+	switch {
+	case secretName == "" && index >= 0:
+		spec.Volumes = slices.Delete(spec.Volumes, index, index+1)
+		changed = true
+	case secretName != "" && index < 0:
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name: DatabaseCAVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: secretName},
+			},
+		})
+		changed = true
+	case secretName != "" && (spec.Volumes[index].Secret == nil || spec.Volumes[index].Secret.SecretName != secretName):
+		spec.Volumes[index].VolumeSource = corev1.VolumeSource{
+			Secret: &corev1.SecretVolumeSource{SecretName: secretName},
+		}
+		changed = true
+	}
+
+	setMount := func(container *corev1.Container) {
+		// the wp-cli container only copies wp-cli
+		if container.Name == WPCliContainer {
+			return
+		}
+
+		index := slices.IndexFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == DatabaseCAVolumeName })
+		switch {
+		case secretName == "" && index >= 0:
+			container.VolumeMounts = slices.Delete(container.VolumeMounts, index, index+1)
+			changed = true
+		case secretName != "" && index < 0:
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      DatabaseCAVolumeName,
+				MountPath: databaseCAMountPath,
+				ReadOnly:  true,
+			})
+			changed = true
+		}
+	}
+	for i := range spec.InitContainers {
+		setMount(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		setMount(&spec.Containers[i])
+	}
+
+	return changed
+}
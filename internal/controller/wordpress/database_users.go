@@ -0,0 +1,247 @@
+package wordpress
+
+import (
+	"context"
+	"fmt"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+// ReadOnlyUserLabel is the name of the read-only user in spec.database.readOnlyUsers an object belongs to
+const ReadOnlyUserLabel = "hostzero.com/readonly-user"
+
+// ReconcileReadOnlyUsers creates the read-only database users declared by the site and removes the ones no longer declared
+// returns false while removed users are still being deleted, they are deleted one object after another
+func ReconcileReadOnlyUsers(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "database-readonly-users")
+
+	if !wp.Spec.Database.CreateNew {
+		return true, nil
+	}
+
+	mariaDBRef := GetMariaDBRef(wp)
+
+	declared := map[string]bool{}
+	for _, user := range wp.Spec.Database.ReadOnlyUsers {
+		declared[user.Name] = true
+
+		if err := reconcileReadOnlyUser(ctx, r, scheme, wp, mariaDBRef, user.Name); err != nil {
+			logger.Error(err, "Failed to reconcile read-only user", "name", user.Name)
+			return false, err
+		}
+	}
+
+	objects, err := getReadOnlyUserObjects(ctx, r, wp)
+	if err != nil {
+		logger.Error(err, "Failed to get read-only user objects")
+		return false, err
+	}
+
+	removed := []client.Object{}
+	for _, obj := range objects {
+		if !declared[obj.GetLabels()[ReadOnlyUserLabel]] {
+			removed = append(removed, obj)
+		}
+	}
+
+	done, err := deleteDatabaseObjects(ctx, r, removed)
+	if err != nil {
+		logger.Error(err, "Failed to remove read-only users")
+		return false, err
+	}
+
+	return done, nil
+}
+
+// reconcileReadOnlyUser creates the secret, the user and the SELECT grant of a read-only user
+func reconcileReadOnlyUser(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite, mariaDBRef types.NamespacedName, name string) error {
+	labels := GetDatabaseLabels(wp, map[string]string{
+		"app.kubernetes.io/name": "mariadb-readonly-user",
+		ReadOnlyUserLabel:        name,
+	})
+
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: GetReadOnlyUserSecretName(wp.Name, name), Namespace: wp.Namespace}, secret)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+
+		// the suffix keeps the username unique in clusters shared by many sites
+		suffix, err := GenerateRandomString(6)
+		if err != nil {
+			return err
+		}
+		password, err := GenerateRandomString(30)
+		if err != nil {
+			return err
+		}
+
+		secret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetReadOnlyUserSecretName(wp.Name, name),
+				Namespace: wp.Namespace,
+				Labels:    labels,
+			},
+			Data: map[string][]byte{
+				"databaseUsername": []byte(fmt.Sprintf("%s-ro-%s", name, suffix)),
+				"databasePassword": []byte(password),
+				"database":         []byte(GetDatabaseResourceName(wp, mariaDBRef)),
+				"databaseHost":     []byte(GetMariaDBHost(mariaDBRef)),
+			},
+		}
+
+		if err := controllerutil.SetControllerReference(wp, secret, scheme); err != nil {
+			return err
+		}
+
+		if err := r.Create(ctx, secret); err != nil {
+			return err
+		}
+	}
+
+	username := string(secret.Data["databaseUsername"])
+
+	// the user reads its password from the secret, or from a copy if the cluster lives in another namespace
+	passwordSecretName := secret.Name
+	if mariaDBRef.Namespace != wp.Namespace {
+		if err := reconcileDatabaseUserSecret(ctx, r, wp, mariaDBRef, username, secret); err != nil {
+			return err
+		}
+		passwordSecretName = GetDatabaseUserSecretName(username)
+	}
+
+	err = r.Get(ctx, types.NamespacedName{Name: username, Namespace: mariaDBRef.Namespace}, &mariadbv1alpha1.User{})
+	if errors.IsNotFound(err) {
+		user := &mariadbv1alpha1.User{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      username,
+				Namespace: mariaDBRef.Namespace,
+				Labels:    labels,
+			},
+			Spec: mariadbv1alpha1.UserSpec{
+				MariaDBRef: mariadbv1alpha1.MariaDBRef{
+					ObjectReference: mariadbv1alpha1.ObjectReference{
+						Name:      mariaDBRef.Name,
+						Namespace: mariaDBRef.Namespace,
+					},
+				},
+				Host: config.AppConfig.DatabaseUserHost,
+				PasswordSecretKeyRef: &mariadbv1alpha1.SecretKeySelector{
+					LocalObjectReference: mariadbv1alpha1.LocalObjectReference{
+						Name: passwordSecretName,
+					},
+					Key: "databasePassword",
+				},
+			},
+		}
+
+		if err := setDatabaseOwnerReference(wp, user, scheme); err != nil {
+			return err
+		}
+
+		if err := r.Create(ctx, user); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	grantName := fmt.Sprintf("grant-%s", username)
+	err = r.Get(ctx, types.NamespacedName{Name: grantName, Namespace: mariaDBRef.Namespace}, &mariadbv1alpha1.Grant{})
+	if errors.IsNotFound(err) {
+		host := config.AppConfig.DatabaseUserHost
+		grant := &mariadbv1alpha1.Grant{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      grantName,
+				Namespace: mariaDBRef.Namespace,
+				Labels:    labels,
+			},
+			Spec: mariadbv1alpha1.GrantSpec{
+				MariaDBRef: mariadbv1alpha1.MariaDBRef{
+					ObjectReference: mariadbv1alpha1.ObjectReference{
+						Name:      mariaDBRef.Name,
+						Namespace: mariaDBRef.Namespace,
+					},
+				},
+				Database:   string(secret.Data["database"]),
+				Username:   username,
+				Privileges: []string{"SELECT"},
+				Table:      "*",
+				Host:       &host,
+			},
+		}
+
+		if err := setDatabaseOwnerReference(wp, grant, scheme); err != nil {
+			return err
+		}
+
+		if err := r.Create(ctx, grant); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// getReadOnlyUserObjects returns the grants, users and secrets of all read-only users of the site
+// the grants have to be removed before the users, the users before their secrets
+func getReadOnlyUserObjects(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) ([]client.Object, error) {
+	mariaDBRef := GetMariaDBRef(wp)
+	selector := []client.ListOption{
+		client.MatchingLabels{"hostzero.com/resource-uid": string(wp.GetUID())},
+		client.HasLabels{ReadOnlyUserLabel},
+	}
+
+	grants := &mariadbv1alpha1.GrantList{}
+	if err := r.List(ctx, grants, append(selector, client.InNamespace(mariaDBRef.Namespace))...); err != nil {
+		return nil, err
+	}
+
+	users := &mariadbv1alpha1.UserList{}
+	if err := r.List(ctx, users, append(selector, client.InNamespace(mariaDBRef.Namespace))...); err != nil {
+		return nil, err
+	}
+
+	secrets := &corev1.SecretList{}
+	if err := r.List(ctx, secrets, append(selector, client.InNamespace(wp.Namespace))...); err != nil {
+		return nil, err
+	}
+
+	// copies of the passwords next to a cluster in another namespace
+	copies := &corev1.SecretList{}
+	if mariaDBRef.Namespace != wp.Namespace {
+		if err := r.List(ctx, copies, append(selector, client.InNamespace(mariaDBRef.Namespace))...); err != nil {
+			return nil, err
+		}
+	}
+
+	objects := []client.Object{}
+	for i := range grants.Items {
+		objects = append(objects, &grants.Items[i])
+	}
+	for i := range users.Items {
+		objects = append(objects, &users.Items[i])
+	}
+	for i := range copies.Items {
+		objects = append(objects, &copies.Items[i])
+	}
+	for i := range secrets.Items {
+		objects = append(objects, &secrets.Items[i])
+	}
+
+	return objects, nil
+}
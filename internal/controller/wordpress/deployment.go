@@ -7,20 +7,105 @@ import (
 	crmv1 "hostzero.de/m/v2/api/v1"
 	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"slices"
+	"time"
 )
 
 const (
 	DefaultVolumeName = "wordpress-central-data"
 )
 
+// initScript installs WordPress on the volume if needed and configures it, it runs in the init container of every pod
+const initScript = `#!/bin/bash
+set -e
+
+# Ensure we're running as www-data user
+#[ "$(id -u)" != "33" ] && { echo "ERROR: Must run as www-data user (uid 33)"; exit 1; }
+
+# Check volume accessibility
+#[ ! -d "/var/www/html" ] && { echo "ERROR: /var/www/html directory does not exist"; exit 1; }
+#touch /var/www/html/.test-write 2>/dev/null || { echo "ERROR: Cannot write to /var/www/html"; exit 1; }
+#rm -f /var/www/html/.test-write
+
+` + wpCliSetupScript + `
+if [ ! -f /var/www/html/index.php ]; then
+	if [ "$WORDPRESS_CORE_SOURCE" = "Image" ]; then
+		# the official WordPress images ship the core files, so no internet access is needed
+		[ -f /usr/src/wordpress/index.php ] || { echo "ERROR: the image has no WordPress core files in /usr/src/wordpress"; exit 1; }
+		echo "Copying WordPress core files from the image..."
+		cp -a /usr/src/wordpress/. /var/www/html/
+	else
+		echo "Downloading WordPress core files..."
+		/tmp/wp-cli core download --path="/var/www/html/" --locale=en_US ${WORDPRESS_CORE_VERSION:+--version="$WORDPRESS_CORE_VERSION"} --allow-root
+	fi
+fi
+
+# Create wp-config.php if it doesn't exist
+if [ ! -f /var/www/html/wp-config.php ]; then
+	echo "Creating wp-config.php..."
+	/tmp/wp-cli config create --path="/var/www/html/" \
+		--dbhost="$WORDPRESS_DB_HOST${WORDPRESS_DB_PORT:+:$WORDPRESS_DB_PORT}" \
+		--dbname="$WORDPRESS_DB_NAME" \
+		--dbuser="$WORDPRESS_DB_USER" \
+		--dbpass="$WORDPRESS_DB_PASSWORD" \
+    	--allow-root \
+		--extra-php <<PHP
+define('FS_METHOD', 'direct');
+define('WP_MEMORY_LIMIT', '256M');
+PHP
+
+	# add TLS workaround if behind a proxy
+	sed -i '2 i define('\''FORCE_SSL_ADMIN'\'', true); if ($_SERVER["HTTP_X_FORWARDED_PROTO"] == "https") $_SERVER["HTTPS"]="on";' /var/www/html/wp-config.php
+fi
+
+# Keep the database connection in sync with the secret, the password changes when it is rotated
+# and the whole connection when the database is migrated into the managed cluster
+/tmp/wp-cli config set DB_HOST "$WORDPRESS_DB_HOST${WORDPRESS_DB_PORT:+:$WORDPRESS_DB_PORT}" --path="/var/www/html/" --allow-root
+/tmp/wp-cli config set DB_NAME "$WORDPRESS_DB_NAME" --path="/var/www/html/" --allow-root
+/tmp/wp-cli config set DB_USER "$WORDPRESS_DB_USER" --path="/var/www/html/" --allow-root
+/tmp/wp-cli config set DB_PASSWORD "$WORDPRESS_DB_PASSWORD" --path="/var/www/html/" --allow-root
+` + databaseTLSScript + `
+
+# Set the WP Memory Limit correctly
+/tmp/wp-cli config set WP_MEMORY_LIMIT "$WORDPRESS_MEMORY_LIMIT" --path="/var/www/html/" --allow-root
+
+# WP-Cron is disabled on page loads while a CronJob runs the scheduled events
+if [ "$WORDPRESS_DISABLE_CRON" = "true" ]; then
+	/tmp/wp-cli config set DISABLE_WP_CRON true --raw --path="/var/www/html/" --allow-root
+elif /tmp/wp-cli config has DISABLE_WP_CRON --path="/var/www/html/" --allow-root 2>/dev/null; then
+	/tmp/wp-cli config delete DISABLE_WP_CRON --path="/var/www/html/" --allow-root
+fi
+
+# Install WordPress if not already installed
+if ! /tmp/wp-cli core is-installed --path="/var/www/html/" --quiet 2>/dev/null; then
+	# the table prefix, charset and collation can change until WordPress is installed
+	/tmp/wp-cli config set table_prefix "$WORDPRESS_TABLE_PREFIX" --type=variable --path="/var/www/html/" --allow-root
+	/tmp/wp-cli config set DB_CHARSET "$WORDPRESS_DB_CHARSET" --path="/var/www/html/" --allow-root
+	/tmp/wp-cli config set DB_COLLATE "$WORDPRESS_DB_COLLATE" --path="/var/www/html/" --allow-root
+
+	/tmp/wp-cli core install \
+		--path="/var/www/html/" \
+		--url="$WORDPRESS_URL" \
+		--title="$WORDPRESS_TITLE" \
+		--admin_user="$WORDPRESS_ADMIN_USER" \
+		--admin_password="$WORDPRESS_ADMIN_PASSWORD" \
+		--admin_email="$WORDPRESS_ADMIN_EMAIL" \
+		--skip-email \
+		--allow-root
+fi
+
+# Set proper ownership and permissions
+chown -R 33:33 /var/www/html
+`
+
 // ReconcileDeployment creates or updates the Deployment for WordPress
 func ReconcileDeployment(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) error {
 	logger := log.FromContext(ctx).WithValues("component", "ingress")
@@ -29,19 +114,24 @@ func ReconcileDeployment(ctx context.Context, r client.Client, scheme *runtime.S
 
 	deploymentName := GetResourceName(wp.Name)
 
+	// resources of the site with the defaults applied, WP_MEMORY_LIMIT follows the memory limit
+	effectiveResources, err := GetEffectiveResources(ctx, r, wp)
+	if err != nil {
+		logger.Error(err, "Failed to resolve resources")
+		return err
+	}
+	memoryLimit := effectiveResources.PHPMemoryLimit()
+
 	// Check if deployment exists
 	deployment := &appsv1.Deployment{}
-	err := r.Get(ctx, types.NamespacedName{Name: deploymentName, Namespace: wp.Namespace}, deployment)
+	err = r.Get(ctx, types.NamespacedName{Name: deploymentName, Namespace: wp.Namespace}, deployment)
 
 	if errors.IsNotFound(err) {
 		// Create new deployment
 		// check if MySQL secret exists
 		mySQLSecretName := wp.Spec.AdminUserSecretKeyRef
 
-		replicas := int32(1)
-		if wp.Spec.WordPress.Replicas > 0 {
-			replicas = wp.Spec.WordPress.Replicas
-		}
+		replicas := GetDesiredReplicas(wp)
 
 		labels := GetWordpressLabels(wp, map[string]string{
 			"app.kubernetes.io/name": "wordpress-server",
@@ -85,13 +175,6 @@ func ReconcileDeployment(ctx context.Context, r client.Client, scheme *runtime.S
 			},
 		}
 
-		// convert memory limit from Go format to PHP format
-		memoryLimit, err := GoMemoryToPHPMemory(wp.Spec.WordPress.Resources.MemoryLimit)
-		if err != nil {
-			logger.Error(err, "Failed to convert memory limit", "value", wp.Spec.WordPress.Resources.MemoryLimit)
-			return err
-		}
-
 		// Add initContainer for WordPress
 		// Init Container is the best solution to ensure WordPress is properly installed
 		// PostStart hooks don't allow logging and are not suitable for complex initialization
@@ -116,79 +199,19 @@ func ReconcileDeployment(ctx context.Context, r client.Client, scheme *runtime.S
 			//		Add:  []corev1.Capability{"CHOWN", "SETUID", "SETGID"}, // Minimal capabilities
 			//	},
 			//},
-			Command: []string{"sh", "-c", `#!/bin/bash
-set -e
-
-# Ensure we're running as www-data user
-#[ "$(id -u)" != "33" ] && { echo "ERROR: Must run as www-data user (uid 33)"; exit 1; }
-
-# Check volume accessibility
-#[ ! -d "/var/www/html" ] && { echo "ERROR: /var/www/html directory does not exist"; exit 1; }
-#touch /var/www/html/.test-write 2>/dev/null || { echo "ERROR: Cannot write to /var/www/html"; exit 1; }
-#rm -f /var/www/html/.test-write
-
-# Ensure wp-cli is installed
-if [ ! -f /tmp/wp-cli ]; then
-	curl -s -O https://raw.githubusercontent.com/wp-cli/builds/gh-pages/phar/wp-cli.phar >/dev/null 2>&1
-	chmod +x wp-cli.phar >/dev/null 2>&1
-	mv wp-cli.phar /tmp/wp-cli
-fi
-
-if [ ! -f /var/www/html/index.php ]; then
-	echo "Downloading WordPress core files..."
-	/tmp/wp-cli core download --path="/var/www/html/" --locale=en_US --allow-root
-fi
-
-# Create wp-config.php if it doesn't exist
-if [ ! -f /var/www/html/wp-config.php ]; then
-	echo "Creating wp-config.php..."
-	/tmp/wp-cli config create --path="/var/www/html/" \
-		--dbhost="$WORDPRESS_DB_HOST" \
-		--dbname="$WORDPRESS_DB_NAME" \
-		--dbuser="$WORDPRESS_DB_USER" \
-		--dbpass="$WORDPRESS_DB_PASSWORD" \
-    	--allow-root \
-		--extra-php <<PHP
-define('FS_METHOD', 'direct');
-define('WP_MEMORY_LIMIT', '256M');
-PHP
-
-	# add TLS workaround if behind a proxy
-	sed -i '2 i define('\''FORCE_SSL_ADMIN'\'', true); if ($_SERVER["HTTP_X_FORWARDED_PROTO"] == "https") $_SERVER["HTTPS"]="on";' /var/www/html/wp-config.php
-fi
-
-# Set the WP Memory Limit correctly
-/tmp/wp-cli config set WP_MEMORY_LIMIT "$WORDPRESS_MEMORY_LIMIT" --path="/var/www/html/" --allow-root
-
-# Install WordPress if not already installed
-if ! /tmp/wp-cli core is-installed --path="/var/www/html/" --quiet 2>/dev/null; then
-	/tmp/wp-cli core install \
-		--path="/var/www/html/" \
-		--url="$WORDPRESS_URL" \
-		--title="$WORDPRESS_TITLE" \
-		--admin_user="$WORDPRESS_ADMIN_USER" \
-		--admin_password="$WORDPRESS_ADMIN_PASSWORD" \
-		--admin_email="$WORDPRESS_ADMIN_EMAIL" \
-		--skip-email \
-		--allow-root
-fi
-
-# Set proper ownership and permissions
-chown -R 33:33 /var/www/html
-`},
+			Command:      []string{"sh", "-c", initScript},
 			VolumeMounts: volumeMounts, // share volumes with main container if needed
-			Env: []corev1.EnvVar{
-				{Name: "WORDPRESS_DB_HOST", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "databaseHost"}}},
-				{Name: "WORDPRESS_DB_NAME", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "database"}}},
-				{Name: "WORDPRESS_DB_USER", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "databaseUsername"}}},
-				{Name: "WORDPRESS_DB_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "databasePassword"}}},
-				{Name: "WORDPRESS_URL", Value: getSiteUrl(wp)},
-				{Name: "WORDPRESS_TITLE", Value: wp.Spec.SiteTitle},
-				{Name: "WORDPRESS_ADMIN_USER", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "username"}}},
-				{Name: "WORDPRESS_ADMIN_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "password"}}},
-				{Name: "WORDPRESS_ADMIN_EMAIL", Value: wp.Spec.AdminEmail},
-				{Name: "WORDPRESS_MEMORY_LIMIT", Value: memoryLimit},
-			},
+			Env: append(append(append(append(getDatabaseEnv(wp), getDatabaseTLSEnv(wp)...), getDatabaseSettingsEnv(wp)...),
+				corev1.EnvVar{Name: "WORDPRESS_URL", Value: GetSiteUrl(wp)},
+				corev1.EnvVar{Name: "WORDPRESS_TITLE", Value: wp.Spec.SiteTitle},
+				corev1.EnvVar{Name: "WORDPRESS_ADMIN_USER", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "username"}}},
+				corev1.EnvVar{Name: "WORDPRESS_ADMIN_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "password"}}},
+				corev1.EnvVar{Name: "WORDPRESS_ADMIN_EMAIL", Value: wp.Spec.AdminEmail},
+				corev1.EnvVar{Name: "WORDPRESS_MEMORY_LIMIT", Value: memoryLimit},
+				// only used for the download on the first start, later versions are installed by the core update job
+				corev1.EnvVar{Name: "WORDPRESS_CORE_VERSION", Value: wp.Spec.WordPress.CoreVersion},
+				corev1.EnvVar{Name: "WORDPRESS_CORE_SOURCE", Value: GetCoreSource(wp)},
+			), getCronEnv(wp)...),
 		}
 
 		// Create Pod specification
@@ -227,36 +250,16 @@ chown -R 33:33 /var/www/html
 					//		Add:  []corev1.Capability{"CHOWN", "SETUID", "SETGID"}, // Minimal capabilities
 					//	},
 					//},
-					Env: []corev1.EnvVar{
-						{
-							Name:      "WORDPRESS_DB_HOST",
-							ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "databaseHost"}},
-						},
-						{
-							Name:      "WORDPRESS_DB_NAME",
-							ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "database"}},
-						},
-						{
-							Name:      "WORDPRESS_DB_USER",
-							ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "databaseUsername"}},
-						},
-						{
-							Name:      "WORDPRESS_DB_PASSWORD",
-							ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: mySQLSecretName}, Key: "databasePassword"}},
-						},
-						{
-							Name:  "WORDPRESS_TABLE_PREFIX",
-							Value: "wp_",
-						},
-						{
+					Env: append(append(append(getDatabaseEnv(wp), getDatabaseTLSEnv(wp)...), getDatabaseSettingsEnv(wp)...),
+						corev1.EnvVar{
 							Name:  "APACHE_RUN_USER",
 							Value: "www-data",
 						},
-						{
+						corev1.EnvVar{
 							Name:  "APACHE_RUN_GROUP",
 							Value: "www-data",
 						},
-					},
+					),
 					Ports: []corev1.ContainerPort{
 						{
 							Name:          "http",
@@ -264,20 +267,13 @@ chown -R 33:33 /var/www/html
 						},
 					},
 					VolumeMounts: volumeMounts,
-					Resources: corev1.ResourceRequirements{
-						Requests: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse(wp.Spec.WordPress.Resources.CPURequest),
-							corev1.ResourceMemory: resource.MustParse(wp.Spec.WordPress.Resources.MemoryRequest),
-						},
-						Limits: corev1.ResourceList{
-							corev1.ResourceCPU:    resource.MustParse(wp.Spec.WordPress.Resources.CPULimit),
-							corev1.ResourceMemory: resource.MustParse(wp.Spec.WordPress.Resources.MemoryLimit),
-						},
-					},
+					Resources:    effectiveResources.ResourceRequirements(),
 				},
 			},
 			Volumes: volumes,
 		}
+		setDatabaseCAVolume(&podSpec, wp)
+		setWPCliVolume(&podSpec, wp)
 
 		// Create the deployment
 		deployment = &appsv1.Deployment{
@@ -293,7 +289,8 @@ chown -R 33:33 /var/www/html
 				},
 				Template: corev1.PodTemplateSpec{
 					ObjectMeta: metav1.ObjectMeta{
-						Labels: labels,
+						Labels:      labels,
+						Annotations: getPodAnnotations(wp),
 					},
 					Spec: podSpec,
 				},
@@ -318,6 +315,13 @@ chown -R 33:33 /var/www/html
 		// Update existing deployment if needed
 		updateNeeded := false
 
+		// the toolbox image can be added, changed or removed at any time, it moves the init container
+		if setWPCliVolume(&deployment.Spec.Template.Spec, wp) {
+			updateNeeded = true
+		}
+		initIndex := slices.IndexFunc(deployment.Spec.Template.Spec.InitContainers, func(c corev1.Container) bool { return c.Name == "init" })
+		initContainer := &deployment.Spec.Template.Spec.InitContainers[initIndex]
+
 		// Check if image needs to be updated
 		if deployment.Spec.Template.Spec.Containers[0].Image != wp.Spec.WordPress.Image {
 			deployment.Spec.Template.Spec.Containers[0].Image = wp.Spec.WordPress.Image
@@ -325,8 +329,9 @@ chown -R 33:33 /var/www/html
 		}
 
 		// Check if replicas need to be updated
-		if *deployment.Spec.Replicas != wp.Spec.WordPress.Replicas {
-			deployment.Spec.Replicas = &wp.Spec.WordPress.Replicas
+		replicas := GetDesiredReplicas(wp)
+		if *deployment.Spec.Replicas != replicas {
+			deployment.Spec.Replicas = &replicas
 			updateNeeded = true
 		}
 
@@ -338,35 +343,67 @@ chown -R 33:33 /var/www/html
 		}
 
 		// Check if resource requests/limits need to be updated
-		resources := corev1.ResourceRequirements{
-			Requests: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse(wp.Spec.WordPress.Resources.CPURequest),
-				corev1.ResourceMemory: resource.MustParse(wp.Spec.WordPress.Resources.MemoryRequest),
-			},
-			Limits: corev1.ResourceList{
-				corev1.ResourceCPU:    resource.MustParse(wp.Spec.WordPress.Resources.CPULimit),
-				corev1.ResourceMemory: resource.MustParse(wp.Spec.WordPress.Resources.MemoryLimit),
-			},
-		}
+		resources := effectiveResources.ResourceRequirements()
 
 		if !resourcesEqual(deployment.Spec.Template.Spec.Containers[0].Resources, resources) {
 			deployment.Spec.Template.Spec.Containers[0].Resources = resources
 			updateNeeded = true
 		}
 
-		// convert memory limit from Go format to PHP format
-		memoryLimit, err := GoMemoryToPHPMemory(wp.Spec.WordPress.Resources.MemoryLimit)
-		if err != nil {
-			logger.Error(err, "Failed to convert memory limit", "value", wp.Spec.WordPress.Resources.MemoryLimit)
-			return err
+		// the database connection details moved from the admin secret into the database secret
+		if setEnvVars(initContainer, getDatabaseEnv(wp)) {
+			updateNeeded = true
+		}
+		if setEnvVars(&deployment.Spec.Template.Spec.Containers[0], getDatabaseEnv(wp)) {
+			updateNeeded = true
+		}
+
+		// the CA bundle of the database can be added, changed or removed at any time
+		if setEnvVars(initContainer, getDatabaseTLSEnv(wp)) {
+			updateNeeded = true
+		}
+		if setEnvVars(&deployment.Spec.Template.Spec.Containers[0], getDatabaseTLSEnv(wp)) {
+			updateNeeded = true
+		}
+		if setDatabaseCAVolume(&deployment.Spec.Template.Spec, wp) {
+			updateNeeded = true
+		}
+
+		// the database settings only reach wp-config.php until WordPress is installed, afterwards they can't change
+		if setEnvVars(initContainer, getDatabaseSettingsEnv(wp)) {
+			updateNeeded = true
+		}
+		if setEnvVars(&deployment.Spec.Template.Spec.Containers[0], getDatabaseSettingsEnv(wp)) {
+			updateNeeded = true
+		}
+
+		// WP-Cron can be moved to a CronJob and back at any time
+		if setEnvVars(initContainer, getCronEnv(wp)) {
+			updateNeeded = true
+		}
+
+		// pods of older versions of the operator don't keep wp-config.php in sync with the secret
+		initCommand := []string{"sh", "-c", initScript}
+		if !slices.Equal(initContainer.Command, initCommand) {
+			initContainer.Command = initCommand
+			updateNeeded = true
+		}
+
+		// roll the pods after the database password was rotated
+		if rotated, ok := getPodAnnotations(wp)[DatabasePasswordRotatedAnnotation]; ok && deployment.Spec.Template.Annotations[DatabasePasswordRotatedAnnotation] != rotated {
+			if deployment.Spec.Template.Annotations == nil {
+				deployment.Spec.Template.Annotations = map[string]string{}
+			}
+			deployment.Spec.Template.Annotations[DatabasePasswordRotatedAnnotation] = rotated
+			updateNeeded = true
 		}
 
 		// check if init container has the correct memory limit env var
-		if deployment.Spec.Template.Spec.InitContainers[0].Env != nil {
-			for i, env := range deployment.Spec.Template.Spec.InitContainers[0].Env {
+		if initContainer.Env != nil {
+			for i, env := range initContainer.Env {
 				if env.Name == "WORDPRESS_MEMORY_LIMIT" {
 					if env.Value != memoryLimit {
-						deployment.Spec.Template.Spec.InitContainers[0].Env[i].Value = memoryLimit
+						initContainer.Env[i].Value = memoryLimit
 						updateNeeded = true
 					}
 					break
@@ -374,7 +411,7 @@ chown -R 33:33 /var/www/html
 			}
 		} else {
 			// add the env var
-			deployment.Spec.Template.Spec.InitContainers[0].Env = []corev1.EnvVar{
+			initContainer.Env = []corev1.EnvVar{
 				{
 					Name:  "WORDPRESS_MEMORY_LIMIT",
 					Value: memoryLimit,
@@ -417,6 +454,26 @@ func resourcesEqual(requirements corev1.ResourceRequirements, actual corev1.Reso
 
 }
 
+// setEnvVars sets the environment variables of the container, replacing the ones with the same name
+// returns true if the container changed
+func setEnvVars(container *corev1.Container, envVars []corev1.EnvVar) bool {
+	changed := false
+
+	for _, env := range envVars {
+		index := slices.IndexFunc(container.Env, func(e corev1.EnvVar) bool { return e.Name == env.Name })
+		switch {
+		case index < 0:
+			container.Env = append(container.Env, env)
+			changed = true
+		case !equality.Semantic.DeepEqual(container.Env[index], env):
+			container.Env[index] = env
+			changed = true
+		}
+	}
+
+	return changed
+}
+
 // updateEnvVars updates environment variables in a deployment
 func updateEnvVars(deployment *appsv1.Deployment, envVars []crmv1.EnvVar, logger logr.Logger) bool {
 	changed := false
@@ -444,8 +501,75 @@ func updateEnvVars(deployment *appsv1.Deployment, envVars []crmv1.EnvVar, logger
 	return changed
 }
 
-// Helper functions to get values from the WordPress spec
-func getSiteUrl(wp *crmv1.WordPressSite) string {
+// getPodAnnotations returns the annotations of the WordPress pods
+func getPodAnnotations(wp *crmv1.WordPressSite) map[string]string {
+	annotations := map[string]string{}
+	if wp.Status.LastRotationTime != nil {
+		annotations[DatabasePasswordRotatedAnnotation] = wp.Status.LastRotationTime.UTC().Format(time.RFC3339)
+	}
+	return annotations
+}
+
+// GetDesiredReplicas returns the number of WordPress replicas, which is zero while a restore is running
+// or the database is copied into the managed cluster
+func GetDesiredReplicas(wp *crmv1.WordPressSite) int32 {
+	if wp.Annotations[RestoreInProgressAnnotation] != "" {
+		return 0
+	}
+
+	if IsMigratingDatabase(wp) && wp.Status.DatabaseMigration.Phase == crmv1.DatabaseMigrationPhaseImporting {
+		return 0
+	}
+
+	if wp.Spec.WordPress.Replicas > 0 {
+		return wp.Spec.WordPress.Replicas
+	}
+
+	return 1
+}
+
+// GetDatabaseConnectionSecretName returns the secret with the database connection details of the site,
+// the generated database secret or the admin secret for an existing database
+func GetDatabaseConnectionSecretName(wp *crmv1.WordPressSite) string {
+	if wp.Spec.Database.CreateNew {
+		return GetDatabaseSecretName(wp.Name)
+	}
+	return wp.Spec.AdminUserSecretKeyRef
+}
+
+// getDatabaseEnv returns the environment variables with the database connection details of the site
+func getDatabaseEnv(wp *crmv1.WordPressSite) []corev1.EnvVar {
+	return getDatabaseSecretEnv("WORDPRESS_DB", GetDatabaseConnectionSecretName(wp))
+}
+
+// getDatabaseSecretEnv returns the environment variables with the database connection details from the secret,
+// named with the prefix, e.g. WORDPRESS_DB_HOST
+func getDatabaseSecretEnv(prefix string, secretName string) []corev1.EnvVar {
+	return []corev1.EnvVar{
+		{Name: prefix + "_HOST", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "databaseHost"}}},
+		{Name: prefix + "_NAME", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "database"}}},
+		{Name: prefix + "_USER", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "databaseUsername"}}},
+		{Name: prefix + "_PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "databasePassword"}}},
+		// the port is optional, the scripts fall back to 3306
+		{Name: prefix + "_PORT", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "databasePort", Optional: &[]bool{true}[0]}}},
+		// the SSL mode is optional, without it the connection is not encrypted
+		{Name: prefix + "_SSL_MODE", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: secretName}, Key: "databaseSSLMode", Optional: &[]bool{true}[0]}}},
+	}
+}
+
+// getDatabaseSettingsEnv returns the environment variables with the table prefix, charset and collation of the site
+func getDatabaseSettingsEnv(wp *crmv1.WordPressSite) []corev1.EnvVar {
+	settings := wp.GetDatabaseSettings()
+
+	return []corev1.EnvVar{
+		{Name: "WORDPRESS_TABLE_PREFIX", Value: settings.TablePrefix},
+		{Name: "WORDPRESS_DB_CHARSET", Value: settings.Charset},
+		{Name: "WORDPRESS_DB_COLLATE", Value: settings.Collation},
+	}
+}
+
+// GetSiteUrl returns the public URL of the WordPress site
+func GetSiteUrl(wp *crmv1.WordPressSite) string {
 	if wp.Spec.Ingress != nil && wp.Spec.Ingress.Host != "" {
 		protocol := "http"
 		if wp.Spec.Ingress.TLS {
@@ -0,0 +1,337 @@
+package wordpress
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+const (
+	// ExtensionsHashAnnotation is set on the extensions job, it is the hash of the plugins and themes it installs
+	ExtensionsHashAnnotation = "crm.hostzero.de/extensions-hash"
+
+	// ExtensionsRecordedAnnotation marks extensions jobs whose result is already in the status of the site
+	ExtensionsRecordedAnnotation = "crm.hostzero.de/extensions-recorded"
+
+	ExtensionsContainer = "extensions"
+
+	extensionSourcesPath = "/extensions"
+)
+
+// ExtensionsResult is written by the extensions container as termination message
+// and picked up by the controller to fill the plugins and themes in the WordPressSite status
+type ExtensionsResult struct {
+	Plugins []crmv1.ExtensionStatus `json:"plugins"`
+	Themes  []crmv1.ExtensionStatus `json:"themes"`
+}
+
+// extensionsPlan is what the extensions container does, it is passed as JSON in WORDPRESS_EXTENSIONS
+type extensionsPlan struct {
+	Plugins []extensionsPlanItem `json:"plugins"`
+	Themes  []extensionsPlanItem `json:"themes"`
+}
+
+type extensionsPlanItem struct {
+	Slug    string `json:"slug"`
+	Version string `json:"version"`
+	// Source is the URL or the mounted path of the zip archive, empty for wordpress.org
+	Source string `json:"source"`
+	// Reinstall installs the archive again although the plugin or theme exists, the source changed
+	Reinstall bool `json:"reinstall"`
+	Activate  bool `json:"activate"`
+	Network   bool `json:"network"`
+	// Remove deletes the plugin or theme, it was dropped from the spec and prune is set
+	Remove bool `json:"remove"`
+}
+
+// the extensions container runs the plan with wp-cli, every plugin and theme is reconciled on its own,
+// so a failing one is reported without stopping the others
+// the result is written as termination message, errors are shortened to stay below its limit of 4096 bytes,
+// with many plugins and themes the errors and then the versions and states are left out until it fits
+const extensionsScript = `set -e
+` + wpCliSetupScript + `
+/tmp/wp-cli eval-file - --path=/var/www/html --allow-root --skip-plugins --skip-themes <<'PHP'
+<?php
+function kubepress_wp( $command ) {
+	$run = WP_CLI::runcommand( $command, array( 'return' => 'all', 'exit_error' => false, 'launch' => true ) );
+	if ( 0 !== $run->return_code ) {
+		$message = '' !== trim( $run->stderr ) ? $run->stderr : $run->stdout;
+		throw new Exception( substr( trim( preg_replace( '/^(Error|Warning): /m', '', $message ) ), 0, 120 ) );
+	}
+	return $run->stdout;
+}
+
+function kubepress_installed( $type ) {
+	$installed = array();
+	foreach ( json_decode( kubepress_wp( "$type list --fields=name,status,version --format=json" ), true ) as $item ) {
+		$installed[ $item['name'] ] = $item;
+	}
+	return $installed;
+}
+
+function kubepress_reconcile( $type, $item, $current ) {
+	$slug = escapeshellarg( $item['slug'] );
+
+	if ( $item['remove'] ) {
+		if ( null === $current ) {
+			return;
+		}
+		if ( 'plugin' === $type && 'inactive' !== $current['status'] ) {
+			kubepress_wp( "plugin deactivate $slug" . ( 'active-network' === $current['status'] ? ' --network' : '' ) );
+		}
+		kubepress_wp( "$type delete $slug" );
+		return;
+	}
+
+	if ( '' !== $item['source'] ) {
+		if ( null === $current || $item['reinstall'] ) {
+			kubepress_wp( "$type install " . escapeshellarg( $item['source'] ) . ' --force' );
+		}
+	} elseif ( null === $current ) {
+		kubepress_wp( "$type install $slug" . ( '' !== $item['version'] ? ' --version=' . escapeshellarg( $item['version'] ) : '' ) );
+	} elseif ( '' !== $item['version'] && $current['version'] !== $item['version'] ) {
+		kubepress_wp( "$type install $slug --force --version=" . escapeshellarg( $item['version'] ) );
+	}
+
+	// fails if the archive of a source contains another directory than the slug
+	$status = trim( kubepress_wp( "$type get $slug --field=status" ) );
+
+	if ( $item['network'] && ! is_multisite() ) {
+		throw new Exception( 'networkActivate requires a multisite' );
+	}
+
+	if ( 'theme' === $type ) {
+		if ( $item['network'] ) {
+			kubepress_wp( "theme enable $slug --network" );
+		}
+		if ( $item['activate'] && 'active' !== $status ) {
+			kubepress_wp( "theme activate $slug" );
+		}
+		return;
+	}
+
+	$wanted = $item['network'] ? 'active-network' : ( $item['activate'] ? 'active' : 'inactive' );
+	if ( $wanted === $status ) {
+		return;
+	}
+	if ( 'inactive' !== $status ) {
+		kubepress_wp( "plugin deactivate $slug" . ( 'active-network' === $status ? ' --network' : '' ) );
+	}
+	if ( 'inactive' !== $wanted ) {
+		kubepress_wp( "plugin activate $slug" . ( 'active-network' === $wanted ? ' --network' : '' ) );
+	}
+}
+
+$plan = json_decode( getenv( 'WORDPRESS_EXTENSIONS' ), true );
+$result = array();
+foreach ( array( 'plugin' => 'plugins', 'theme' => 'themes' ) as $type => $key ) {
+	$errors = array();
+	$installed = kubepress_installed( $type );
+	foreach ( $plan[ $key ] as $item ) {
+		try {
+			kubepress_reconcile( $type, $item, isset( $installed[ $item['slug'] ] ) ? $installed[ $item['slug'] ] : null );
+		} catch ( Exception $e ) {
+			$errors[ $item['slug'] ] = $e->getMessage();
+			WP_CLI::warning( $item['slug'] . ': ' . $e->getMessage() );
+		}
+	}
+
+	$installed = kubepress_installed( $type );
+	$result[ $key ] = array();
+	foreach ( $plan[ $key ] as $item ) {
+		$slug = $item['slug'];
+		// pruned plugins and themes are no longer reported
+		if ( $item['remove'] && ! isset( $errors[ $slug ] ) ) {
+			continue;
+		}
+		$result[ $key ][] = array(
+			'slug'    => $slug,
+			'version' => isset( $installed[ $slug ] ) ? $installed[ $slug ]['version'] : '',
+			'status'  => isset( $installed[ $slug ] ) ? $installed[ $slug ]['status'] : '',
+			'error'   => isset( $errors[ $slug ] ) ? $errors[ $slug ] : '',
+		);
+	}
+}
+$message = json_encode( $result );
+foreach ( array( 'error', 'version', 'status' ) as $field ) {
+	if ( strlen( $message ) <= 4096 ) {
+		break;
+	}
+	foreach ( $result as $key => $items ) {
+		foreach ( $items as $i => $item ) {
+			if ( 'error' === $field && '' !== $item['error'] ) {
+				$result[ $key ][ $i ]['error'] = 'failed, see the logs of the job';
+			} elseif ( 'error' !== $field ) {
+				unset( $result[ $key ][ $i ][ $field ] );
+			}
+		}
+	}
+	$message = json_encode( $result );
+}
+file_put_contents( '/dev/termination-log', $message );
+PHP
+
+chown -R 33:33 /var/www/html/wp-content
+`
+
+// HasExtensions returns whether the site has plugins or themes to install, or dropped ones to prune
+func HasExtensions(wp *crmv1.WordPressSite) bool {
+	if len(wp.Spec.WordPress.Plugins) > 0 || len(wp.Spec.WordPress.Themes) > 0 {
+		return true
+	}
+	return wp.Spec.WordPress.Prune && (len(wp.Status.Plugins) > 0 || len(wp.Status.Themes) > 0)
+}
+
+// GetExtensionsHash returns the hash of the plugins and themes of the site, the job runs again when it changes
+func GetExtensionsHash(wp *crmv1.WordPressSite) string {
+	data, _ := json.Marshal(struct {
+		Plugins []crmv1.Extension `json:"plugins"`
+		Themes  []crmv1.Extension `json:"themes"`
+		Prune   bool              `json:"prune"`
+	}{wp.Spec.WordPress.Plugins, wp.Spec.WordPress.Themes, wp.Spec.WordPress.Prune})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// GetExtensionSource returns the source of the plugin or theme as reported in the status, empty for wordpress.org
+func GetExtensionSource(extension crmv1.Extension) string {
+	source := extension.Source
+	switch {
+	case source == nil:
+		return ""
+	case source.URL != "":
+		return source.URL
+	case source.ConfigMap != nil:
+		return fmt.Sprintf("configmap:%s/%s", source.ConfigMap.Name, source.ConfigMap.Key)
+	case source.PersistentVolumeClaim != nil:
+		return fmt.Sprintf("pvc:%s/%s", source.PersistentVolumeClaim.ClaimName, strings.TrimPrefix(source.PersistentVolumeClaim.Path, "/"))
+	}
+	return ""
+}
+
+// BuildExtensionsJobSpec returns the job spec that installs, activates and prunes the plugins and themes of the site
+// archives from ConfigMaps and PersistentVolumeClaims are mounted into the job
+func BuildExtensionsJobSpec(wp *crmv1.WordPressSite) (batchv1.JobSpec, error) {
+	backoffLimit := int32(1)
+
+	volumes := []corev1.Volume{}
+	volumeMounts := []corev1.VolumeMount{}
+
+	plan := extensionsPlan{Plugins: []extensionsPlanItem{}, Themes: []extensionsPlanItem{}}
+
+	// addItems adds the plugins or themes of the spec and the dropped ones to the plan
+	addItems := func(items *[]extensionsPlanItem, extensions []crmv1.Extension, installed []crmv1.ExtensionStatus) {
+		previous := map[string]crmv1.ExtensionStatus{}
+		for _, status := range installed {
+			previous[status.Slug] = status
+		}
+
+		for _, extension := range extensions {
+			item := extensionsPlanItem{
+				Slug:     extension.Slug,
+				Version:  extension.Version,
+				Activate: extension.Activate,
+				Network:  extension.NetworkActivate,
+			}
+
+			if extension.Source != nil {
+				item.Reinstall = previous[extension.Slug].Source != GetExtensionSource(extension)
+
+				if extension.Source.URL != "" {
+					item.Source = extension.Source.URL
+				} else {
+					// the index keeps the volume names short and unique
+					name := fmt.Sprintf("extension-source-%d", len(volumes))
+					mountPath := path.Join(extensionSourcesPath, name)
+
+					volume := corev1.Volume{Name: name}
+					if configMap := extension.Source.ConfigMap; configMap != nil {
+						// wp-cli recognizes archives by their extension
+						volume.ConfigMap = &corev1.ConfigMapVolumeSource{
+							LocalObjectReference: corev1.LocalObjectReference{Name: configMap.Name},
+							Items:                []corev1.KeyToPath{{Key: configMap.Key, Path: extension.Slug + ".zip"}},
+						}
+						item.Source = path.Join(mountPath, extension.Slug+".zip")
+					} else {
+						claim := extension.Source.PersistentVolumeClaim
+						volume.PersistentVolumeClaim = &corev1.PersistentVolumeClaimVolumeSource{ClaimName: claim.ClaimName, ReadOnly: true}
+						item.Source = path.Join(mountPath, claim.Path)
+					}
+
+					volumes = append(volumes, volume)
+					volumeMounts = append(volumeMounts, corev1.VolumeMount{Name: name, MountPath: mountPath, ReadOnly: true})
+				}
+			}
+
+			*items = append(*items, item)
+			delete(previous, extension.Slug)
+		}
+
+		if !wp.Spec.WordPress.Prune {
+			return
+		}
+		for _, status := range installed {
+			if _, dropped := previous[status.Slug]; dropped {
+				*items = append(*items, extensionsPlanItem{Slug: status.Slug, Remove: true})
+			}
+		}
+	}
+	addItems(&plan.Plugins, wp.Spec.WordPress.Plugins, wp.Status.Plugins)
+	addItems(&plan.Themes, wp.Spec.WordPress.Themes, wp.Status.Themes)
+
+	planJSON, err := json.Marshal(plan)
+	if err != nil {
+		return batchv1.JobSpec{}, fmt.Errorf("failed to encode plugins and themes: %w", err)
+	}
+
+	container := corev1.Container{
+		Name:    ExtensionsContainer,
+		Command: []string{"sh", "-c", extensionsScript},
+		Env: append(getDatabaseTLSEnv(wp),
+			corev1.EnvVar{Name: "WORDPRESS_EXTENSIONS", Value: string(planJSON)},
+		),
+		VolumeMounts: volumeMounts,
+	}
+
+	podSpec := buildWPCliPodSpec(wp, container)
+	podSpec.Volumes = append(podSpec.Volumes, volumes...)
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetExtensionsLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "extensions-job",
+				}),
+			},
+			Spec: podSpec,
+		},
+	}, nil
+}
+
+// GetExtensionsResult reads the result the extensions container of a finished pod reported
+func GetExtensionsResult(pod *corev1.Pod) (*ExtensionsResult, error) {
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name != ExtensionsContainer || status.State.Terminated == nil {
+			continue
+		}
+
+		result := &ExtensionsResult{}
+		if err := json.Unmarshal([]byte(status.State.Terminated.Message), result); err != nil {
+			return nil, fmt.Errorf("failed to parse extensions result: %w", err)
+		}
+		return result, nil
+	}
+
+	return nil, fmt.Errorf("extensions pod %s has no result", pod.Name)
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/pem"
 	"fmt"
 	"golang.org/x/crypto/ssh"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 // GenerateSSHHostKeys generates RSA and ED25519 SSH host keys and returns them as PEM-encoded byte slices.
@@ -61,26 +62,7 @@ func RemoveString(slice []string, s string) []string {
 	return result
 }
 
-func GoMemoryToPHPMemory(goMem string) (string, error) {
-	var value int
-	var unit string
-	_, err := fmt.Sscanf(goMem, "%d%s", &value, &unit)
-	if err != nil {
-		return "", fmt.Errorf("invalid memory format: %w", err)
-	}
-
-	switch unit {
-	case "Ki":
-		// Convert Ki to M (rounded down)
-		value = value / 1024
-	case "Mi":
-		// Mi is already in M
-	case "Gi":
-		// Convert Gi to M
-		value = value * 1024
-	default:
-		return "", fmt.Errorf("unsupported unit: %s", unit)
-	}
-
-	return fmt.Sprintf("%dM", value), nil
+// QuantityToPHPMemory converts a memory quantity to the PHP shorthand in megabytes (rounded down)
+func QuantityToPHPMemory(q resource.Quantity) string {
+	return fmt.Sprintf("%dM", q.Value()/(1024*1024))
 }
@@ -0,0 +1,150 @@
+package wordpress
+
+import (
+	"context"
+	"fmt"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+// the import container copies the existing database into the managed one with a consistent dump,
+// tables that exist from an earlier attempt are replaced and the number of tables is compared afterwards
+// MySQL 8 collations are unknown to MariaDB and replaced with the default collation of WordPress
+// the existing database is read with its SSL mode and the CA bundle of the site, the managed one uses the defaults
+const databaseMigrationScript = `set -eo pipefail
+` + databaseClientTLSScript + `
+SOURCE=(-h "$SOURCE_DB_HOST" -P "${SOURCE_DB_PORT:-3306}" -u "$SOURCE_DB_USER" -p"$SOURCE_DB_PASSWORD" $(db_tls_options "$SOURCE_DB_SSL_MODE" "$WORDPRESS_DB_SSL_CA"))
+TARGET=(-h "$TARGET_DB_HOST" -P "${TARGET_DB_PORT:-3306}" -u "$TARGET_DB_USER" -p"$TARGET_DB_PASSWORD" "$TARGET_DB_NAME")
+
+# the managed database was just created, its user might not be ready yet
+TRIES=0
+until mariadb "${TARGET[@]}" -e "SELECT 1" >/dev/null 2>&1; do
+	TRIES=$((TRIES + 1))
+	[ "$TRIES" -ge 60 ] && { echo "Managed database is not reachable"; exit 1; }
+	echo "Waiting for the managed database..."
+	sleep 5
+done
+
+echo "Copying database $SOURCE_DB_NAME from $SOURCE_DB_HOST..."
+mariadb-dump --single-transaction --quick --routines --triggers "${SOURCE[@]}" "$SOURCE_DB_NAME" \
+	| sed -e 's/utf8mb4_0900_[a-z_]*/utf8mb4_unicode_ci/g' \
+	| mariadb "${TARGET[@]}"
+
+COUNT="SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE()"
+SOURCE_TABLES=$(mariadb "${SOURCE[@]}" -N -e "$COUNT" "$SOURCE_DB_NAME")
+TARGET_TABLES=$(mariadb "${TARGET[@]}" -N -e "$COUNT")
+if [ "$SOURCE_TABLES" != "$TARGET_TABLES" ]; then
+	echo "The managed database has $TARGET_TABLES tables, the existing one $SOURCE_TABLES"
+	exit 1
+fi
+echo "Copied $TARGET_TABLES tables"
+`
+
+// IsMigratingDatabase returns whether the existing database of the site is being moved into the managed cluster,
+// the managed database is provisioned during the migration although the site does not create a new one yet
+func IsMigratingDatabase(wp *crmv1.WordPressSite) bool {
+	if wp.Spec.Database.CreateNew || !wp.Spec.Database.MigrateToManaged || wp.Status.DatabaseMigration == nil {
+		return false
+	}
+
+	switch wp.Status.DatabaseMigration.Phase {
+	case crmv1.DatabaseMigrationPhaseProvisioning, crmv1.DatabaseMigrationPhaseImporting, crmv1.DatabaseMigrationPhaseSwitching:
+		return true
+	}
+	return false
+}
+
+// IsManagedDatabaseReady returns whether the managed database and the grant of its user are ready
+func IsManagedDatabaseReady(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) (bool, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}, secret); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	username := string(secret.Data["databaseUsername"])
+	if username == "" {
+		return false, nil
+	}
+
+	mariaDBRef := GetMariaDBRef(wp)
+
+	database := &mariadbv1alpha1.Database{}
+	if err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseResourceName(wp, mariaDBRef), Namespace: mariaDBRef.Namespace}, database); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	grant := &mariadbv1alpha1.Grant{}
+	if err := r.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("grant-%s", username), Namespace: mariaDBRef.Namespace}, grant); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	return database.IsReady() && grant.IsReady(), nil
+}
+
+// RollbackDatabaseMigration removes the managed database, its user and the database secret created for a migration
+// returns true once all of them are gone
+func RollbackDatabaseMigration(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "database-migration")
+
+	// everything else is created after the database secret
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}, secret)
+	if errors.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get database secret")
+		return false, err
+	}
+
+	objects, err := getDatabaseObjects(ctx, r, wp)
+	if err != nil {
+		logger.Error(err, "Failed to get database objects")
+		return false, err
+	}
+
+	return deleteDatabaseObjects(ctx, r, append(objects, secret))
+}
+
+// BuildDatabaseMigrationJobSpec returns the job spec that copies the existing database of the site into the managed one
+// the existing database is read with the connection details of the admin secret, the managed one with the database secret
+func BuildDatabaseMigrationJobSpec(wp *crmv1.WordPressSite) batchv1.JobSpec {
+	backoffLimit := int32(0)
+
+	container := corev1.Container{
+		Name:    "import",
+		Image:   config.AppConfig.BackupImage,
+		Command: []string{"bash", "-c", databaseMigrationScript},
+		Env: append(append(getDatabaseSecretEnv("SOURCE_DB", wp.Spec.AdminUserSecretKeyRef),
+			getDatabaseSecretEnv("TARGET_DB", GetDatabaseSecretName(wp.Name))...),
+			getDatabaseTLSEnv(wp)...),
+	}
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers:    []corev1.Container{container},
+	}
+	// the CA bundle of the site belongs to the existing database
+	setDatabaseCAVolume(&podSpec, wp)
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetDatabaseLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "database-migration-job",
+				}),
+			},
+			Spec: podSpec,
+		},
+	}
+}
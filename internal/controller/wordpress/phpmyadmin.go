@@ -17,6 +17,9 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
+// PHPMyAdminName is the name of the phpMyAdmin deployment, service and ingress, shared by all sites of a namespace
+const PHPMyAdminName = "phpmyadmin"
+
 func ReconcilePHPMyAdmin(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) error {
 	logger := log.FromContext(ctx).WithValues("component", "phpmyadmin")
 
@@ -28,14 +31,14 @@ func ReconcilePHPMyAdmin(ctx context.Context, r client.Client, wp *crmv1.WordPre
 	logger = logger.WithValues("component", "phpmyadmin", "site", wp.Name, "namespace", wp.Namespace)
 
 	deployment := &appsv1.Deployment{}
-	deploymentName := "phpmyadmin"
+	deploymentName := PHPMyAdminName
 	err := r.Get(ctx, types.NamespacedName{Name: deploymentName, Namespace: wp.Namespace}, deployment)
 
 	if errors.IsNotFound(err) {
 		env := []corev1.EnvVar{
 			{
 				Name:  "PMA_HOST",
-				Value: fmt.Sprintf("%s.%s.svc.cluster.local", MariaDBClusterName, wp.Namespace),
+				Value: GetMariaDBHost(GetMariaDBRef(wp)),
 			},
 		}
 
@@ -87,7 +90,7 @@ func ReconcilePHPMyAdmin(ctx context.Context, r client.Client, wp *crmv1.WordPre
 		}
 
 		// --- Add Service definition ---
-		serviceName := "phpmyadmin"
+		serviceName := PHPMyAdminName
 		serviceLabels := map[string]string{
 			"app.kubernetes.io/managed-by": "kubepress-operator",
 			"app.kubernetes.io/part-of":    "kubepress",
@@ -117,7 +120,7 @@ func ReconcilePHPMyAdmin(ctx context.Context, r client.Client, wp *crmv1.WordPre
 		}
 
 		// --- Add Ingress definition ---
-		ingressName := "phpmyadmin"
+		ingressName := PHPMyAdminName
 		host := config.AppConfig.PhpMyAdminDomain
 		ingressLabels := map[string]string{
 			"app.kubernetes.io/managed-by": "kubepress-operator",
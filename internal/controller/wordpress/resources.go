@@ -0,0 +1,135 @@
+package wordpress
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+// EffectiveResources are the resources the WordPress container runs with
+// after the defaults were applied
+type EffectiveResources struct {
+	CPURequest    resource.Quantity
+	CPULimit      resource.Quantity
+	MemoryRequest resource.Quantity
+	MemoryLimit   resource.Quantity
+}
+
+// ResourceRequirements returns the resources in the form of the container spec
+func (e *EffectiveResources) ResourceRequirements() corev1.ResourceRequirements {
+	return corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    e.CPURequest,
+			corev1.ResourceMemory: e.MemoryRequest,
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    e.CPULimit,
+			corev1.ResourceMemory: e.MemoryLimit,
+		},
+	}
+}
+
+// PHPMemoryLimit returns the memory limit in the format PHP and WordPress expect
+func (e *EffectiveResources) PHPMemoryLimit() string {
+	return QuantityToPHPMemory(e.MemoryLimit)
+}
+
+// resourceSource is a place the resources of a site can come from
+type resourceSource struct {
+	name      string
+	resources *crmv1.ResourceRequirements
+}
+
+// GetKubePressDefaults returns the KubePressDefaults of the namespace, or nil if there are none
+func GetKubePressDefaults(ctx context.Context, r client.Client, namespace string) (*crmv1.KubePressDefaults, error) {
+	defaults := &crmv1.KubePressDefaults{}
+	err := r.Get(ctx, types.NamespacedName{Name: crmv1.KubePressDefaultsName, Namespace: namespace}, defaults)
+	if errors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get KubePressDefaults: %w", err)
+	}
+
+	return defaults, nil
+}
+
+// GetEffectiveResources looks up the KubePressDefaults of the namespace and resolves the resources of the site
+func GetEffectiveResources(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) (*EffectiveResources, error) {
+	defaults, err := GetKubePressDefaults(ctx, r, wp.Namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	return ResolveResources(wp, defaults)
+}
+
+// ResolveResources resolves the resources of the site field by field,
+// the site comes first, then the KubePressDefaults of the namespace, then the operator defaults
+// the spec of the site is not changed, so changed defaults reach existing sites
+// returns an error if a value that is used can not be parsed
+func ResolveResources(wp *crmv1.WordPressSite, defaults *crmv1.KubePressDefaults) (*EffectiveResources, error) {
+	sources := []resourceSource{
+		{"spec.wordpress.resources", wp.Spec.WordPress.Resources},
+	}
+	if defaults != nil {
+		sources = append(sources, resourceSource{fmt.Sprintf("KubePressDefaults %s/%s", defaults.Namespace, defaults.Name), defaults.Spec.Resources})
+	}
+	sources = append(sources, resourceSource{"operator defaults", &config.AppConfig.DefaultResources})
+
+	effective := &EffectiveResources{}
+	fields := []struct {
+		name     string
+		target   *resource.Quantity
+		getValue func(*crmv1.ResourceRequirements) string
+	}{
+		{"cpuRequest", &effective.CPURequest, func(res *crmv1.ResourceRequirements) string { return res.CPURequest }},
+		{"cpuLimit", &effective.CPULimit, func(res *crmv1.ResourceRequirements) string { return res.CPULimit }},
+		{"memoryRequest", &effective.MemoryRequest, func(res *crmv1.ResourceRequirements) string { return res.MemoryRequest }},
+		{"memoryLimit", &effective.MemoryLimit, func(res *crmv1.ResourceRequirements) string { return res.MemoryLimit }},
+	}
+
+	for _, f := range fields {
+		found := false
+		for _, source := range sources {
+			if source.resources == nil {
+				continue
+			}
+			value := f.getValue(source.resources)
+			if value == "" {
+				continue
+			}
+
+			quantity, err := resource.ParseQuantity(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %q in %s: %w", f.name, value, source.name, err)
+			}
+			*f.target = quantity
+			found = true
+			break
+		}
+
+		if !found {
+			// the operator defaults are validated on startup, this only happens if they were not loaded
+			return nil, fmt.Errorf("no value for %s", f.name)
+		}
+	}
+
+	// a request taken from the defaults can be above a limit set on the site, Kubernetes rejects that
+	if effective.CPURequest.Cmp(effective.CPULimit) > 0 {
+		effective.CPURequest = effective.CPULimit.DeepCopy()
+	}
+	if effective.MemoryRequest.Cmp(effective.MemoryLimit) > 0 {
+		effective.MemoryRequest = effective.MemoryLimit.DeepCopy()
+	}
+
+	return effective, nil
+}
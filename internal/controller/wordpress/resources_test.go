@@ -0,0 +1,87 @@
+package wordpress
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+func TestResolveResources(t *testing.T) {
+	previous := config.AppConfig.DefaultResources
+	t.Cleanup(func() { config.AppConfig.DefaultResources = previous })
+	config.AppConfig.DefaultResources = crmv1.ResourceRequirements{
+		CPURequest: "100m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "512Mi",
+	}
+
+	namespaceDefaults := &crmv1.KubePressDefaults{
+		ObjectMeta: metav1.ObjectMeta{Name: crmv1.KubePressDefaultsName, Namespace: "sites"},
+		Spec: crmv1.KubePressDefaultsSpec{
+			Resources: &crmv1.ResourceRequirements{CPURequest: "200m", MemoryLimit: "1Gi"},
+		},
+	}
+
+	tests := []struct {
+		name      string
+		resources *crmv1.ResourceRequirements
+		defaults  *crmv1.KubePressDefaults
+		want      crmv1.ResourceRequirements
+		wantErr   bool
+	}{
+		{
+			name: "operator defaults",
+			want: crmv1.ResourceRequirements{CPURequest: "100m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "512Mi"},
+		},
+		{
+			name:     "namespace defaults before operator defaults",
+			defaults: namespaceDefaults,
+			want:     crmv1.ResourceRequirements{CPURequest: "200m", CPULimit: "1", MemoryRequest: "256Mi", MemoryLimit: "1Gi"},
+		},
+		{
+			name:      "site before namespace defaults",
+			resources: &crmv1.ResourceRequirements{CPURequest: "500m", MemoryRequest: "512Mi"},
+			defaults:  namespaceDefaults,
+			want:      crmv1.ResourceRequirements{CPURequest: "500m", CPULimit: "1", MemoryRequest: "512Mi", MemoryLimit: "1Gi"},
+		},
+		{
+			name:      "request above the limit of the site is clamped",
+			resources: &crmv1.ResourceRequirements{CPULimit: "50m", MemoryLimit: "128Mi"},
+			defaults:  namespaceDefaults,
+			want:      crmv1.ResourceRequirements{CPURequest: "50m", CPULimit: "50m", MemoryRequest: "128Mi", MemoryLimit: "128Mi"},
+		},
+		{
+			name:      "invalid quantity of the site",
+			resources: &crmv1.ResourceRequirements{MemoryLimit: "1 GiB"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wp := &crmv1.WordPressSite{Spec: crmv1.WordPressSiteSpec{WordPress: crmv1.WordPressConfig{Resources: tt.resources}}}
+
+			effective, err := ResolveResources(wp, tt.defaults)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveResources() = %v, want an error", effective)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveResources() = %v, want nil", err)
+			}
+
+			got := crmv1.ResourceRequirements{
+				CPURequest:    effective.CPURequest.String(),
+				CPULimit:      effective.CPULimit.String(),
+				MemoryRequest: effective.MemoryRequest.String(),
+				MemoryLimit:   effective.MemoryLimit.String(),
+			}
+			if got != tt.want {
+				t.Errorf("ResolveResources() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
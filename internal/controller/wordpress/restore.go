@@ -0,0 +1,197 @@
+package wordpress
+
+import (
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+const (
+	// RestoreInProgressAnnotation is set on a WordPressSite while a restore is running,
+	// the WordPress deployment is scaled to zero as long as it is present
+	RestoreInProgressAnnotation = "crm.hostzero.de/restore-in-progress"
+
+	RestoreWorkVolumeName = "restore-work"
+)
+
+// the download container fetches the archive from the target and verifies its checksum
+const restoreDownloadScript = `set -e
+mc alias set target "$S3_ENDPOINT" "$S3_ACCESS_KEY" "$S3_SECRET_KEY" >/dev/null
+echo "Downloading $BACKUP_LOCATION..."
+mc cp "target/$S3_BUCKET/$BACKUP_LOCATION" /restore/backup.tar.gz
+echo "$BACKUP_CHECKSUM  /restore/backup.tar.gz" | sha256sum -c -
+`
+
+// the database container replaces all tables of the site database with the dump
+const restoreDatabaseScript = `set -e
+` + databaseClientTLSScript + `
+tar -xzf /restore/backup.tar.gz -C /restore database.sql
+
+export MYSQL_PWD="$WORDPRESS_DB_PASSWORD"
+MYSQL="mariadb -h $WORDPRESS_DB_HOST -P ${WORDPRESS_DB_PORT:-3306} -u $WORDPRESS_DB_USER $(db_tls_options "$WORDPRESS_DB_SSL_MODE" "$WORDPRESS_DB_SSL_CA") $WORDPRESS_DB_NAME"
+
+# the database of a freshly created site might not be ready yet
+TRIES=0
+until $MYSQL -e "SELECT 1" >/dev/null 2>&1; do
+	TRIES=$((TRIES + 1))
+	[ "$TRIES" -ge 60 ] && { echo "Database is not reachable"; exit 1; }
+	echo "Waiting for the database..."
+	sleep 5
+done
+
+echo "Dropping existing tables..."
+{
+	echo "SET FOREIGN_KEY_CHECKS=0;"
+	$MYSQL -N -e "SELECT CONCAT('DROP TABLE IF EXISTS ` + "`" + `', table_name, '` + "`" + `;') FROM information_schema.tables WHERE table_schema = DATABASE()"
+} | $MYSQL
+
+echo "Importing database dump..."
+$MYSQL < /restore/database.sql
+`
+
+// the files container replaces the WordPress files with the archived ones
+// wp-config.php of the site is kept, it contains the database connection of this site
+// if the backup was taken from a different host, the old URL is replaced in the whole database,
+// wp-cli handles serialized data, so options and post meta stay intact
+// a cloned site has no wp-config.php yet, wp-cli connects through a temporary one then,
+// the init container of the first WordPress pod creates the real one
+const restoreFilesScript = `set -e
+tar -xzf /restore/backup.tar.gz -C /restore files.tar
+
+echo "Removing existing files..."
+find /var/www/html -mindepth 1 ! -path /var/www/html/wp-config.php -delete
+
+echo "Extracting files..."
+tar -xf /restore/files.tar -C /var/www/html --exclude=./wp-config.php
+
+if [ "$BACKUP_SITE_URL" != "$WORDPRESS_URL" ]; then
+` + wpCliSetupScript + `
+	OLD_HOST=$(echo "$BACKUP_SITE_URL" | sed -e 's|^[a-z]*://||' -e 's|/.*$||')
+	NEW_HOST=$(echo "$WORDPRESS_URL" | sed -e 's|^[a-z]*://||' -e 's|/.*$||')
+	WP="/tmp/wp-cli --path=/var/www/html --allow-root --skip-plugins --skip-themes"
+
+	if [ ! -f /var/www/html/wp-config.php ]; then
+		trap 'rm -f /var/www/html/wp-config.php' EXIT
+		$WP config create --skip-check \
+			--dbhost="$WORDPRESS_DB_HOST${WORDPRESS_DB_PORT:+:$WORDPRESS_DB_PORT}" \
+			--dbname="$WORDPRESS_DB_NAME" \
+			--dbuser="$WORDPRESS_DB_USER" \
+			--dbpass="$WORDPRESS_DB_PASSWORD" \
+			--dbprefix="$WORDPRESS_TABLE_PREFIX"
+` + databaseTLSScript + `
+	fi
+
+	echo "Replacing $BACKUP_SITE_URL with $WORDPRESS_URL..."
+	$WP search-replace "$BACKUP_SITE_URL" "$WORDPRESS_URL" --all-tables-with-prefix --precise
+
+	# covers links with the other scheme and protocol relative links
+	if [ "$OLD_HOST" != "$NEW_HOST" ]; then
+		echo "Replacing $OLD_HOST with $NEW_HOST..."
+		$WP search-replace "//$OLD_HOST" "//$NEW_HOST" --all-tables-with-prefix --precise
+	fi
+fi
+
+chown -R 33:33 /var/www/html
+`
+
+// BuildRestoreDatabaseJobSpec returns the job spec that restores the database of the site from the backup
+func BuildRestoreDatabaseJobSpec(wp *crmv1.WordPressSite, backup *crmv1.WordPressSiteBackup, targetSecretName string) batchv1.JobSpec {
+	container := corev1.Container{
+		Name:    "database",
+		Image:   config.AppConfig.BackupImage,
+		Command: []string{"sh", "-c", restoreDatabaseScript},
+		Env:     append(getDatabaseEnv(wp), getDatabaseTLSEnv(wp)...),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: RestoreWorkVolumeName, MountPath: "/restore"},
+		},
+	}
+
+	return buildRestoreJobSpec(wp, backup, targetSecretName, container, false)
+}
+
+// BuildRestoreFilesJobSpec returns the job spec that restores the files of the site from the backup
+func BuildRestoreFilesJobSpec(wp *crmv1.WordPressSite, backup *crmv1.WordPressSiteBackup, targetSecretName string) batchv1.JobSpec {
+	// the WordPress image is used, so the files are extracted with the same tools and users as in the WordPress container
+	container := corev1.Container{
+		Name:    "files",
+		Image:   wp.Spec.WordPress.Image,
+		Command: []string{"sh", "-c", restoreFilesScript},
+		// the database connection is needed to replace the URL
+		Env: append(append(append(getDatabaseEnv(wp), getDatabaseTLSEnv(wp)...), getDatabaseSettingsEnv(wp)...),
+			corev1.EnvVar{Name: "WORDPRESS_URL", Value: GetSiteUrl(wp)},
+			corev1.EnvVar{Name: "BACKUP_SITE_URL", Value: backup.Status.SiteURL},
+		),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: DefaultVolumeName, MountPath: "/var/www/html"},
+			{Name: RestoreWorkVolumeName, MountPath: "/restore"},
+		},
+	}
+
+	return buildRestoreJobSpec(wp, backup, targetSecretName, container, true)
+}
+
+// buildRestoreJobSpec wraps the restore container into a job that downloads the archive first
+func buildRestoreJobSpec(wp *crmv1.WordPressSite, backup *crmv1.WordPressSiteBackup, targetSecretName string, container corev1.Container, mountSiteVolume bool) batchv1.JobSpec {
+	backoffLimit := int32(0)
+
+	volumes := []corev1.Volume{
+		{
+			Name: RestoreWorkVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				EmptyDir: &corev1.EmptyDirVolumeSource{},
+			},
+		},
+	}
+
+	if mountSiteVolume {
+		volumes = append(volumes, corev1.Volume{
+			Name: DefaultVolumeName,
+			VolumeSource: corev1.VolumeSource{
+				PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+					ClaimName: GetPVCName(wp.Name),
+				},
+			},
+		})
+	}
+
+	downloadContainer := corev1.Container{
+		Name:    "download",
+		Image:   config.AppConfig.BackupUploadImage,
+		Command: []string{"sh", "-c", restoreDownloadScript},
+		Env: append(getBackupTargetEnv(targetSecretName),
+			corev1.EnvVar{Name: "BACKUP_LOCATION", Value: backup.Status.Location},
+			corev1.EnvVar{Name: "BACKUP_CHECKSUM", Value: backup.Status.Checksum},
+		),
+		VolumeMounts: []corev1.VolumeMount{
+			{Name: RestoreWorkVolumeName, MountPath: "/restore"},
+		},
+	}
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy:  corev1.RestartPolicyNever,
+		InitContainers: []corev1.Container{downloadContainer},
+		Containers:     []corev1.Container{container},
+		Volumes:        volumes,
+	}
+	// both restore containers connect to the database with the CA bundle of the site
+	setDatabaseCAVolume(&podSpec, wp)
+	// the files are restored with wp-cli, which is copied from the toolbox image of the site if it has one
+	if mountSiteVolume {
+		setWPCliVolume(&podSpec, wp)
+	}
+
+	return batchv1.JobSpec{
+		BackoffLimit: &backoffLimit,
+		Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{
+				Labels: GetRestoreLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "restore-job",
+				}),
+			},
+			Spec: podSpec,
+		},
+	}
+}
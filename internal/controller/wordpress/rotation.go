@@ -0,0 +1,294 @@
+package wordpress
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+const (
+	// RotateDatabasePasswordAnnotation triggers a rotation of the database password, it is removed once the password is rotated
+	RotateDatabasePasswordAnnotation = "crm.hostzero.de/rotate-database-password"
+
+	// DatabasePasswordRotatedAnnotation on the pod template rolls the WordPress pods after the switch to a new database user
+	DatabasePasswordRotatedAnnotation = "crm.hostzero.de/database-password-rotated"
+
+	// mariaDBWatchLabel makes the MariaDB operator apply changes of a password secret to its users
+	mariaDBWatchLabel = "k8s.mariadb.com/watch"
+)
+
+// GetPasswordRotationDue returns whether the database password of the site has to be rotated,
+// otherwise the time until the next scheduled rotation, which is zero if there is none
+func GetPasswordRotationDue(wp *crmv1.WordPressSite, now time.Time) (bool, time.Duration) {
+	if !wp.Spec.Database.CreateNew {
+		return false, 0
+	}
+
+	if _, ok := wp.Annotations[RotateDatabasePasswordAnnotation]; ok {
+		return true, 0
+	}
+
+	rotation := wp.Spec.Database.PasswordRotation
+	if rotation == nil || rotation.Interval.Duration <= 0 {
+		return false, 0
+	}
+
+	// the first password was created together with the site
+	last := wp.CreationTimestamp.Time
+	if wp.Status.LastRotationTime != nil {
+		last = wp.Status.LastRotationTime.Time
+	}
+
+	next := last.Add(rotation.Interval.Duration)
+	if !next.After(now) {
+		return true, 0
+	}
+
+	return false, next.Sub(now)
+}
+
+// NewPasswordRotation returns a rotation from the current database user of the site to a new one with a random suffix,
+// nil if the database user does not exist yet
+func NewPasswordRotation(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) (*crmv1.PasswordRotationStatus, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}, secret); err != nil {
+		return nil, err
+	}
+
+	username := string(secret.Data["databaseUsername"])
+	if username == "" {
+		return nil, nil
+	}
+
+	// the random suffix of the current user is replaced, so the name stays within the 32 characters of MariaDB
+	prefix := username
+	if i := strings.LastIndex(prefix, "-"); i > 0 && len(prefix)-i == 7 {
+		prefix = prefix[:i]
+	}
+	if len(prefix) > 25 {
+		prefix = prefix[:25]
+	}
+
+	suffix, err := GenerateRandomString(6)
+	if err != nil {
+		return nil, err
+	}
+
+	return &crmv1.PasswordRotationStatus{
+		Username:         strings.ToLower(fmt.Sprintf("%s-%s", prefix, suffix)),
+		PreviousUsername: username,
+		StartTime:        metav1.Now(),
+	}, nil
+}
+
+// ReconcileRotationUser creates the new database user of the rotation with a new random password,
+// it reads the password from a secret of its own until the site is switched to it
+// returns true once the user and its grant are ready
+func ReconcileRotationUser(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "database-rotation")
+
+	rotation := wp.Status.PasswordRotation
+	mariaDBRef := GetMariaDBRef(wp)
+
+	passwordSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseUserSecretName(rotation.Username), Namespace: mariaDBRef.Namespace}, passwordSecret)
+	if errors.IsNotFound(err) {
+		password, err := GenerateRandomString(30)
+		if err != nil {
+			logger.Error(err, "Failed to generate database password")
+			return false, err
+		}
+
+		passwordSecret = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      GetDatabaseUserSecretName(rotation.Username),
+				Namespace: mariaDBRef.Namespace,
+				Labels: GetDatabaseLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "mariadb-user-password",
+					mariaDBWatchLabel:        "",
+				}),
+			},
+			Data: map[string][]byte{
+				"databasePassword": []byte(password),
+			},
+		}
+		if err := setDatabaseOwnerReference(wp, passwordSecret, scheme); err != nil {
+			return false, err
+		}
+		if err := r.Create(ctx, passwordSecret); err != nil {
+			logger.Error(err, "Failed to create the password secret of the new database user")
+			return false, err
+		}
+	} else if err != nil {
+		logger.Error(err, "Failed to get the password secret of the new database user")
+		return false, err
+	}
+
+	user := &mariadbv1alpha1.User{}
+	err = r.Get(ctx, types.NamespacedName{Name: rotation.Username, Namespace: mariaDBRef.Namespace}, user)
+	if errors.IsNotFound(err) {
+		// the secret is next to the cluster already, so the user reads its password from it
+		if err := CreateDatabaseUser(ctx, r, scheme, wp, mariaDBRef, GetDatabaseResourceName(wp, mariaDBRef), rotation.Username, passwordSecret); err != nil {
+			logger.Error(err, "Failed to create the new database user")
+			return false, err
+		}
+		logger.Info("Created database user for the password rotation", "username", rotation.Username)
+		return false, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get the new database user")
+		return false, err
+	}
+
+	grant := &mariadbv1alpha1.Grant{}
+	if err := r.Get(ctx, types.NamespacedName{Name: fmt.Sprintf("grant-%s", rotation.Username), Namespace: mariaDBRef.Namespace}, grant); err != nil {
+		return false, client.IgnoreNotFound(err)
+	}
+
+	return user.IsReady() && grant.IsReady(), nil
+}
+
+// SwitchDatabaseUser writes the new database user of the rotation and its password into the secret of the site
+// the previous user keeps the old password in a secret of its own, so the pods that still use it can connect until they are rolled
+func SwitchDatabaseUser(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "database-rotation")
+
+	rotation := wp.Status.PasswordRotation
+	mariaDBRef := GetMariaDBRef(wp)
+
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseSecretName(wp.Name), Namespace: wp.Namespace}, secret); err != nil {
+		logger.Error(err, "Failed to get WP secret")
+		return err
+	}
+
+	passwordSecret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: GetDatabaseUserSecretName(rotation.Username), Namespace: mariaDBRef.Namespace}, passwordSecret); err != nil {
+		logger.Error(err, "Failed to get the password secret of the new database user")
+		return err
+	}
+
+	// users next to a cluster in another namespace read from a copy already, the others read from the secret of the site
+	if mariaDBRef.Namespace == wp.Namespace && string(secret.Data["databaseUsername"]) == rotation.PreviousUsername {
+		if err := moveDatabaseUserPassword(ctx, r, scheme, wp, mariaDBRef, rotation.PreviousUsername, secret.Data["databasePassword"]); err != nil {
+			return err
+		}
+	}
+
+	secret.Data["databaseUsername"] = []byte(rotation.Username)
+	secret.Data["databasePassword"] = passwordSecret.Data["databasePassword"]
+	if secret.Labels == nil {
+		secret.Labels = map[string]string{}
+	}
+	secret.Labels[mariaDBWatchLabel] = ""
+
+	if err := r.Update(ctx, secret); err != nil {
+		logger.Error(err, "Failed to update WP secret with the new database user")
+		return err
+	}
+
+	logger.Info("Switched to the new database user", "username", rotation.Username, "previous", rotation.PreviousUsername)
+
+	return nil
+}
+
+// moveDatabaseUserPassword makes a database user read its password from a secret of its own
+func moveDatabaseUserPassword(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite, mariaDBRef types.NamespacedName, username string, password []byte) error {
+	logger := log.FromContext(ctx).WithValues("component", "database-rotation")
+
+	userSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      GetDatabaseUserSecretName(username),
+			Namespace: mariaDBRef.Namespace,
+		},
+	}
+	_, err := ctrl.CreateOrUpdate(ctx, r, userSecret, func() error {
+		userSecret.Labels = GetDatabaseLabels(wp, map[string]string{
+			"app.kubernetes.io/name": "mariadb-user-password",
+			mariaDBWatchLabel:        "",
+		})
+		userSecret.Data = map[string][]byte{
+			"databasePassword": password,
+		}
+		return setDatabaseOwnerReference(wp, userSecret, scheme)
+	})
+	if err != nil {
+		logger.Error(err, "Failed to reconcile database password secret", "name", userSecret.Name)
+		return err
+	}
+
+	user := &mariadbv1alpha1.User{}
+	if err := r.Get(ctx, types.NamespacedName{Name: username, Namespace: mariaDBRef.Namespace}, user); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	if user.Spec.PasswordSecretKeyRef != nil && user.Spec.PasswordSecretKeyRef.Name == userSecret.Name {
+		return nil
+	}
+
+	user.Spec.PasswordSecretKeyRef = &mariadbv1alpha1.SecretKeySelector{
+		LocalObjectReference: mariadbv1alpha1.LocalObjectReference{Name: userSecret.Name},
+		Key:                  "databasePassword",
+	}
+	if err := r.Update(ctx, user); err != nil {
+		logger.Error(err, "Failed to move the password of the MySQL user to its own secret", "username", username)
+		return err
+	}
+
+	return nil
+}
+
+// IsRotationRolledOut returns whether all WordPress pods were replaced after the switch to the new database user
+func IsRotationRolledOut(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) (bool, error) {
+	deployment := &appsv1.Deployment{}
+	if err := r.Get(ctx, types.NamespacedName{Name: GetResourceName(wp.Name), Namespace: wp.Namespace}, deployment); err != nil {
+		if errors.IsNotFound(err) {
+			// there are no pods that could use the previous user
+			return true, nil
+		}
+		return false, err
+	}
+
+	// the deployment is updated with the time of the switch after the rotation step
+	if deployment.Spec.Template.Annotations[DatabasePasswordRotatedAnnotation] != getPodAnnotations(wp)[DatabasePasswordRotatedAnnotation] {
+		return false, nil
+	}
+
+	replicas := int32(1)
+	if deployment.Spec.Replicas != nil {
+		replicas = *deployment.Spec.Replicas
+	}
+
+	return deployment.Status.ObservedGeneration >= deployment.Generation &&
+		deployment.Status.UpdatedReplicas == replicas &&
+		deployment.Status.Replicas == replicas, nil
+}
+
+// RemovePreviousDatabaseUser removes the database user the site used before the rotation, one object after another
+// returns true once it is gone
+func RemovePreviousDatabaseUser(ctx context.Context, r client.Client, wp *crmv1.WordPressSite) (bool, error) {
+	rotation := wp.Status.PasswordRotation
+	mariaDBRef := GetMariaDBRef(wp)
+
+	objects := getDatabaseUserObjects(mariaDBRef, rotation.PreviousUsername)
+
+	// next to a cluster in the namespace of the site the new user reads from the secret of the site by now,
+	// the database step moved it there after the switch
+	if mariaDBRef.Namespace == wp.Namespace {
+		objects = append(objects, &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: GetDatabaseUserSecretName(rotation.Username), Namespace: mariaDBRef.Namespace}})
+	}
+
+	return deleteDatabaseObjects(ctx, r, objects)
+}
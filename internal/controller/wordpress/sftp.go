@@ -24,6 +24,9 @@ const SSHKeysVolumeName = "ssh-keys-config"
 const SFTPPortMin = 10000
 const SFTPPortMax = 32767
 
+// SFTPHostKeysSecretName is the secret with the SSH host keys, shared by all sites of a namespace
+const SFTPHostKeysSecretName = "sftp-ssh-host-keys"
+
 func ReconcileSFTPDeployment(ctx context.Context, r client.Client, scheme *runtime.Scheme, wp *crmv1.WordPressSite, username string) error {
 	logger := log.FromContext(ctx).WithValues("component", "sftp-deployment")
 
@@ -37,7 +40,7 @@ func ReconcileSFTPDeployment(ctx context.Context, r client.Client, scheme *runti
 		mySQLSecretName := wp.Spec.AdminUserSecretKeyRef
 
 		// Ensure SSH host key Secret exists in this namespace
-		sshSecretName := "sftp-ssh-host-keys"
+		sshSecretName := SFTPHostKeysSecretName
 		sshSecret := &corev1.Secret{}
 		err = r.Get(ctx, types.NamespacedName{Name: sshSecretName, Namespace: wp.Namespace}, sshSecret)
 		if errors.IsNotFound(err) {
@@ -0,0 +1,68 @@
+package wordpress
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+// generatorPattern matches the generator comment WordPress prints, e.g. <!-- generator="WordPress/6.5.2" -->
+var generatorPattern = regexp.MustCompile(`generator="WordPress/([^"]+)"`)
+
+// versionClient does not follow redirects, a redirect means the response is not from wp-links-opml.php
+var versionClient = &http.Client{
+	Timeout: 5 * time.Second,
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// GetVersions returns the WordPress core and the PHP version of the site
+// they are read through the Service of the site: wp-links-opml.php prints the WordPress generator
+// and is not redirected by WordPress, PHP adds its version to the X-Powered-By header
+func GetVersions(ctx context.Context, wp *crmv1.WordPressSite) (wordpressVersion string, phpVersion string, err error) {
+	url := fmt.Sprintf("http://%s.%s.svc/wp-links-opml.php", GetResourceName(wp.Name), wp.Namespace)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", "", err
+	}
+
+	// answer as if the request came through the ingress
+	if wp.Spec.Ingress != nil && wp.Spec.Ingress.Host != "" {
+		req.Host = wp.Spec.Ingress.Host
+		if wp.Spec.Ingress.TLS {
+			req.Header.Set("X-Forwarded-Proto", "https")
+		}
+	}
+
+	resp, err := versionClient.Do(req)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to request %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("unexpected status %d from %s", resp.StatusCode, url)
+	}
+
+	if poweredBy := resp.Header.Get("X-Powered-By"); strings.HasPrefix(poweredBy, "PHP/") {
+		phpVersion = strings.TrimPrefix(poweredBy, "PHP/")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read %s: %w", url, err)
+	}
+	if match := generatorPattern.FindSubmatch(body); match != nil {
+		wordpressVersion = string(match[1])
+	}
+
+	return wordpressVersion, phpVersion, nil
+}
@@ -0,0 +1,148 @@
+package wordpress
+
+import (
+	"slices"
+
+	corev1 "k8s.io/api/core/v1"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+)
+
+const (
+	// WPCliVolumeName is the volume the wp-cli container copies wp-cli from the toolbox image into
+	WPCliVolumeName = "wp-cli"
+	WPCliContainer  = "wp-cli"
+
+	wpCliMountPath = "/opt/kubepress/wp-cli"
+)
+
+// wpCliSetupScript installs wp-cli to /tmp/wp-cli
+// it is shared by all containers running wp-cli inside the WordPress image,
+// pods with a toolbox image get it from the wp-cli volume, the others download it from GitHub
+const wpCliSetupScript = `# Ensure wp-cli is installed
+if [ ! -f /tmp/wp-cli ]; then
+	if [ -f ` + wpCliMountPath + `/wp-cli ]; then
+		cp ` + wpCliMountPath + `/wp-cli /tmp/wp-cli
+	else
+		curl -s -O https://raw.githubusercontent.com/wp-cli/builds/gh-pages/phar/wp-cli.phar >/dev/null 2>&1
+		mv wp-cli.phar /tmp/wp-cli
+	fi
+	chmod +x /tmp/wp-cli >/dev/null 2>&1
+fi
+`
+
+// GetWPCliImage returns the toolbox image wp-cli is copied from, empty if it is downloaded
+func GetWPCliImage(wp *crmv1.WordPressSite) string {
+	if wp.Spec.WordPress.WPCliImage != "" {
+		return wp.Spec.WordPress.WPCliImage
+	}
+	return config.AppConfig.WPCliImage
+}
+
+// GetCoreSource returns where the WordPress core of the site comes from, Download or Image
+func GetCoreSource(wp *crmv1.WordPressSite) string {
+	if wp.Spec.WordPress.CoreSource != "" {
+		return wp.Spec.WordPress.CoreSource
+	}
+	return config.AppConfig.CoreSource
+}
+
+// buildWPCliPodSpec returns the pod spec of a job running wp-cli in the container against the site
+// the container gets the WordPress image, so wp-cli runs with the PHP version and extensions of the site,
+// and the volume of the site, whose wp-config.php points to the CA bundle when the database certificate is verified
+// wp-cli is copied from the toolbox image of the site if it has one
+func buildWPCliPodSpec(wp *crmv1.WordPressSite, container corev1.Container) corev1.PodSpec {
+	container.Image = wp.Spec.WordPress.Image
+	container.VolumeMounts = append([]corev1.VolumeMount{{Name: DefaultVolumeName, MountPath: "/var/www/html"}}, container.VolumeMounts...)
+
+	podSpec := corev1.PodSpec{
+		RestartPolicy: corev1.RestartPolicyNever,
+		Containers:    []corev1.Container{container},
+		Volumes: []corev1.Volume{
+			{
+				Name: DefaultVolumeName,
+				VolumeSource: corev1.VolumeSource{
+					PersistentVolumeClaim: &corev1.PersistentVolumeClaimVolumeSource{
+						ClaimName: GetPVCName(wp.Name),
+					},
+				},
+			},
+		},
+	}
+	setDatabaseCAVolume(&podSpec, wp)
+	setWPCliVolume(&podSpec, wp)
+
+	return podSpec
+}
+
+// setWPCliVolume adds an init container that copies wp-cli from the toolbox image of the site into a volume
+// mounted by all other containers of the pod, or removes them if wp-cli is downloaded
+// the init container comes first, so wp-cli is in place before any other container starts
+// returns true if the pod changed
+func setWPCliVolume(spec *corev1.PodSpec, wp *crmv1.WordPressSite) bool {
+	changed := false
+	image := GetWPCliImage(wp)
+
+	index := slices.IndexFunc(spec.InitContainers, func(c corev1.Container) bool { return c.Name == WPCliContainer })
+	switch {
+	case image == "" && index >= 0:
+		spec.InitContainers = slices.Delete(spec.InitContainers, index, index+1)
+		changed = true
+	case image != "" && index < 0:
+		spec.InitContainers = slices.Insert(spec.InitContainers, 0, corev1.Container{
+			Name:    WPCliContainer,
+			Image:   image,
+			Command: []string{"cp", config.AppConfig.WPCliPath, wpCliMountPath + "/wp-cli"},
+			VolumeMounts: []corev1.VolumeMount{
+				{Name: WPCliVolumeName, MountPath: wpCliMountPath},
+			},
+		})
+		changed = true
+	case image != "" && (spec.InitContainers[index].Image != image || spec.InitContainers[index].Command[1] != config.AppConfig.WPCliPath):
+		spec.InitContainers[index].Image = image
+		spec.InitContainers[index].Command = []string{"cp", config.AppConfig.WPCliPath, wpCliMountPath + "/wp-cli"}
+		changed = true
+	}
+
+	index = slices.IndexFunc(spec.Volumes, func(v corev1.Volume) bool { return v.Name == WPCliVolumeName })
+	switch {
+	case image == "" && index >= 0:
+		spec.Volumes = slices.Delete(spec.Volumes, index, index+1)
+		changed = true
+	case image != "" && index < 0:
+		spec.Volumes = append(spec.Volumes, corev1.Volume{
+			Name:         WPCliVolumeName,
+			VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}},
+		})
+		changed = true
+	}
+
+	setMount := func(container *corev1.Container) {
+		if container.Name == WPCliContainer {
+			return
+		}
+
+		index := slices.IndexFunc(container.VolumeMounts, func(m corev1.VolumeMount) bool { return m.Name == WPCliVolumeName })
+		switch {
+		case image == "" && index >= 0:
+			container.VolumeMounts = slices.Delete(container.VolumeMounts, index, index+1)
+			changed = true
+		case image != "" && index < 0:
+			container.VolumeMounts = append(container.VolumeMounts, corev1.VolumeMount{
+				Name:      WPCliVolumeName,
+				MountPath: wpCliMountPath,
+				ReadOnly:  true,
+			})
+			changed = true
+		}
+	}
+	for i := range spec.InitContainers {
+		setMount(&spec.InitContainers[i])
+	}
+	for i := range spec.Containers {
+		setMount(&spec.Containers[i])
+	}
+
+	return changed
+}
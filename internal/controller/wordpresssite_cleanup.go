@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+const (
+	// ConditionCleanup reports the progress of the cleanup while the site is deleted
+	ConditionCleanup = "Cleanup"
+)
+
+// finalizeSite cleans up the resources of a deleted site according to its deletion policy
+// returns true once the finalizer can be removed
+func (r *WordPressSiteReconciler) finalizeSite(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	policy := wp.Spec.DeletionPolicy
+	if policy == "" {
+		policy = crmv1.DeletionPolicyDelete
+	}
+
+	switch policy {
+	case crmv1.DeletionPolicyRetain:
+		if err := r.setCleanupCondition(ctx, wp, metav1.ConditionFalse, "RetainingResources", "Keeping the PVC and the database"); err != nil {
+			return false, err
+		}
+
+		if err := wordpress.OrphanResources(ctx, r.Client, wp); err != nil {
+			logger.Error(err, "Failed to retain resources")
+			return false, err
+		}
+
+	case crmv1.DeletionPolicySnapshot:
+		done, err := r.takeFinalSnapshot(ctx, wp)
+		if err != nil || !done {
+			return false, err
+		}
+
+		if done, err := r.deleteSiteResources(ctx, wp); err != nil || !done {
+			return false, err
+		}
+
+	default:
+		if done, err := r.deleteSiteResources(ctx, wp); err != nil || !done {
+			return false, err
+		}
+	}
+
+	if err := wordpress.CleanupSharedResources(ctx, r.Client, r.Scheme, wp); err != nil {
+		logger.Error(err, "Failed to clean up shared resources")
+		return false, err
+	}
+
+	// everything else is owned by the site and removed by the garbage collector
+	if err := r.setCleanupCondition(ctx, wp, metav1.ConditionTrue, "CleanupCompleted", fmt.Sprintf("Cleanup with deletion policy %s completed", policy)); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// deleteSiteResources removes the resources of the site that are not removed by the garbage collector
+func (r *WordPressSiteReconciler) deleteSiteResources(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	if err := r.setCleanupCondition(ctx, wp, metav1.ConditionFalse, "DeletingDatabase", "Removing the database, the database user and its grant"); err != nil {
+		return false, err
+	}
+
+	done, err := wordpress.CleanupDatabase(ctx, r.Client, wp)
+	if err != nil {
+		logger.Error(err, "Failed to clean up database")
+		return false, err
+	}
+	if !done {
+		return false, nil
+	}
+
+	if err := wordpress.CleanupAdminSecret(ctx, r.Client, wp); err != nil {
+		logger.Error(err, "Failed to clean up admin secret")
+		return false, err
+	}
+
+	return true, nil
+}
+
+// takeFinalSnapshot backs up the site before its resources are removed
+// returns true once the backup completed, a failed backup blocks the deletion
+// until the deletion policy is changed
+func (r *WordPressSiteReconciler) takeFinalSnapshot(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "cleanup")
+
+	// only emit the failure once, the cleanup is retried every few seconds
+	condition := meta.FindStatusCondition(wp.Status.Conditions, ConditionCleanup)
+	alreadyFailed := condition != nil && condition.Reason == "SnapshotFailed"
+
+	if wp.Spec.Backup == nil {
+		if !alreadyFailed {
+			r.Recorder.Event(wp, v1.EventTypeWarning, "SnapshotFailed", "Deletion policy Snapshot needs a backup configuration")
+		}
+		return false, r.setCleanupCondition(ctx, wp, metav1.ConditionFalse, "SnapshotFailed", "Deletion policy Snapshot needs a backup configuration, add one or change the deletion policy")
+	}
+
+	backupName := wordpress.GetFinalBackupName(wp.Name)
+
+	// backups are not owned by the site, so the final backup is kept after the deletion
+	backup := &crmv1.WordPressSiteBackup{}
+	err := r.Get(ctx, types.NamespacedName{Name: backupName, Namespace: wp.Namespace}, backup)
+	if errors.IsNotFound(err) {
+		backup = &crmv1.WordPressSiteBackup{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      backupName,
+				Namespace: wp.Namespace,
+				Labels: wordpress.GetBackupLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "backup-job",
+				}),
+			},
+			Spec: crmv1.WordPressSiteBackupSpec{
+				SiteName: wp.Name,
+			},
+		}
+
+		if err := r.Create(ctx, backup); err != nil {
+			logger.Error(err, "Failed to create final backup", "name", backupName)
+			return false, err
+		}
+
+		r.Recorder.Event(wp, v1.EventTypeNormal, "SnapshotStarted", fmt.Sprintf("Taking final backup %s", backupName))
+	} else if err != nil {
+		logger.Error(err, "Failed to get final backup", "name", backupName)
+		return false, err
+	}
+
+	switch backup.Status.Phase {
+	case BackupPhaseCompleted:
+		return true, nil
+	case BackupPhaseFailed:
+		if !alreadyFailed {
+			r.Recorder.Event(wp, v1.EventTypeWarning, "SnapshotFailed", backup.Status.Message)
+		}
+		return false, r.setCleanupCondition(ctx, wp, metav1.ConditionFalse, "SnapshotFailed",
+			fmt.Sprintf("Final backup %s failed, delete it to retry or change the deletion policy: %s", backupName, backup.Status.Message))
+	default:
+		return false, r.setCleanupCondition(ctx, wp, metav1.ConditionFalse, "TakingSnapshot", fmt.Sprintf("Waiting for final backup %s", backupName))
+	}
+}
+
+// setCleanupCondition sets the cleanup condition and updates the status if it changed
+func (r *WordPressSiteReconciler) setCleanupCondition(ctx context.Context, wp *crmv1.WordPressSite, status metav1.ConditionStatus, reason, message string) error {
+	for _, c := range wp.Status.Conditions {
+		if c.Type == ConditionCleanup && c.Status == status && c.Reason == reason && c.Message == message {
+			return nil
+		}
+	}
+
+	wordpress.SetCondition(wp, ConditionCleanup, status, reason, message)
+
+	return r.Status().Update(ctx, wp)
+}
@@ -0,0 +1,215 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+const (
+	// ConditionCloned tracks cloning a site from spec.cloneFrom
+	// it is missing until the clone was started
+	ConditionCloned = "Cloned"
+)
+
+// getCloneSource returns the namespaced name of the site to clone from
+func getCloneSource(wp *crmv1.WordPressSite) types.NamespacedName {
+	namespace := wp.Spec.CloneFrom.Namespace
+	if namespace == "" {
+		namespace = wp.Namespace
+	}
+
+	return types.NamespacedName{Name: wp.Spec.CloneFrom.Name, Namespace: namespace}
+}
+
+// validateCloneSource checks that the source site can be cloned
+// returns a message describing the problem, or an empty string if the source is fine
+func (r *WordPressSiteReconciler) validateCloneSource(ctx context.Context, wp *crmv1.WordPressSite) (string, error) {
+	sourceName := getCloneSource(wp)
+
+	source := &crmv1.WordPressSite{}
+	if err := r.Get(ctx, sourceName, source); err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Sprintf("Clone source %s does not exist", sourceName), nil
+		}
+		return "", err
+	}
+
+	if source.Status.DeploymentStatus != StatusWordPressReadyAndDeployed {
+		return fmt.Sprintf("Clone source %s is not ready and deployed (status: %s)", sourceName, source.Status.DeploymentStatus), nil
+	}
+
+	if source.Spec.Backup == nil {
+		return fmt.Sprintf("Clone source %s has no backup configuration, its backup target is needed to transfer the data", sourceName), nil
+	}
+
+	// the tables are copied as they are, so the clone needs the table prefix of the source
+	if prefix := source.GetDatabaseSettings().TablePrefix; prefix != wp.GetDatabaseSettings().TablePrefix {
+		return fmt.Sprintf("Clone source %s uses the table prefix %s, spec.database.tablePrefix must be the same", sourceName, prefix), nil
+	}
+
+	return "", nil
+}
+
+// reconcileClone copies the source site into the site
+// the data is transferred with an on-demand backup of the source, which is restored into the site
+// the site is kept scaled down until the restore finished
+func (r *WordPressSiteReconciler) reconcileClone(ctx context.Context, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "clone")
+
+	if wp.Spec.CloneFrom == nil {
+		return nil
+	}
+
+	cloneName := wordpress.GetCloneName(wp.Name)
+	condition := meta.FindStatusCondition(wp.Status.Conditions, ConditionCloned)
+
+	if condition == nil {
+		return r.startClone(ctx, wp)
+	}
+
+	// clone is finished, failed or skipped
+	if condition.Reason != "Cloning" {
+		return nil
+	}
+
+	restore := &crmv1.WordPressSiteRestore{}
+	if err := r.Get(ctx, types.NamespacedName{Name: cloneName, Namespace: wp.Namespace}, restore); err != nil {
+		if errors.IsNotFound(err) {
+			r.Recorder.Event(wp, v1.EventTypeWarning, "CloneFailed", "Clone restore was deleted")
+			wordpress.SetCondition(wp, ConditionCloned, metav1.ConditionFalse, "CloneFailed", "Clone restore was deleted")
+			return nil
+		}
+		logger.Error(err, "Failed to get clone restore", "name", cloneName)
+		return err
+	}
+
+	switch restore.Status.Phase {
+	case RestorePhaseCompleted:
+		r.Recorder.Event(wp, v1.EventTypeNormal, "CloneCompleted", fmt.Sprintf("Site cloned from %s", getCloneSource(wp)))
+		wordpress.SetCondition(wp, ConditionCloned, metav1.ConditionTrue, "Cloned", fmt.Sprintf("Site cloned from %s", getCloneSource(wp)))
+	case RestorePhaseFailed:
+		r.Recorder.Event(wp, v1.EventTypeWarning, "CloneFailed", restore.Status.Message)
+		wordpress.SetCondition(wp, ConditionCloned, metav1.ConditionFalse, "CloneFailed", restore.Status.Message)
+	default:
+		wordpress.SetCondition(wp, ConditionCloned, metav1.ConditionFalse, "Cloning", restore.Status.Message)
+	}
+
+	return nil
+}
+
+// startClone creates the backup of the source and the restore into the site
+func (r *WordPressSiteReconciler) startClone(ctx context.Context, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "clone")
+
+	cloneName := wordpress.GetCloneName(wp.Name)
+	sourceName := getCloneSource(wp)
+
+	// cloning only happens on creation, never overwrite a running site
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetResourceName(wp.Name), Namespace: wp.Namespace}, deployment)
+	if err == nil {
+		logger.Info("Site already exists, ignoring cloneFrom", "source", sourceName)
+		wordpress.SetCondition(wp, ConditionCloned, metav1.ConditionFalse, "CloneSkipped", "cloneFrom is only applied when the site is created")
+		return r.Status().Update(ctx, wp)
+	} else if !errors.IsNotFound(err) {
+		return err
+	}
+
+	source := &crmv1.WordPressSite{}
+	if err := r.Get(ctx, sourceName, source); err != nil {
+		logger.Error(err, "Failed to get clone source", "source", sourceName)
+		return err
+	}
+
+	// the restore jobs run in the namespace of the site, so they need their own copy of the backup target
+	sourceTargetSecret := &v1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: source.Spec.Backup.TargetSecretRef, Namespace: source.Namespace}, sourceTargetSecret); err != nil {
+		logger.Error(err, "Failed to get backup target secret of clone source", "name", source.Spec.Backup.TargetSecretRef)
+		return err
+	}
+
+	targetSecret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      wordpress.GetCloneTargetSecretName(wp.Name),
+			Namespace: wp.Namespace,
+		},
+	}
+	_, err = ctrl.CreateOrUpdate(ctx, r.Client, targetSecret, func() error {
+		targetSecret.Labels = wordpress.GetRestoreLabels(wp)
+		targetSecret.Data = sourceTargetSecret.Data
+		return controllerutil.SetControllerReference(wp, targetSecret, r.Scheme)
+	})
+	if err != nil {
+		logger.Error(err, "Failed to reconcile clone target secret")
+		return err
+	}
+
+	// the backup belongs to the source site and is pruned by its retention
+	backup := &crmv1.WordPressSiteBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cloneName,
+			Namespace: source.Namespace,
+			Labels: wordpress.GetBackupLabels(source, map[string]string{
+				"app.kubernetes.io/name": "backup-job",
+			}),
+		},
+		Spec: crmv1.WordPressSiteBackupSpec{
+			SiteName: source.Name,
+		},
+	}
+	if err := r.Create(ctx, backup); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create clone backup", "name", cloneName)
+		return err
+	}
+
+	// the restore waits for the backup to complete
+	restore := &crmv1.WordPressSiteRestore{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cloneName,
+			Namespace: wp.Namespace,
+			Labels:    wordpress.GetRestoreLabels(wp),
+		},
+		Spec: crmv1.WordPressSiteRestoreSpec{
+			SiteName:        wp.Name,
+			BackupName:      cloneName,
+			BackupNamespace: source.Namespace,
+			TargetSecretRef: targetSecret.Name,
+		},
+	}
+	if err := controllerutil.SetControllerReference(wp, restore, r.Scheme); err != nil {
+		logger.Error(err, "Unable to set owner reference to clone restore", "object", restore.GetName())
+		return err
+	}
+	if err := r.Create(ctx, restore); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create clone restore", "name", cloneName)
+		return err
+	}
+
+	// keep the deployment scaled down, so WordPress is not installed before the data is restored
+	if wp.Annotations == nil {
+		wp.Annotations = map[string]string{}
+	}
+	wp.Annotations[wordpress.RestoreInProgressAnnotation] = restore.Name
+	if err := r.Update(ctx, wp); err != nil {
+		logger.Error(err, "Failed to mark site as restoring")
+		return err
+	}
+
+	r.Recorder.Event(wp, v1.EventTypeNormal, "CloneStarted", fmt.Sprintf("Cloning site from %s", sourceName))
+	wordpress.SetCondition(wp, ConditionCloned, metav1.ConditionFalse, "Cloning", fmt.Sprintf("Cloning site from %s", sourceName))
+
+	return r.Status().Update(ctx, wp)
+}
@@ -2,28 +2,33 @@ package controller
 
 import (
 	"context"
-	"database/sql"
+	stderrors "errors"
 	"fmt"
 	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
 	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	networkingv1 "k8s.io/api/networking/v1"
 	"k8s.io/apimachinery/pkg/api/resource"
-	"strings"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
 	"hostzero.de/m/v2/internal/controller/wordpress"
+	"hostzero.de/m/v2/internal/dbprobe"
+	"hostzero.de/m/v2/internal/metrics"
 )
 
 // WordPressSite resources
@@ -33,6 +38,9 @@ import (
 //+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssites/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssites/finalizers,verbs=update
 
+// KubePressDefaults resources
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=kubepressdefaults,verbs=get;list;watch
+
 // Core API resources
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=networking.k8s.io,resources=ingresses/status,verbs=get;update;patch
@@ -50,12 +58,18 @@ import (
 // Job API resources (for Central PV cleanup)
 //+kubebuilder:rbac:groups=batch,resources=jobs,verbs=get;list;watch;create;update;patch;delete
 
+// CronJob API resources (for scheduled backups)
+//+kubebuilder:rbac:groups=batch,resources=cronjobs,verbs=get;list;watch;create;update;patch;delete
+
 // MariaDBDatabase resources (for managing the database)
 //+kubebuilder:rbac:groups=k8s.mariadb.com,resources=mariadbs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=k8s.mariadb.com,resources=databases,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=k8s.mariadb.com,resources=users,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=k8s.mariadb.com,resources=grants,verbs=get;list;watch;create;update;patch;delete
 
+// cert-manager resources, read for the CertificateIssued condition
+//+kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch
+
 const (
 	wordpressFinalizer = "crm.hostzero.de/finalizer"
 )
@@ -73,6 +87,9 @@ type WordPressSiteReconciler struct {
 	client.Client
 	Scheme   *runtime.Scheme
 	Recorder record.EventRecorder
+
+	// Prober runs the database probes of all sites, a default one is created if it is not set
+	Prober *dbprobe.Prober
 }
 
 // Reconcile handles the creation and management of WordPress site resources
@@ -106,9 +123,20 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		}
 
 		if wordpress.ContainsString(wp.ObjectMeta.Finalizers, wordpressFinalizer) {
+			// Clean up according to the deletion policy, requeue until it is done
+			done, err := r.finalizeSite(ctx, wp)
+			if err != nil {
+				logger.Error(err, "Failed to clean up WordPressSite")
+				return ctrl.Result{}, err
+			}
+			if !done {
+				return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+			}
+
 			// Remove finalizer from the list and update it
-			// Do any cleanup logic here if needed and remove finalizer when done
 			wp.ObjectMeta.Finalizers = wordpress.RemoveString(wp.ObjectMeta.Finalizers, wordpressFinalizer)
+			r.Prober.Forget(getProbeKey(wp))
+			metrics.DeleteDatabaseStats(wp.Namespace, wp.Name)
 			if err := r.Update(ctx, wp); err != nil {
 				return ctrl.Result{}, err
 			}
@@ -169,19 +197,41 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			logger.Info("Another WordPress site with the same host already exists, requeuing",
 				"host", wp.Spec.Ingress.Host, "name", existing.Items[0].Name)
 
-			// Set the status to validation failed
-			wp.Status.DeploymentStatus = StatusValidationFailed
-			wp.Status.Ready = false
+			return r.failValidation(ctx, wp, "DuplicateHost", fmt.Sprintf("Another WordPress site with the same host (%s) already exists", wp.Spec.Ingress.Host))
+		}
+	}
 
-			r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", fmt.Sprintf("Another WordPress site with the same host (%s) already exists", wp.Spec.Ingress.Host))
+	// check that all quantities can be parsed, invalid values would break the PVC and the deployment
+	if errs := wp.ValidateQuantities(); len(errs) > 0 {
+		logger.Info("WordPressSite contains invalid quantities, requeuing", "errors", errs.ToAggregate().Error())
 
-			if err := r.Status().Update(ctx, wp); err != nil {
-				logger.Error(err, "Failed to update WordPressSite status with validation failure")
-				return ctrl.Result{}, err
-			}
+		return r.failValidation(ctx, wp, "InvalidQuantity", fmt.Sprintf("Invalid quantities: %s", errs.ToAggregate().Error()))
+	}
 
-			return ctrl.Result{RequeueAfter: time.Second * 120}, nil
-		}
+	// the plugins and themes are passed to wp-cli as they are, conflicting sources would be guessed
+	if errs := wp.ValidateExtensions(); len(errs) > 0 {
+		logger.Info("WordPressSite contains invalid plugins or themes, requeuing", "errors", errs.ToAggregate().Error())
+
+		return r.failValidation(ctx, wp, "InvalidExtensions", fmt.Sprintf("Invalid plugins or themes: %s", errs.ToAggregate().Error()))
+	}
+
+	// the tables of an installed site keep their prefix, charset and collation
+	if errs := wp.ValidateDatabaseSettings(); len(errs) > 0 {
+		logger.Info("WordPressSite database settings changed after the installation, requeuing", "errors", errs.ToAggregate().Error())
+
+		return r.failValidation(ctx, wp, "DatabaseSettingsChanged", fmt.Sprintf("Database settings can't change after the installation: %s", errs.ToAggregate().Error()))
+	}
+
+	// resolve the resources with the defaults, the KubePressDefaults of the namespace can contain invalid quantities
+	kubePressDefaults, err := wordpress.GetKubePressDefaults(ctx, r.Client, wp.Namespace)
+	if err != nil {
+		logger.Error(err, "Failed to get KubePressDefaults")
+		return ctrl.Result{}, err
+	}
+	if _, err := wordpress.ResolveResources(wp, kubePressDefaults); err != nil {
+		logger.Info("WordPressSite resources can not be resolved, requeuing", "error", err.Error())
+
+		return r.failValidation(ctx, wp, "InvalidResources", fmt.Sprintf("Invalid resources: %s", err.Error()))
 	}
 
 	// check if the pvc is now smaller than before
@@ -189,7 +239,7 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 
 	// Check if central PVC exists
 	pvc := &v1.PersistentVolumeClaim{}
-	err := r.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: wp.Namespace}, pvc)
+	err = r.Get(ctx, types.NamespacedName{Name: pvcName, Namespace: wp.Namespace}, pvc)
 	if err != nil && !errors.IsNotFound(err) {
 		logger.Error(err, "Failed to get central PVC", "name", pvcName)
 		return ctrl.Result{}, err
@@ -199,20 +249,15 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	// if so, do not update and log a warning
 	if err == nil {
 		quantity := pvc.Spec.Resources.Requests[v1.ResourceStorage]
-		if quantity.Cmp(resource.MustParse(wp.Spec.WordPress.StorageSize)) == 1 {
-			logger.Info("Requested Storage Size is smaller than the current one. It's usually not possible to scale the PVC down. Setting Validation to failed.", "current", quantity, "requested", wp.Spec.WordPress.StorageSize)
-			// set a validation error on the WordPress resource
-			wp.Status.DeploymentStatus = StatusValidationFailed
-			wp.Status.Ready = false
-
-			r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", fmt.Sprintf("Requested Storage Size is smaller than the current one. It's usually not possible to scale the PVC down. Setting Validation to failed. current: %s, requested: %s", quantity.String(), wp.Spec.WordPress.StorageSize))
-
-			if err := r.Status().Update(ctx, wp); err != nil {
-				logger.Error(err, "Failed to update WordPressSite status with validation failure")
-				return ctrl.Result{}, err
-			}
+		requested, err := resource.ParseQuantity(wp.Spec.WordPress.StorageSize)
+		if err != nil {
+			logger.Info("WordPressSite contains an invalid storage size, requeuing", "error", err.Error())
 
-			return ctrl.Result{RequeueAfter: time.Second * 120}, nil
+			return r.failValidation(ctx, wp, "InvalidQuantity", fmt.Sprintf("Invalid storage size %q: %s", wp.Spec.WordPress.StorageSize, err.Error()))
+		}
+		if quantity.Cmp(requested) == 1 {
+			logger.Info("Requested Storage Size is smaller than the current one. It's usually not possible to scale the PVC down. Setting Validation to failed.", "current", quantity, "requested", wp.Spec.WordPress.StorageSize)
+			return r.failValidation(ctx, wp, "StorageShrink", fmt.Sprintf("Requested Storage Size is smaller than the current one. It's usually not possible to scale the PVC down. Setting Validation to failed. current: %s, requested: %s", quantity.String(), wp.Spec.WordPress.StorageSize))
 		}
 	}
 
@@ -225,18 +270,7 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		if errors.IsNotFound(err) {
 			logger.Info("Supplied secret not found, requeuing", "name", secretName, "namespace", wp.Namespace)
 
-			// Set the status to validation failed
-			wp.Status.DeploymentStatus = StatusValidationFailed
-			wp.Status.Ready = false
-
-			r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", "Supplied secret does not exist")
-
-			if err := r.Status().Update(ctx, wp); err != nil {
-				logger.Error(err, "Failed to update WordPressSite status with validation failure")
-				return ctrl.Result{}, err
-			}
-
-			return ctrl.Result{RequeueAfter: time.Second * 120}, nil
+			return r.failValidation(ctx, wp, "SecretNotFound", "Supplied secret does not exist")
 		}
 		logger.Error(err, "Failed to get database secret", "name", secretName, "namespace", wp.Namespace)
 		return ctrl.Result{}, err
@@ -246,35 +280,13 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	if _, ok := existingSecret.Data["username"]; !ok {
 		logger.Info("User supplied secret is missing 'username' field, requeuing", "name", secretName, "namespace", wp.Namespace)
 
-		// Set the status to validation failed
-		wp.Status.DeploymentStatus = StatusValidationFailed
-		wp.Status.Ready = false
-
-		r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", "Supplied secret is missing 'username' field")
-
-		if err := r.Status().Update(ctx, wp); err != nil {
-			logger.Error(err, "Failed to update WordPressSite status with validation failure")
-			return ctrl.Result{}, err
-		}
-
-		return ctrl.Result{RequeueAfter: time.Second * 120}, nil
+		return r.failValidation(ctx, wp, "SecretMissingUsername", "Supplied secret is missing 'username' field")
 	}
 
 	if _, ok := existingSecret.Data["password"]; !ok {
 		logger.Info("User supplied secret is missing 'password' field, requeuing", "name", secretName, "namespace", wp.Namespace)
 
-		// Set the status to validation failed
-		wp.Status.DeploymentStatus = StatusValidationFailed
-		wp.Status.Ready = false
-
-		r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", "Supplied secret is missing 'password' field")
-
-		if err := r.Status().Update(ctx, wp); err != nil {
-			logger.Error(err, "Failed to update WordPressSite status with validation failure")
-			return ctrl.Result{}, err
-		}
-
-		return ctrl.Result{RequeueAfter: time.Second * 120}, nil
+		return r.failValidation(ctx, wp, "SecretMissingPassword", "Supplied secret is missing 'password' field")
 	}
 
 	_, existsDatabaseHost := existingSecret.Data["databaseHost"]
@@ -290,18 +302,7 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 			if !existsDatabaseHost || !existsDatabase || !existsDatabaseUsername {
 				logger.Info("User supplied secret is missing one of the required database fields: 'databaseHost', 'database', 'databaseUsername'. Did you delete any field from the secret? This seams like corrupted data. Requeuing...", "name", secretName, "namespace", wp.Namespace)
 
-				// Set the status to validation failed
-				wp.Status.DeploymentStatus = StatusValidationFailed
-				wp.Status.Ready = false
-
-				r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", "Supplied secret is missing one of the required database fields: 'databaseHost', 'database', 'databaseUsername'")
-
-				if err := r.Status().Update(ctx, wp); err != nil {
-					logger.Error(err, "Failed to update WordPressSite status with validation failure")
-					return ctrl.Result{}, err
-				}
-
-				return ctrl.Result{RequeueAfter: time.Second * 120}, nil
+				return r.failValidation(ctx, wp, "SecretMissingDatabaseFields", "Supplied secret is missing one of the required database fields: 'databaseHost', 'database', 'databaseUsername'")
 			}
 		}
 	} else {
@@ -310,44 +311,145 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		if !existsDatabaseHost || !existsDatabase || !existsDatabaseUsername {
 			logger.Info("In case of using an existing database, the supplied secret must contain the following fields: 'databaseHost', 'database', 'databaseUsername'. Requeuing...", "name", secretName, "namespace", wp.Namespace)
 
-			// Set the status to validation failed
-			wp.Status.DeploymentStatus = StatusValidationFailed
-			wp.Status.Ready = false
+			return r.failValidation(ctx, wp, "SecretMissingDatabaseFields", "Supplied secret is missing one of the required database fields: 'databaseHost', 'database', 'databaseUsername'")
+		}
+	}
 
-			r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", "Supplied secret is missing one of the required database fields: 'databaseHost', 'database', 'databaseUsername'")
+	// whenever one of those fields exist, check whether the others also exist
 
-			if err := r.Status().Update(ctx, wp); err != nil {
-				logger.Error(err, "Failed to update WordPressSite status with validation failure")
-				return ctrl.Result{}, err
+	// the SSL mode only applies to existing databases, the managed database secret has none
+	if !wp.Spec.Database.CreateNew {
+		if err := dbprobe.ValidateSSLMode(string(existingSecret.Data["databaseSSLMode"])); err != nil {
+			logger.Info("Supplied secret has an invalid 'databaseSSLMode'. Requeuing...", "name", secretName, "namespace", wp.Namespace, "error", err.Error())
+
+			return r.failValidation(ctx, wp, "DatabaseSSLModeInvalid", fmt.Sprintf("Supplied secret has an invalid 'databaseSSLMode': %s", err.Error()))
+		}
+	}
+
+	// check that the CA bundle of the database exists and contains certificates
+	if wp.Spec.Database.CABundleSecretRef != "" {
+		caSecret := &v1.Secret{}
+		err = r.Get(ctx, types.NamespacedName{Name: wp.Spec.Database.CABundleSecretRef, Namespace: wp.Namespace}, caSecret)
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get database CA bundle secret", "name", wp.Spec.Database.CABundleSecretRef, "namespace", wp.Namespace)
+			return ctrl.Result{}, err
+		}
+
+		// a missing secret has no data, so this also covers a missing secret
+		if err := dbprobe.ValidateCA(caSecret.Data[wordpress.DatabaseCAKey]); err != nil {
+			logger.Info("Database CA bundle secret does not exist or has no certificate in 'ca.crt'. Requeuing...", "name", wp.Spec.Database.CABundleSecretRef, "namespace", wp.Namespace)
+
+			return r.failValidation(ctx, wp, "DatabaseCABundleInvalid", "Database CA bundle secret does not exist or has no PEM encoded certificate in 'ca.crt'")
+		}
+	}
+
+	// check that the backup target secret exists with all required fields
+	if wp.Spec.Backup != nil {
+		targetSecret := &v1.Secret{}
+		err = r.Get(ctx, types.NamespacedName{Name: wp.Spec.Backup.TargetSecretRef, Namespace: wp.Namespace}, targetSecret)
+		if err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to get backup target secret", "name", wp.Spec.Backup.TargetSecretRef, "namespace", wp.Namespace)
+			return ctrl.Result{}, err
+		}
+
+		// a missing secret has no data, so this also covers a missing secret
+		missingTargetField := false
+		for _, field := range []string{"endpoint", "bucket", "accessKey", "secretKey"} {
+			if _, ok := targetSecret.Data[field]; !ok {
+				missingTargetField = true
 			}
+		}
+
+		if missingTargetField {
+			logger.Info("Backup target secret does not exist or is missing one of the required fields: 'endpoint', 'bucket', 'accessKey', 'secretKey'. Requeuing...", "name", wp.Spec.Backup.TargetSecretRef, "namespace", wp.Namespace)
 
-			return ctrl.Result{RequeueAfter: time.Second * 120}, nil
+			return r.failValidation(ctx, wp, "BackupTargetInvalid", "Backup target secret does not exist or is missing one of the required fields: 'endpoint', 'bucket', 'accessKey', 'secretKey'")
 		}
 	}
 
-	// whenever one of those fields exist, check whether the others also exist
+	// check that the clone source can be cloned, only until the clone was started
+	if wp.Spec.CloneFrom != nil && meta.FindStatusCondition(wp.Status.Conditions, ConditionCloned) == nil {
+		message, err := r.validateCloneSource(ctx, wp)
+		if err != nil {
+			logger.Error(err, "Failed to validate clone source", "name", wp.Spec.CloneFrom.Name)
+			return ctrl.Result{}, err
+		}
+
+		if message != "" {
+			logger.Info("Clone source can not be cloned, requeuing", "reason", message)
+
+			return r.failValidation(ctx, wp, "CloneSourceInvalid", message)
+		}
+	}
+
+	// move an existing database into the managed cluster, before the database step provisions it
+	// and before the deployment is scaled down for the copy
+	migratingDatabase, err := r.reconcileDatabaseMigration(ctx, wp)
+	if err != nil {
+		logger.Error(err, "Failed to migrate the database into the managed cluster")
+		return ctrl.Result{}, err
+	}
 
 	// Add database reconciliation step - this must happen before deployment
 	// This will handle setting up the database resource name in status
-	if err := wordpress.ReconcileDatabase(ctx, r.Client, r.Scheme, wp); err != nil {
+	if err := metrics.TimeReconcileStep("database", func() error {
+		return wordpress.ReconcileDatabase(ctx, r.Client, r.Scheme, wp)
+	}); err != nil {
+		if stderrors.Is(err, wordpress.ErrMariaDBNotFound) {
+			logger.Info("Referenced MariaDB cluster does not exist, requeuing", "mariadb", wordpress.GetMariaDBRef(wp).String())
+
+			return r.failValidation(ctx, wp, "MariaDBNotFound", fmt.Sprintf("Referenced MariaDB cluster %s does not exist", wordpress.GetMariaDBRef(wp)))
+		}
+
 		logger.Error(err, "Failed to reconcile database")
 		return ctrl.Result{}, err
 	}
 
+	// read-only users are removed one object after another, the site is requeued until they are gone
+	readOnlyUsersDone := true
+	if err := metrics.TimeReconcileStep("readonlyusers", func() error {
+		var err error
+		readOnlyUsersDone, err = wordpress.ReconcileReadOnlyUsers(ctx, r.Client, r.Scheme, wp)
+		return err
+	}); err != nil {
+		logger.Error(err, "Failed to reconcile read-only database users")
+		return ctrl.Result{}, err
+	}
+
+	// rotate the database password before the deployment, so it rolls the pods right away
+	// requeueAfter collects the earliest time the site has to come back, starting with the rotation
+	requeueAfter, err := r.reconcilePasswordRotation(ctx, wp)
+	if err != nil {
+		logger.Error(err, "Failed to rotate database password")
+		return ctrl.Result{}, err
+	}
+
 	// Second, reconcile the ConfigMap for the WordPress site
-	if err := wordpress.ReconcileConfigMap(ctx, r.Client, r.Scheme, wp); err != nil {
+	if err := metrics.TimeReconcileStep("configmap", func() error {
+		return wordpress.ReconcileConfigMap(ctx, r.Client, r.Scheme, wp)
+	}); err != nil {
 		logger.Error(err, "Failed to reconcile ConfigMap")
 		return ctrl.Result{}, err
 	}
 
 	// Third, explicitly reconcile the PVC - this must happen before the deployment
-	if err := wordpress.ReconcilePVC(ctx, r.Client, r.Scheme, wp); err != nil {
+	if err := metrics.TimeReconcileStep("pvc", func() error {
+		return wordpress.ReconcilePVC(ctx, r.Client, r.Scheme, wp)
+	}); err != nil {
 		logger.Error(err, "Failed to reconcile PVC")
 		return ctrl.Result{}, err
 	}
 
+	// Clone the source site before the deployment is created, so WordPress is not installed on top of it
+	if err := r.reconcileClone(ctx, wp); err != nil {
+		logger.Error(err, "Failed to reconcile clone")
+		return ctrl.Result{}, err
+	}
+
 	// Fourth, reconcile the Deployment
-	if err := wordpress.ReconcileDeployment(ctx, r.Client, r.Scheme, wp); err != nil {
+	if err := metrics.TimeReconcileStep("deployment", func() error {
+		return wordpress.ReconcileDeployment(ctx, r.Client, r.Scheme, wp)
+	}); err != nil {
 		if errors.IsConflict(err) {
 			// Conflict detected, retry in a short while
 			logger.Info("Conflict detected during Deployment reconciliation, requeing")
@@ -357,8 +459,16 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	// The deployment reads the database credentials from the database secret now, drop them from the admin secret
+	if err := wordpress.MigrateAdminSecret(ctx, r.Client, wp); err != nil {
+		logger.Error(err, "Failed to remove the database keys from the admin secret")
+		return ctrl.Result{}, err
+	}
+
 	// Ensure SFTP deployment exists
-	if err := wordpress.ReconcileSFTPDeployment(ctx, r.Client, r.Scheme, wp, string(existingSecret.Data["username"])); err != nil {
+	if err := metrics.TimeReconcileStep("sftp", func() error {
+		return wordpress.ReconcileSFTPDeployment(ctx, r.Client, r.Scheme, wp, string(existingSecret.Data["username"]))
+	}); err != nil {
 		logger.Error(err, "Failed to reconcile SFTP Deployment")
 		return ctrl.Result{}, err
 	}
@@ -369,6 +479,18 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{}, err
 	}
 
+	// Ensure the backup CronJob matches the backup configuration
+	if err := wordpress.ReconcileBackupCronJob(ctx, r.Client, r.Scheme, wp); err != nil {
+		logger.Error(err, "Failed to reconcile backup CronJob")
+		return ctrl.Result{}, err
+	}
+
+	// Ensure the WP-Cron CronJob matches the cron configuration
+	if err := wordpress.ReconcileWPCronJob(ctx, r.Client, r.Scheme, wp); err != nil {
+		logger.Error(err, "Failed to reconcile WP-Cron CronJob")
+		return ctrl.Result{}, err
+	}
+
 	// Fifth, reconcile the Service
 	_, err = wordpress.ReconcileService(ctx, r.Client, r.Scheme, wp)
 	if err != nil {
@@ -377,7 +499,9 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 	}
 
 	// Finally, reconcile the Ingress
-	if err := wordpress.ReconcileIngress(ctx, r.Client, r.Scheme, wp); err != nil {
+	if err := metrics.TimeReconcileStep("ingress", func() error {
+		return wordpress.ReconcileIngress(ctx, r.Client, r.Scheme, wp)
+	}); err != nil {
 		logger.Error(err, "Failed to reconcile Ingress")
 		// Don't requeue immediately for Ingress errors to avoid constant loop
 		return ctrl.Result{RequeueAfter: time.Second * 30}, nil
@@ -395,9 +519,72 @@ func (r *WordPressSiteReconciler) Reconcile(ctx context.Context, req ctrl.Reques
 		return ctrl.Result{RequeueAfter: time.Second * 15}, nil
 	}
 
+	// the core is updated with wp-cli, which needs the installed site and the version it runs
+	updatingCore, err := r.reconcileCoreUpdate(ctx, wp)
+	if err != nil {
+		logger.Error(err, "Failed to update the WordPress core")
+		return ctrl.Result{}, err
+	}
+
+	// plugins and themes are installed with wp-cli as well, not at the same time as the core
+	reconcilingExtensions := false
+	if !updatingCore {
+		reconcilingExtensions, err = r.reconcileExtensions(ctx, wp)
+		if err != nil {
+			logger.Error(err, "Failed to reconcile plugins and themes")
+			return ctrl.Result{}, err
+		}
+	}
+
+	if !readOnlyUsersDone {
+		return ctrl.Result{RequeueAfter: time.Second * 5}, nil
+	}
+
+	if updatingCore || reconcilingExtensions {
+		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	}
+
+	if migratingDatabase {
+		return ctrl.Result{RequeueAfter: time.Second * 10}, nil
+	}
+
+	// come back for the next release check of the update policy
+	if wp.Spec.WordPress.CoreVersion == "" && wp.Spec.WordPress.UpdatePolicy != "" && wp.Spec.WordPress.UpdatePolicy != crmv1.CoreUpdatePolicyNone {
+		if requeueAfter <= 0 || config.AppConfig.CoreUpdateCheckInterval < requeueAfter {
+			requeueAfter = config.AppConfig.CoreUpdateCheckInterval
+		}
+	}
+
+	// come back to collect the database statistics of the ready site again
+	if interval := config.AppConfig.DatabaseStatsInterval; interval > 0 && (requeueAfter <= 0 || interval < requeueAfter) {
+		requeueAfter = interval
+	}
+
+	// come back for the earliest of the periodic checks, e.g. the next rotation of the database password
+	if requeueAfter > 0 {
+		return ctrl.Result{RequeueAfter: requeueAfter}, nil
+	}
+
 	return ctrl.Result{}, nil
 }
 
+// failValidation marks the site as failed validation, records the reason as event and metric
+// and requeues it, the user has to fix the spec or the referenced objects
+func (r *WordPressSiteReconciler) failValidation(ctx context.Context, wp *crmv1.WordPressSite, reason string, message string) (ctrl.Result, error) {
+	wp.Status.DeploymentStatus = StatusValidationFailed
+	wp.Status.Ready = false
+
+	r.Recorder.Event(wp, v1.EventTypeWarning, "ValidationFailed", message)
+	metrics.ValidationFailures.WithLabelValues(reason).Inc()
+
+	if err := r.Status().Update(ctx, wp); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to update WordPressSite status with validation failure")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{RequeueAfter: time.Second * 120}, nil
+}
+
 // updateStatus updates the status of the WordPressSite resource
 func (r *WordPressSiteReconciler) updateStatus(ctx context.Context, wp *crmv1.WordPressSite) error {
 	logger := log.FromContext(ctx)
@@ -437,11 +624,21 @@ func (r *WordPressSiteReconciler) updateStatus(ctx context.Context, wp *crmv1.Wo
 		installed, err := r.isWordPressInstalled(ctx, wp)
 		if err != nil {
 			logger.Error(err, "updateStatus: Failed to check if WordPressSite is installed")
+			wordpress.SetCondition(wp, ConditionInstallCompleted, metav1.ConditionUnknown, "DatabaseUnreachable", err.Error())
 		} else if installed {
 			// Emit event for installation detected
 			r.Recorder.Event(wp, v1.EventTypeNormal, "InstallationDetected", "WordPress installation detected")
+			wordpress.SetCondition(wp, ConditionInstallCompleted, metav1.ConditionTrue, "Installed", "The WordPress tables exist")
+			if wp.Status.DatabaseSettings == nil {
+				settings := wp.GetDatabaseSettings()
+				wp.Status.DatabaseSettings = &settings
+			}
 			status = StatusWordPressReady
+		} else {
+			wordpress.SetCondition(wp, ConditionInstallCompleted, metav1.ConditionFalse, "NotInstalled", "Waiting for the init container to install WordPress")
 		}
+	} else {
+		wordpress.SetCondition(wp, ConditionInstallCompleted, metav1.ConditionFalse, "ContainerNotReady", "Waiting for a ready WordPress container")
 	}
 
 	// Check if Ingress is ready
@@ -461,6 +658,12 @@ func (r *WordPressSiteReconciler) updateStatus(ctx context.Context, wp *crmv1.Wo
 		}
 	}
 
+	// The versions and the database statistics can only be read once WordPress is installed
+	if status == StatusWordPressReady || status == StatusWordPressReadyAndDeployed {
+		r.updateVersions(ctx, wp)
+		r.updateDatabaseStats(ctx, wp)
+	}
+
 	// Try to fetch MySQL version if it's not already set
 	if wp.Status.MySQLVersion == "" {
 		mysqlVersion, err := r.getMySQLVersionDirect(ctx, wp)
@@ -470,16 +673,31 @@ func (r *WordPressSiteReconciler) updateStatus(ctx context.Context, wp *crmv1.Wo
 	}
 
 	// Update the WordPress Ready condition based on our determination
-	if status == StatusWordPressReadyAndDeployed {
+	// the reason is the stage the site reached, the stage conditions tell what it is waiting for
+	switch status {
+	case StatusWordPressReadyAndDeployed:
 		wordpress.SetCondition(wp, "Ready", metav1.ConditionTrue, "Ready", "WordPress site is ready")
-	} else {
-		wordpress.SetCondition(wp, "Ready", metav1.ConditionFalse, "NotReady", "WordPress pod not found")
+	case StatusWordPressReady:
+		wordpress.SetCondition(wp, "Ready", metav1.ConditionFalse, status, "WordPress is installed, waiting for the ingress to be admitted")
+	case StatusContainerReady:
+		wordpress.SetCondition(wp, "Ready", metav1.ConditionFalse, status, "The WordPress container is ready, waiting for the installation")
+	default:
+		wordpress.SetCondition(wp, "Ready", metav1.ConditionFalse, "NotReady", "No ready WordPress pod found")
 	}
 
 	// Set the Ready status field - this directly updates the status.ready field in the CRD
 	wp.Status.DeploymentStatus = status
 	wp.Status.Ready = status == StatusWordPressReadyAndDeployed
 	wp.Status.LastReconcileTime = &metav1.Time{Time: time.Now()}
+	wp.Status.ObservedGeneration = wp.Generation
+
+	// record how long the first deployment took
+	if status == StatusWordPressReadyAndDeployed && wp.Status.ReadyTime == nil {
+		wp.Status.ReadyTime = wp.Status.LastReconcileTime
+		metrics.TimeToReady.Observe(wp.Status.ReadyTime.Sub(wp.CreationTimestamp.Time).Seconds())
+	}
+
+	r.updateComponentStatus(ctx, wp)
 
 	// Update the status
 	err := r.Status().Update(ctx, wp)
@@ -506,139 +724,92 @@ func (r *WordPressSiteReconciler) isIngressReady(ctx context.Context, wp *crmv1.
 	return false, nil
 }
 
-// getMySQLVersionDirect queries the MySQL version directly
-func (r *WordPressSiteReconciler) getMySQLVersionDirect(ctx context.Context, wp *crmv1.WordPressSite) (string, error) {
-	// Get database credentials from secret
-	dbSecretName := wp.Spec.AdminUserSecretKeyRef
+// getDatabaseCredentials reads the connection details of the site database from the database secret,
+// or from the admin secret for an existing database
+func (r *WordPressSiteReconciler) getDatabaseCredentials(ctx context.Context, wp *crmv1.WordPressSite) (dbprobe.Credentials, error) {
 	var dbSecret v1.Secret
-	err := r.Get(ctx, types.NamespacedName{Name: dbSecretName, Namespace: wp.Namespace}, &dbSecret)
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetDatabaseConnectionSecretName(wp), Namespace: wp.Namespace}, &dbSecret)
 	if err != nil {
-		return "", fmt.Errorf("failed to get database secret: %w", err)
+		return dbprobe.Credentials{}, fmt.Errorf("failed to get database secret: %w", err)
 	}
 
-	dbHost := string(dbSecret.Data["databaseHost"])
-	if dbHost == "" {
-		return "", fmt.Errorf("failed to get database host")
-	}
-	dbPort := int32(3306) // Default MySQL port
-	dbName := string(dbSecret.Data["database"])
-	if dbName == "" {
-		return "", fmt.Errorf("empty database name")
-	}
-	dbUser := string(dbSecret.Data["databaseUsername"])
-	if dbUser == "" {
-		return "", fmt.Errorf("empty database username")
-	}
-	password := string(dbSecret.Data["password"])
-	if password == "" {
-		return "", fmt.Errorf("empty database password")
+	creds, err := dbprobe.CredentialsFromSecret(&dbSecret)
+	if err != nil || wp.Spec.Database.CABundleSecretRef == "" {
+		return creds, err
 	}
 
-	//logger.V(1).Info("Connecting to MySQL database",
-	//	"host", dbHost,
-	//	"port", dbPort,
-	//	"user", dbUser,
-	//	"database", dbName)
-
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", dbUser, password, dbHost, dbPort, dbName)
-	db, err := sql.Open("mysql", dsn)
+	var caSecret v1.Secret
+	err = r.Get(ctx, types.NamespacedName{Name: wp.Spec.Database.CABundleSecretRef, Namespace: wp.Namespace}, &caSecret)
 	if err != nil {
-		return "", fmt.Errorf("failed to open MySQL connection: %w", err)
+		return creds, fmt.Errorf("failed to get database CA bundle secret: %w", err)
 	}
-	defer db.Close()
-
-	// Set a timeout for the query
-	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
+	creds.CA = caSecret.Data[wordpress.DatabaseCAKey]
 
-	// Test the connection
-	if err := db.PingContext(queryCtx); err != nil {
-		return "", fmt.Errorf("failed to ping MySQL server: %w", err)
-	}
+	return creds, nil
+}
 
-	// Query MySQL version
-	var version string
-	err = db.QueryRowContext(queryCtx, "SELECT VERSION()").Scan(&version)
+// getMySQLVersionDirect queries the MySQL version through the shared prober
+func (r *WordPressSiteReconciler) getMySQLVersionDirect(ctx context.Context, wp *crmv1.WordPressSite) (string, error) {
+	creds, err := r.getDatabaseCredentials(ctx, wp)
 	if err != nil {
-		return "", fmt.Errorf("failed to query MySQL version: %w", err)
+		return "", err
 	}
 
-	return version, nil
+	return r.Prober.ServerVersion(ctx, getProbeKey(wp), creds)
 }
 
-// Add this function after getMySQLVersionDirect
+// isWordPressInstalled checks through the shared prober whether the WordPress tables exist
 func (r *WordPressSiteReconciler) isWordPressInstalled(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
-	// Get database credentials from secret
-	dbSecretName := wp.Spec.AdminUserSecretKeyRef
-	var dbSecret v1.Secret
-	err := r.Get(ctx, types.NamespacedName{Name: dbSecretName, Namespace: wp.Namespace}, &dbSecret)
-	if err != nil {
-		return false, fmt.Errorf("failed to get database secret: %w", err)
-	}
-
-	dbHost := string(dbSecret.Data["databaseHost"])
-	if dbHost == "" {
-		return false, fmt.Errorf("failed to get database host")
-	}
-	dbPort := int32(3306) // Default MySQL port
-	dbName := string(dbSecret.Data["database"])
-	if dbName == "" {
-		return false, fmt.Errorf("empty database name")
-	}
-	dbUser := string(dbSecret.Data["databaseUsername"])
-	if dbUser == "" {
-		return false, fmt.Errorf("empty database username")
-	}
-	password := string(dbSecret.Data["password"])
-	if password == "" {
-		return false, fmt.Errorf("empty database password")
-	}
-
-	// Connect to database
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%d)/%s", dbUser, password, dbHost, dbPort, dbName)
-	db, err := sql.Open("mysql", dsn)
+	creds, err := r.getDatabaseCredentials(ctx, wp)
 	if err != nil {
-		return false, fmt.Errorf("failed to open MySQL connection: %w", err)
-	}
-	defer db.Close()
-
-	// Set a timeout for the query
-	queryCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	// Test the connection
-	if err := db.PingContext(queryCtx); err != nil {
-		return false, fmt.Errorf("failed to ping MySQL server: %w", err)
+		return false, err
 	}
 
-	// Check if wp_options table exists and has site_url option
-	var optionValue string
-	err = db.QueryRowContext(queryCtx,
-		"SELECT option_value FROM wp_options WHERE option_name = 'siteurl' LIMIT 1").Scan(&optionValue)
-
-	if err != nil {
-		if err == sql.ErrNoRows {
-			// Table exists but no siteurl option
-			return false, nil
-		}
-		// Check if the error indicates the table doesn't exist
-		if strings.Contains(err.Error(), "doesn't exist") {
-			// wp options table not found
-			return false, nil
-		}
-		return false, fmt.Errorf("failed to query WordPress installation status: %w", err)
-	}
+	return r.Prober.IsWordPressInstalled(ctx, getProbeKey(wp), creds, wp.GetDatabaseSettings().TablePrefix)
+}
 
-	return true, nil
+// getProbeKey identifies the site in the cache of the prober
+func getProbeKey(wp *crmv1.WordPressSite) string {
+	return fmt.Sprintf("%s/%s", wp.Namespace, wp.Name)
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *WordPressSiteReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Prober == nil {
+		r.Prober = dbprobe.NewProber(dbprobe.Options{})
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&crmv1.WordPressSite{}).
 		Owns(&appsv1.Deployment{}).
 		Owns(&v1.Service{}).
 		Owns(&networkingv1.Ingress{}).
 		Owns(&mariadbv1alpha1.Database{}).
+		Owns(&batchv1.Job{}).
+		// databases next to a MariaDB cluster in another namespace are not owned by the site
+		Watches(&mariadbv1alpha1.Database{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			labels := obj.GetLabels()
+			namespace := labels[wordpress.SiteNamespaceLabel]
+			if namespace == "" || namespace == obj.GetNamespace() {
+				return nil
+			}
+
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: labels["app.kubernetes.io/instance"], Namespace: namespace}}}
+		})).
+		Owns(&batchv1.CronJob{}).
+		Owns(&crmv1.WordPressSiteRestore{}).
+		// changed defaults apply to all sites of the namespace
+		Watches(&crmv1.KubePressDefaults{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			siteList := &crmv1.WordPressSiteList{}
+			if err := mgr.GetClient().List(ctx, siteList, client.InNamespace(obj.GetNamespace())); err != nil {
+				return nil
+			}
+
+			requests := make([]reconcile.Request, 0, len(siteList.Items))
+			for _, site := range siteList.Items {
+				requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: site.Name, Namespace: site.Namespace}})
+			}
+			return requests
+		})).
 		Complete(r)
 }
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// coreUpdateHistoryLimit is the number of finished core updates kept in the status
+const coreUpdateHistoryLimit = 10
+
+// reconcileCoreUpdate updates the WordPress core to the pinned coreVersion or the release the update policy allows
+// a backup is taken first, then a job runs wp core update and wp core update-db
+// returns true while an update is running
+func (r *WordPressSiteReconciler) reconcileCoreUpdate(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "core-update")
+
+	if update := wp.Status.CoreUpdate; update != nil {
+		switch update.Phase {
+		case crmv1.CoreUpdatePhaseBackingUp:
+			return true, r.backupBeforeCoreUpdate(ctx, wp)
+		case crmv1.CoreUpdatePhaseUpdating:
+			return true, r.updateCore(ctx, wp)
+		}
+	}
+
+	target, err := wordpress.GetCoreUpdateTarget(ctx, wp)
+	if err != nil {
+		// wordpress.org being unreachable must not block the site, the releases are requested again after the check interval
+		logger.Info("Failed to check for WordPress releases", "error", err.Error())
+		return false, nil
+	}
+	if target == "" {
+		return false, nil
+	}
+
+	if update := wp.Status.CoreUpdate; update != nil {
+		// the running site can report the old version for a moment, e.g. from a page cache
+		if update.Phase == crmv1.CoreUpdatePhaseCompleted && wordpress.CompareVersions(update.ToVersion, target) >= 0 {
+			return false, nil
+		}
+
+		// a failed update is tried again after the check interval
+		if update.Phase == crmv1.CoreUpdatePhaseFailed && update.ToVersion == target &&
+			update.CompletionTime != nil && time.Since(update.CompletionTime.Time) < config.AppConfig.CoreUpdateCheckInterval {
+			return false, nil
+		}
+	}
+
+	return true, r.startCoreUpdate(ctx, wp, target)
+}
+
+// startCoreUpdate creates the backup taken before the update
+func (r *WordPressSiteReconciler) startCoreUpdate(ctx context.Context, wp *crmv1.WordPressSite, target string) error {
+	logger := log.FromContext(ctx).WithValues("component", "core-update")
+
+	now := metav1.Now()
+	wp.Status.CoreUpdate = &crmv1.CoreUpdateStatus{
+		Phase:       crmv1.CoreUpdatePhaseBackingUp,
+		FromVersion: wp.Status.WordPressVersion,
+		ToVersion:   target,
+		StartTime:   &now,
+	}
+
+	// the backup is the way back if the update breaks the site
+	if wp.Spec.Backup == nil {
+		return r.finishCoreUpdate(ctx, wp, crmv1.CoreUpdatePhaseFailed, "The site needs a backup configuration for the backup taken before the update")
+	}
+
+	backupName := wordpress.GetCoreUpdateBackupName(wp.Name, now.Time)
+	backup := &crmv1.WordPressSiteBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      backupName,
+			Namespace: wp.Namespace,
+			Labels: wordpress.GetBackupLabels(wp, map[string]string{
+				"app.kubernetes.io/name": "backup-job",
+			}),
+		},
+		Spec: crmv1.WordPressSiteBackupSpec{
+			SiteName: wp.Name,
+		},
+	}
+	if err := r.Create(ctx, backup); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create backup before the core update", "name", backupName)
+		return err
+	}
+
+	message := fmt.Sprintf("Updating WordPress %s to %s, taking a backup first", wp.Status.WordPressVersion, target)
+	wp.Status.CoreUpdate.BackupName = backupName
+	wp.Status.CoreUpdate.Message = message
+
+	r.Recorder.Event(wp, v1.EventTypeNormal, "CoreUpdateStarted", message)
+
+	return r.Status().Update(ctx, wp)
+}
+
+// backupBeforeCoreUpdate waits for the backup and starts the update once it completed
+func (r *WordPressSiteReconciler) backupBeforeCoreUpdate(ctx context.Context, wp *crmv1.WordPressSite) error {
+	update := wp.Status.CoreUpdate
+
+	backup := &crmv1.WordPressSiteBackup{}
+	if err := r.Get(ctx, types.NamespacedName{Name: update.BackupName, Namespace: wp.Namespace}, backup); err != nil {
+		if errors.IsNotFound(err) {
+			return r.finishCoreUpdate(ctx, wp, crmv1.CoreUpdatePhaseFailed, "The backup taken before the update was deleted")
+		}
+		return err
+	}
+
+	switch backup.Status.Phase {
+	case BackupPhaseCompleted:
+		update.Phase = crmv1.CoreUpdatePhaseUpdating
+		update.Message = fmt.Sprintf("Updating WordPress to %s", update.ToVersion)
+		if err := r.Status().Update(ctx, wp); err != nil {
+			return err
+		}
+		return r.updateCore(ctx, wp)
+	case BackupPhaseFailed:
+		return r.finishCoreUpdate(ctx, wp, crmv1.CoreUpdatePhaseFailed, fmt.Sprintf("The backup taken before the update failed: %s", backup.Status.Message))
+	}
+
+	return nil
+}
+
+// updateCore runs the core update job and records its result
+func (r *WordPressSiteReconciler) updateCore(ctx context.Context, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "core-update")
+
+	update := wp.Status.CoreUpdate
+	jobName := wordpress.GetCoreUpdateJobName(wp.Name)
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: wp.Namespace}, job)
+	if errors.IsNotFound(err) {
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: wp.Namespace,
+				Labels: wordpress.GetCoreUpdateLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "core-update-job",
+				}),
+				Annotations: map[string]string{
+					wordpress.CoreVersionAnnotation: update.ToVersion,
+				},
+			},
+			Spec: wordpress.BuildCoreUpdateJobSpec(wp, update.ToVersion),
+		}
+
+		if err := controllerutil.SetControllerReference(wp, job, r.Scheme); err != nil {
+			logger.Error(err, "Unable to set owner reference to core update job", "object", job.GetName())
+			return err
+		}
+
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create core update job")
+			return err
+		}
+		return nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get core update job")
+		return err
+	}
+
+	// the job of an earlier update is still being removed
+	if !job.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	// the job of an earlier update is replaced
+	if job.Annotations[wordpress.CoreVersionAnnotation] != update.ToVersion || job.CreationTimestamp.Before(update.StartTime) {
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete earlier core update job")
+			return err
+		}
+		return nil
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			result, err := r.getCoreUpdateResult(ctx, job)
+			if err != nil {
+				logger.Error(err, "Failed to read core update result")
+				return r.finishCoreUpdate(ctx, wp, crmv1.CoreUpdatePhaseFailed, err.Error())
+			}
+
+			update.FromVersion = result.FromVersion
+			wp.Status.WordPressVersion = result.ToVersion
+			return r.finishCoreUpdate(ctx, wp, crmv1.CoreUpdatePhaseCompleted,
+				fmt.Sprintf("Updated WordPress %s to %s", result.FromVersion, result.ToVersion))
+		case batchv1.JobFailed:
+			return r.finishCoreUpdate(ctx, wp, crmv1.CoreUpdatePhaseFailed,
+				fmt.Sprintf("The update failed, restore the backup %s if the site is broken: %s", update.BackupName, condition.Message))
+		}
+	}
+
+	return nil
+}
+
+// getCoreUpdateResult reads the versions from the succeeded pod of the job
+func (r *WordPressSiteReconciler) getCoreUpdateResult(ctx context.Context, job *batchv1.Job) (*wordpress.CoreUpdateResult, error) {
+	podList := &v1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list core update pods: %w", err)
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == v1.PodSucceeded {
+			return wordpress.GetCoreUpdateResult(&pod)
+		}
+	}
+
+	return nil, fmt.Errorf("no succeeded pod found for core update job %s", job.Name)
+}
+
+// finishCoreUpdate records the outcome of the update and adds it to the history
+func (r *WordPressSiteReconciler) finishCoreUpdate(ctx context.Context, wp *crmv1.WordPressSite, phase string, message string) error {
+	now := metav1.Now()
+	update := wp.Status.CoreUpdate
+	update.Phase = phase
+	update.Message = message
+	update.CompletionTime = &now
+
+	wp.Status.CoreUpdateHistory = append(wp.Status.CoreUpdateHistory, *update.DeepCopy())
+	if len(wp.Status.CoreUpdateHistory) > coreUpdateHistoryLimit {
+		wp.Status.CoreUpdateHistory = wp.Status.CoreUpdateHistory[len(wp.Status.CoreUpdateHistory)-coreUpdateHistoryLimit:]
+	}
+
+	if phase == crmv1.CoreUpdatePhaseCompleted {
+		r.Recorder.Event(wp, v1.EventTypeNormal, "CoreUpdated", message)
+	} else {
+		r.Recorder.Event(wp, v1.EventTypeWarning, "CoreUpdateFailed", message)
+	}
+
+	return r.Status().Update(ctx, wp)
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// extensionsRetryInterval is the time after which a job with failed plugins or themes is run again
+const extensionsRetryInterval = 5 * time.Minute
+
+// reconcileExtensions installs, activates and prunes the plugins and themes of the site with a wp-cli job
+// the job runs whenever the plugins, themes or prune change, a job of an older spec is replaced once it finished
+// the hash of the spec is only recorded once all of them succeeded, failed ones are retried after extensionsRetryInterval
+// returns true while the job is running or waiting for the retry
+func (r *WordPressSiteReconciler) reconcileExtensions(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
+	logger := log.FromContext(ctx).WithValues("component", "extensions")
+
+	if !wordpress.HasExtensions(wp) {
+		// the plugins and themes that were dropped without prune are no longer managed
+		if len(wp.Status.Plugins) == 0 && len(wp.Status.Themes) == 0 && wp.Status.ExtensionsHash == "" {
+			return false, nil
+		}
+
+		wp.Status.Plugins = nil
+		wp.Status.Themes = nil
+		wp.Status.ExtensionsHash = ""
+		return false, r.Status().Update(ctx, wp)
+	}
+
+	hash := wordpress.GetExtensionsHash(wp)
+	if wp.Status.ExtensionsHash == hash {
+		return false, nil
+	}
+
+	jobName := wordpress.GetExtensionsJobName(wp.Name)
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: wp.Namespace}, job)
+	if errors.IsNotFound(err) {
+		spec, err := wordpress.BuildExtensionsJobSpec(wp)
+		if err != nil {
+			return false, err
+		}
+
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: wp.Namespace,
+				Labels: wordpress.GetExtensionsLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "extensions-job",
+				}),
+				Annotations: map[string]string{
+					wordpress.ExtensionsHashAnnotation: hash,
+				},
+			},
+			Spec: spec,
+		}
+
+		if err := controllerutil.SetControllerReference(wp, job, r.Scheme); err != nil {
+			logger.Error(err, "Unable to set owner reference to extensions job", "object", job.GetName())
+			return false, err
+		}
+
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create extensions job")
+			return false, err
+		}
+
+		logger.Info("Reconciling plugins and themes", "job", jobName)
+		return true, nil
+	} else if err != nil {
+		logger.Error(err, "Failed to get extensions job")
+		return false, err
+	}
+
+	// the job of an earlier spec is still being removed
+	if !job.DeletionTimestamp.IsZero() {
+		return true, nil
+	}
+
+	finished := false
+	var finishedAt time.Time
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete, batchv1.JobFailed:
+			finished = true
+			finishedAt = condition.LastTransitionTime.Time
+		}
+
+		// a job of an older spec is replaced, its result is outdated, the result of a failed job is only recorded once
+		if job.Annotations[wordpress.ExtensionsHashAnnotation] != hash || job.Annotations[wordpress.ExtensionsRecordedAnnotation] != "" {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			result, err := r.getExtensionsResult(ctx, job)
+			if err != nil {
+				logger.Error(err, "Failed to read extensions result")
+				err = r.failExtensions(ctx, wp, err.Error())
+			} else {
+				err = r.completeExtensions(ctx, wp, hash, result)
+			}
+			if err != nil || wp.Status.ExtensionsHash == hash {
+				return false, err
+			}
+			return true, r.markExtensionsRecorded(ctx, job)
+		case batchv1.JobFailed:
+			if err := r.failExtensions(ctx, wp, condition.Message); err != nil {
+				return false, err
+			}
+			return true, r.markExtensionsRecorded(ctx, job)
+		}
+	}
+
+	// a job of the current spec failed for some plugins or themes, it is run again after the retry interval
+	if finished && job.Annotations[wordpress.ExtensionsHashAnnotation] == hash && time.Since(finishedAt) < extensionsRetryInterval {
+		return true, nil
+	}
+
+	// wp-cli is not interrupted, the plugins and themes of the new spec are installed afterwards
+	if finished {
+		if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+			logger.Error(err, "Failed to delete outdated extensions job")
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// markExtensionsRecorded marks the job as recorded, so its failures are reported once while it waits for the retry
+func (r *WordPressSiteReconciler) markExtensionsRecorded(ctx context.Context, job *batchv1.Job) error {
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[wordpress.ExtensionsRecordedAnnotation] = "true"
+
+	return r.Update(ctx, job)
+}
+
+// getExtensionsResult reads the plugins and themes from the succeeded pod of the job
+func (r *WordPressSiteReconciler) getExtensionsResult(ctx context.Context, job *batchv1.Job) (*wordpress.ExtensionsResult, error) {
+	podList := &v1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list extensions pods: %w", err)
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == v1.PodSucceeded {
+			return wordpress.GetExtensionsResult(&pod)
+		}
+	}
+
+	return nil, fmt.Errorf("no succeeded pod found for extensions job %s", job.Name)
+}
+
+// completeExtensions records the plugins and themes the job reported
+// the source is only recorded for installed ones, so a failed archive is installed again by the next job
+// the hash is only recorded if none of them failed, otherwise the job is run again
+func (r *WordPressSiteReconciler) completeExtensions(ctx context.Context, wp *crmv1.WordPressSite, hash string, result *wordpress.ExtensionsResult) error {
+	failed := []string{}
+
+	merge := func(reported []crmv1.ExtensionStatus, extensions []crmv1.Extension, previous []crmv1.ExtensionStatus) []crmv1.ExtensionStatus {
+		sources := map[string]string{}
+		for _, status := range previous {
+			sources[status.Slug] = status.Source
+		}
+
+		for i := range reported {
+			status := &reported[i]
+			if status.Error != "" {
+				failed = append(failed, status.Slug)
+				status.Source = sources[status.Slug]
+				continue
+			}
+			for _, extension := range extensions {
+				if extension.Slug == status.Slug {
+					status.Source = wordpress.GetExtensionSource(extension)
+				}
+			}
+		}
+		return reported
+	}
+
+	wp.Status.Plugins = merge(result.Plugins, wp.Spec.WordPress.Plugins, wp.Status.Plugins)
+	wp.Status.Themes = merge(result.Themes, wp.Spec.WordPress.Themes, wp.Status.Themes)
+
+	if len(failed) > 0 {
+		r.Recorder.Event(wp, v1.EventTypeWarning, "ExtensionsFailed",
+			fmt.Sprintf("Failed to reconcile %s, see the status for details", strings.Join(failed, ", ")))
+	} else {
+		wp.Status.ExtensionsHash = hash
+		r.Recorder.Event(wp, v1.EventTypeNormal, "ExtensionsReconciled",
+			fmt.Sprintf("Reconciled %d plugins and %d themes", len(wp.Status.Plugins), len(wp.Status.Themes)))
+	}
+
+	return r.Status().Update(ctx, wp)
+}
+
+// failExtensions marks all plugins and themes of the spec as failed, the job could not run wp-cli
+// dropped ones are kept to be pruned by the next job
+func (r *WordPressSiteReconciler) failExtensions(ctx context.Context, wp *crmv1.WordPressSite, message string) error {
+	fail := func(extensions []crmv1.Extension, previous []crmv1.ExtensionStatus) []crmv1.ExtensionStatus {
+		remaining := map[string]crmv1.ExtensionStatus{}
+		for _, status := range previous {
+			remaining[status.Slug] = status
+		}
+
+		statuses := make([]crmv1.ExtensionStatus, 0, len(extensions))
+		for _, extension := range extensions {
+			status, ok := remaining[extension.Slug]
+			if !ok {
+				status = crmv1.ExtensionStatus{Slug: extension.Slug}
+			}
+			delete(remaining, extension.Slug)
+
+			status.Error = message
+			statuses = append(statuses, status)
+		}
+
+		if wp.Spec.WordPress.Prune {
+			for _, status := range previous {
+				if _, dropped := remaining[status.Slug]; dropped {
+					statuses = append(statuses, status)
+				}
+			}
+		}
+		return statuses
+	}
+
+	wp.Status.Plugins = fail(wp.Spec.WordPress.Plugins, wp.Status.Plugins)
+	wp.Status.Themes = fail(wp.Spec.WordPress.Themes, wp.Status.Themes)
+
+	r.Recorder.Event(wp, v1.EventTypeWarning, "ExtensionsFailed", fmt.Sprintf("Failed to reconcile plugins and themes: %s", message))
+
+	return r.Status().Update(ctx, wp)
+}
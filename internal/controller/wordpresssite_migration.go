@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// reconcileDatabaseMigration moves the existing database of the site into the managed MariaDB cluster
+// ReconcileDatabase provisions the managed database, WordPress is scaled down while the data is copied,
+// then the site is switched to the managed database, a failed copy is rolled back
+// returns true while the migration is running
+func (r *WordPressSiteReconciler) reconcileDatabaseMigration(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
+	migration := wp.Status.DatabaseMigration
+
+	if wp.Spec.Database.CreateNew {
+		// the site was switched, but the phase was not recorded
+		if migration != nil && migration.Phase == crmv1.DatabaseMigrationPhaseSwitching {
+			return false, r.completeDatabaseMigration(ctx, wp)
+		}
+		return false, nil
+	}
+
+	if !wp.Spec.Database.MigrateToManaged {
+		if migration == nil {
+			return false, nil
+		}
+
+		switch migration.Phase {
+		case crmv1.DatabaseMigrationPhaseFailed, crmv1.DatabaseMigrationPhaseCompleted:
+			// the migration can be started again
+			return false, r.resetDatabaseMigration(ctx, wp)
+		case crmv1.DatabaseMigrationPhaseRollingBack:
+		default:
+			r.Recorder.Event(wp, v1.EventTypeWarning, "DatabaseMigrationCancelled", "migrateToManaged was unset, rolling back the migration")
+			return true, r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseRollingBack, "The migration was cancelled")
+		}
+	}
+
+	if migration == nil {
+		return true, r.startDatabaseMigration(ctx, wp)
+	}
+
+	switch migration.Phase {
+	case crmv1.DatabaseMigrationPhaseProvisioning:
+		ready, err := wordpress.IsManagedDatabaseReady(ctx, r.Client, wp)
+		if err != nil || !ready {
+			return true, err
+		}
+		return true, r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseImporting, "Waiting for WordPress to scale down")
+	case crmv1.DatabaseMigrationPhaseImporting:
+		return true, r.importDatabase(ctx, wp)
+	case crmv1.DatabaseMigrationPhaseSwitching:
+		return false, r.switchDatabase(ctx, wp)
+	case crmv1.DatabaseMigrationPhaseRollingBack:
+		return r.rollbackDatabaseMigration(ctx, wp)
+	}
+
+	return false, nil
+}
+
+// startDatabaseMigration records the start of the migration, ReconcileDatabase provisions the managed database from now on
+func (r *WordPressSiteReconciler) startDatabaseMigration(ctx context.Context, wp *crmv1.WordPressSite) error {
+	now := metav1.Now()
+	message := fmt.Sprintf("Provisioning the database in the MariaDB cluster %s", wordpress.GetMariaDBRef(wp))
+	wp.Status.DatabaseMigration = &crmv1.DatabaseMigrationStatus{
+		Phase:     crmv1.DatabaseMigrationPhaseProvisioning,
+		Message:   message,
+		StartTime: &now,
+	}
+
+	r.Recorder.Event(wp, v1.EventTypeNormal, "DatabaseMigrationStarted", message)
+
+	return r.Status().Update(ctx, wp)
+}
+
+// importDatabase copies the existing database into the managed one once WordPress is scaled down
+func (r *WordPressSiteReconciler) importDatabase(ctx context.Context, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "database-migration")
+
+	// writes after the dump started would be lost
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetResourceName(wp.Name), Namespace: wp.Namespace}, deployment)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get Deployment")
+		return err
+	}
+	if err == nil && deployment.Status.Replicas > 0 {
+		return r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseImporting, "Waiting for WordPress to scale down")
+	}
+
+	job := &batchv1.Job{}
+	err = r.Get(ctx, types.NamespacedName{Name: wordpress.GetDatabaseMigrationJobName(wp.Name), Namespace: wp.Namespace}, job)
+	if errors.IsNotFound(err) {
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      wordpress.GetDatabaseMigrationJobName(wp.Name),
+				Namespace: wp.Namespace,
+				Labels: wordpress.GetDatabaseLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "database-migration-job",
+				}),
+			},
+			Spec: wordpress.BuildDatabaseMigrationJobSpec(wp),
+		}
+
+		if err := controllerutil.SetControllerReference(wp, job, r.Scheme); err != nil {
+			logger.Error(err, "Unable to set owner reference to database migration job", "object", job.GetName())
+			return err
+		}
+
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create database migration job")
+			return err
+		}
+
+		return r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseImporting, "Copying the database")
+	} else if err != nil {
+		logger.Error(err, "Failed to get database migration job")
+		return err
+	}
+
+	// the job of an earlier attempt is still being removed
+	if !job.DeletionTimestamp.IsZero() {
+		return nil
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseSwitching, "Switching the site to the managed database")
+		case batchv1.JobFailed:
+			message := fmt.Sprintf("Copying the database failed: %s", condition.Message)
+			r.Recorder.Event(wp, v1.EventTypeWarning, "DatabaseMigrationFailed", message)
+			return r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseRollingBack, message)
+		}
+	}
+
+	return r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseImporting, "Copying the database")
+}
+
+// switchDatabase makes the site create its database, so the deployment reads the connection from the database secret
+// and rolls the pods, the database keys are removed from the admin secret afterwards
+func (r *WordPressSiteReconciler) switchDatabase(ctx context.Context, wp *crmv1.WordPressSite) error {
+	logger := log.FromContext(ctx).WithValues("component", "database-migration")
+
+	wp.Spec.Database.CreateNew = true
+	wp.Spec.Database.MigrateToManaged = false
+	if err := r.Update(ctx, wp); err != nil {
+		logger.Error(err, "Failed to switch the site to the managed database")
+		return err
+	}
+
+	return r.completeDatabaseMigration(ctx, wp)
+}
+
+// completeDatabaseMigration records that the site uses the managed database
+func (r *WordPressSiteReconciler) completeDatabaseMigration(ctx context.Context, wp *crmv1.WordPressSite) error {
+	now := metav1.Now()
+	message := fmt.Sprintf("The site uses the database in the MariaDB cluster %s", wordpress.GetMariaDBRef(wp))
+	wp.Status.DatabaseMigration.CompletionTime = &now
+
+	r.Recorder.Event(wp, v1.EventTypeNormal, "DatabaseMigrated", message)
+
+	return r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseCompleted, message)
+}
+
+// rollbackDatabaseMigration removes the managed database again, the site keeps using the existing one
+// returns true until the managed database is gone
+func (r *WordPressSiteReconciler) rollbackDatabaseMigration(ctx context.Context, wp *crmv1.WordPressSite) (bool, error) {
+	done, err := wordpress.RollbackDatabaseMigration(ctx, r.Client, wp)
+	if err != nil || !done {
+		return true, err
+	}
+
+	// the cluster is chosen again by the next migration
+	now := metav1.Now()
+	wp.Status.MariaDBRef = nil
+	wp.Status.DatabaseMigration.CompletionTime = &now
+
+	// the message tells why the migration was rolled back
+	return false, r.setDatabaseMigrationPhase(ctx, wp, crmv1.DatabaseMigrationPhaseFailed, wp.Status.DatabaseMigration.Message)
+}
+
+// resetDatabaseMigration removes the finished migration from the status together with its job
+func (r *WordPressSiteReconciler) resetDatabaseMigration(ctx context.Context, wp *crmv1.WordPressSite) error {
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: wordpress.GetDatabaseMigrationJobName(wp.Name), Namespace: wp.Namespace}}
+	if err := r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		return err
+	}
+
+	wp.Status.DatabaseMigration = nil
+
+	return r.Status().Update(ctx, wp)
+}
+
+// setDatabaseMigrationPhase updates the phase and message of the migration
+func (r *WordPressSiteReconciler) setDatabaseMigrationPhase(ctx context.Context, wp *crmv1.WordPressSite, phase string, message string) error {
+	migration := wp.Status.DatabaseMigration
+	if migration.Phase == phase && migration.Message == message {
+		return nil
+	}
+
+	migration.Phase = phase
+	migration.Message = message
+
+	return r.Status().Update(ctx, wp)
+}
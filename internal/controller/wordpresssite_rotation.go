@@ -0,0 +1,103 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// rotationPollInterval is how often a rotation in progress checks the new database user and the rollout of the pods
+const rotationPollInterval = 10 * time.Second
+
+// reconcilePasswordRotation rotates the database password when the interval passed or the annotation asks for it
+// the site is switched to a new database user once it is ready, the previous user keeps the old password
+// until all pods were rolled, so no pod loses the connection to the database
+// returns the time until the next step of the rotation or the next scheduled rotation, zero if there is none
+func (r *WordPressSiteReconciler) reconcilePasswordRotation(ctx context.Context, wp *crmv1.WordPressSite) (time.Duration, error) {
+	logger := log.FromContext(ctx).WithValues("component", "database-rotation")
+
+	rotation := wp.Status.PasswordRotation
+	if rotation == nil {
+		due, next := wordpress.GetPasswordRotationDue(wp, time.Now())
+		if !due {
+			return next, nil
+		}
+
+		var err error
+		rotation, err = wordpress.NewPasswordRotation(ctx, r.Client, wp)
+		if err != nil || rotation == nil {
+			// the database user is not there yet, it gets the current password
+			return 0, err
+		}
+
+		wp.Status.PasswordRotation = rotation
+		if err := r.Status().Update(ctx, wp); err != nil {
+			logger.Error(err, "Failed to record the rotation in the WordPressSite status")
+			return 0, err
+		}
+	}
+
+	if rotation.SwitchTime == nil {
+		ready, err := wordpress.ReconcileRotationUser(ctx, r.Client, r.Scheme, wp)
+		if err != nil || !ready {
+			return rotationPollInterval, err
+		}
+
+		if err := wordpress.SwitchDatabaseUser(ctx, r.Client, r.Scheme, wp); err != nil {
+			return 0, err
+		}
+
+		// the time of the switch rolls the pods
+		now := metav1.Now()
+		rotation.SwitchTime = &now
+		wp.Status.LastRotationTime = &now
+		if err := r.Status().Update(ctx, wp); err != nil {
+			logger.Error(err, "Failed to record the switch to the new database user in the WordPressSite status")
+			return 0, err
+		}
+
+		r.Recorder.Event(wp, v1.EventTypeNormal, "DatabaseUserSwitched",
+			fmt.Sprintf("Switched to database user %s with a new password, rolling the WordPress pods", rotation.Username))
+
+		if _, ok := wp.Annotations[wordpress.RotateDatabasePasswordAnnotation]; ok {
+			delete(wp.Annotations, wordpress.RotateDatabasePasswordAnnotation)
+			if err := r.Update(ctx, wp); err != nil {
+				logger.Error(err, "Failed to remove the rotation annotation")
+				return 0, err
+			}
+		}
+
+		return rotationPollInterval, nil
+	}
+
+	rolledOut, err := wordpress.IsRotationRolledOut(ctx, r.Client, wp)
+	if err != nil || !rolledOut {
+		return rotationPollInterval, err
+	}
+
+	removed, err := wordpress.RemovePreviousDatabaseUser(ctx, r.Client, wp)
+	if err != nil || !removed {
+		return rotationPollInterval, err
+	}
+
+	r.Recorder.Event(wp, v1.EventTypeNormal, "PasswordRotated",
+		fmt.Sprintf("Removed database user %s, both users were valid for %s after the switch",
+			rotation.PreviousUsername, time.Since(rotation.SwitchTime.Time).Round(time.Second)))
+	logger.Info("Rotated database password", "username", rotation.Username, "previous", rotation.PreviousUsername)
+
+	wp.Status.PasswordRotation = nil
+	if err := r.Status().Update(ctx, wp); err != nil {
+		logger.Error(err, "Failed to record the rotation in the WordPressSite status")
+		return 0, err
+	}
+
+	_, next := wordpress.GetPasswordRotationDue(wp, time.Now())
+	return next, nil
+}
@@ -0,0 +1,405 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+	"hostzero.de/m/v2/internal/metrics"
+)
+
+// Conditions for the stages of a site, updated on each reconciliation
+// the reasons are taken from the owned objects, so it is visible which stage blocks the site
+const (
+	ConditionDatabaseProvisioned = "DatabaseProvisioned"
+	ConditionStorageBound        = "StorageBound"
+	ConditionDeploymentAvailable = "DeploymentAvailable"
+	ConditionInstallCompleted    = "InstallCompleted"
+	ConditionSFTPAvailable       = "SFTPAvailable"
+	ConditionIngressAdmitted     = "IngressAdmitted"
+	ConditionCertificateIssued   = "CertificateIssued"
+)
+
+// certificateGVK is the cert-manager Certificate created for the ingress, it is read unstructured
+// so the operator does not depend on the cert-manager API
+var certificateGVK = schema.GroupVersionKind{Group: "cert-manager.io", Version: "v1", Kind: "Certificate"}
+
+// Values of status.databaseStatus
+const (
+	DatabaseStatusReady        = "Ready"        // the MariaDB database is ready
+	DatabaseStatusProvisioning = "Provisioning" // the MariaDB database is created but not ready yet
+	DatabaseStatusNotFound     = "NotFound"     // the MariaDB database does not exist
+	DatabaseStatusExternal     = "External"     // the database is not managed by the operator
+)
+
+// databaseStatsTables is the number of largest tables reported in status.database
+const databaseStatsTables = 10
+
+// updateComponentStatus fills in the URL, the database status, the SFTP endpoint, the earliest recoverable time,
+// the last WP-Cron run and the conditions of the stages of the site, InstallCompleted is set by updateStatus
+// errors are logged, a component that can not be read is reported with reason Unknown
+func (r *WordPressSiteReconciler) updateComponentStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	wp.Status.URL = wordpress.GetSiteUrl(wp)
+
+	r.updateDatabaseStatus(ctx, wp)
+	r.updateStorageStatus(ctx, wp)
+	r.updateDeploymentStatus(ctx, wp)
+	r.updateSFTPStatus(ctx, wp)
+	r.updateIngressStatus(ctx, wp)
+	r.updateCertificateStatus(ctx, wp)
+	r.updateRecoverableTime(ctx, wp)
+	r.updateCronStatus(ctx, wp)
+}
+
+// updateDatabaseStatus reports the readiness of the MariaDB database of the site
+func (r *WordPressSiteReconciler) updateDatabaseStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	if !wp.Spec.Database.CreateNew {
+		wp.Status.DatabaseStatus = DatabaseStatusExternal
+		wordpress.SetCondition(wp, ConditionDatabaseProvisioned, metav1.ConditionTrue, "External", "The database is provided by the user")
+		return
+	}
+
+	mariaDBRef := wordpress.GetMariaDBRef(wp)
+	database := &mariadbv1alpha1.Database{}
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetDatabaseResourceName(wp, mariaDBRef), Namespace: mariaDBRef.Namespace}, database)
+	switch {
+	case errors.IsNotFound(err):
+		wp.Status.DatabaseStatus = DatabaseStatusNotFound
+		wordpress.SetCondition(wp, ConditionDatabaseProvisioned, metav1.ConditionFalse, "NotFound", "The MariaDB database does not exist")
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get MariaDB database")
+		wordpress.SetCondition(wp, ConditionDatabaseProvisioned, metav1.ConditionUnknown, "Unknown", err.Error())
+	default:
+		// take over the reason and message of the MariaDB operator
+		reason, message := "Provisioning", "Waiting for the MariaDB database"
+		if ready := meta.FindStatusCondition(database.Status.Conditions, mariadbv1alpha1.ConditionTypeReady); ready != nil {
+			reason, message = ready.Reason, ready.Message
+		}
+
+		if database.IsReady() {
+			wp.Status.DatabaseStatus = DatabaseStatusReady
+			wordpress.SetCondition(wp, ConditionDatabaseProvisioned, metav1.ConditionTrue, reason, message)
+		} else {
+			wp.Status.DatabaseStatus = DatabaseStatusProvisioning
+			wordpress.SetCondition(wp, ConditionDatabaseProvisioned, metav1.ConditionFalse, reason, message)
+		}
+	}
+}
+
+// updateRecoverableTime reports the earliest time the database can be restored to with a point-in-time restore
+func (r *WordPressSiteReconciler) updateRecoverableTime(ctx context.Context, wp *crmv1.WordPressSite) {
+	earliest, err := getEarliestRecoverableTime(ctx, r.Client, wp)
+	if err != nil {
+		log.FromContext(ctx).Error(err, "Failed to get the earliest recoverable time")
+		return
+	}
+
+	wp.Status.EarliestRecoverableTime = earliest
+}
+
+// updateCronStatus reports the last runs of the WP-Cron CronJob, the state of the newest run is taken from its job
+func (r *WordPressSiteReconciler) updateCronStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	if !wordpress.IsKubernetesCron(wp) {
+		wp.Status.Cron = nil
+		return
+	}
+
+	cronJob := &batchv1.CronJob{}
+	if err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetWPCronJobName(wp.Name), Namespace: wp.Namespace}, cronJob); err != nil {
+		if !errors.IsNotFound(err) {
+			log.FromContext(ctx).Error(err, "Failed to get WP-Cron CronJob")
+		}
+		return
+	}
+
+	status := &crmv1.CronStatus{
+		LastScheduleTime:   cronJob.Status.LastScheduleTime,
+		LastSuccessfulTime: cronJob.Status.LastSuccessfulTime,
+	}
+
+	jobList := &batchv1.JobList{}
+	if err := r.List(ctx, jobList, client.InNamespace(wp.Namespace), client.MatchingLabels(wordpress.GetCronLabelsForMatching(wp))); err != nil {
+		log.FromContext(ctx).Error(err, "Failed to list WP-Cron jobs")
+		return
+	}
+
+	var newest *batchv1.Job
+	for i := range jobList.Items {
+		if newest == nil || newest.CreationTimestamp.Before(&jobList.Items[i].CreationTimestamp) {
+			newest = &jobList.Items[i]
+		}
+	}
+
+	if newest != nil {
+		status.LastRunStatus = "Running"
+		for _, condition := range newest.Status.Conditions {
+			if condition.Status != v1.ConditionTrue {
+				continue
+			}
+
+			switch condition.Type {
+			case batchv1.JobComplete:
+				status.LastRunStatus = "Succeeded"
+			case batchv1.JobFailed:
+				status.LastRunStatus = "Failed"
+				status.LastRunMessage = condition.Message
+			}
+		}
+	}
+
+	wp.Status.Cron = status
+}
+
+// updateStorageStatus reports whether the PVC of the site is bound
+func (r *WordPressSiteReconciler) updateStorageStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	pvc := &v1.PersistentVolumeClaim{}
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetPVCName(wp.Name), Namespace: wp.Namespace}, pvc)
+	switch {
+	case errors.IsNotFound(err):
+		wordpress.SetCondition(wp, ConditionStorageBound, metav1.ConditionFalse, "NotFound", "The PVC does not exist")
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get PVC")
+		wordpress.SetCondition(wp, ConditionStorageBound, metav1.ConditionUnknown, "Unknown", err.Error())
+	case pvc.Status.Phase == v1.ClaimBound:
+		wordpress.SetCondition(wp, ConditionStorageBound, metav1.ConditionTrue, "Bound", "The PVC is bound")
+	default:
+		// the reason is the phase of the PVC, a new PVC may not have one yet
+		phase := pvc.Status.Phase
+		if phase == "" {
+			phase = v1.ClaimPending
+		}
+		wordpress.SetCondition(wp, ConditionStorageBound, metav1.ConditionFalse, string(phase), fmt.Sprintf("The PVC is %s", phase))
+	}
+}
+
+// updateDeploymentStatus reports whether all replicas of the WordPress deployment are available
+func (r *WordPressSiteReconciler) updateDeploymentStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetResourceName(wp.Name), Namespace: wp.Namespace}, deployment)
+	switch {
+	case errors.IsNotFound(err):
+		wordpress.SetCondition(wp, ConditionDeploymentAvailable, metav1.ConditionFalse, "NotFound", "The deployment does not exist")
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get deployment")
+		wordpress.SetCondition(wp, ConditionDeploymentAvailable, metav1.ConditionUnknown, "Unknown", err.Error())
+	default:
+		desired := int32(1)
+		if deployment.Spec.Replicas != nil {
+			desired = *deployment.Spec.Replicas
+		}
+		message := fmt.Sprintf("%d of %d replicas available", deployment.Status.AvailableReplicas, desired)
+
+		if deployment.Status.AvailableReplicas >= desired {
+			wordpress.SetCondition(wp, ConditionDeploymentAvailable, metav1.ConditionTrue, "MinimumReplicasAvailable", message)
+			return
+		}
+
+		// a failed rollout is reported by the Progressing condition, otherwise the Available condition tells why replicas are missing
+		reason := "MinimumReplicasUnavailable"
+		for _, c := range deployment.Status.Conditions {
+			if c.Type == appsv1.DeploymentProgressing && c.Status == v1.ConditionFalse {
+				reason, message = c.Reason, c.Message
+				break
+			}
+			if c.Type == appsv1.DeploymentAvailable && c.Status == v1.ConditionFalse && c.Reason != "" {
+				reason = c.Reason
+			}
+		}
+		wordpress.SetCondition(wp, ConditionDeploymentAvailable, metav1.ConditionFalse, reason, message)
+	}
+}
+
+// updateSFTPStatus reports the address of the SFTP LoadBalancer service
+func (r *WordPressSiteReconciler) updateSFTPStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	service := &v1.Service{}
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetSFTPServiceName(wp.Name), Namespace: wp.Namespace}, service)
+	switch {
+	case errors.IsNotFound(err):
+		wp.Status.SFTP = nil
+		wordpress.SetCondition(wp, ConditionSFTPAvailable, metav1.ConditionFalse, "NotFound", "The SFTP service does not exist")
+		return
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get SFTP service")
+		wordpress.SetCondition(wp, ConditionSFTPAvailable, metav1.ConditionUnknown, "Unknown", err.Error())
+		return
+	}
+
+	host := ""
+	if len(service.Status.LoadBalancer.Ingress) > 0 {
+		host = service.Status.LoadBalancer.Ingress[0].IP
+		if host == "" {
+			host = service.Status.LoadBalancer.Ingress[0].Hostname
+		}
+	}
+
+	if host == "" || len(service.Spec.Ports) == 0 {
+		wp.Status.SFTP = nil
+		wordpress.SetCondition(wp, ConditionSFTPAvailable, metav1.ConditionFalse, "Pending", "Waiting for the LoadBalancer address of the SFTP service")
+		return
+	}
+
+	wp.Status.SFTP = &crmv1.SFTPStatus{Host: host, Port: service.Spec.Ports[0].Port}
+	wordpress.SetCondition(wp, ConditionSFTPAvailable, metav1.ConditionTrue, "Available", fmt.Sprintf("SFTP is available at %s:%d", host, wp.Status.SFTP.Port))
+}
+
+// updateIngressStatus reports whether the ingress of the site has an address
+func (r *WordPressSiteReconciler) updateIngressStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	if wp.Spec.Ingress == nil || !wp.Spec.Ingress.Enabled {
+		wordpress.SetCondition(wp, ConditionIngressAdmitted, metav1.ConditionTrue, "Disabled", "The ingress is disabled")
+		return
+	}
+
+	ingress := &networkingv1.Ingress{}
+	err := r.Get(ctx, types.NamespacedName{Name: wp.Name, Namespace: wp.Namespace}, ingress)
+	switch {
+	case errors.IsNotFound(err):
+		wordpress.SetCondition(wp, ConditionIngressAdmitted, metav1.ConditionFalse, "NotFound", "The ingress does not exist")
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get ingress")
+		wordpress.SetCondition(wp, ConditionIngressAdmitted, metav1.ConditionUnknown, "Unknown", err.Error())
+	case len(ingress.Status.LoadBalancer.Ingress) > 0:
+		address := ingress.Status.LoadBalancer.Ingress[0].IP
+		if address == "" {
+			address = ingress.Status.LoadBalancer.Ingress[0].Hostname
+		}
+		wordpress.SetCondition(wp, ConditionIngressAdmitted, metav1.ConditionTrue, "Admitted", fmt.Sprintf("The ingress controller assigned the address %s", address))
+	default:
+		wordpress.SetCondition(wp, ConditionIngressAdmitted, metav1.ConditionFalse, "Pending", "Waiting for the ingress controller to assign an address")
+	}
+}
+
+// updateCertificateStatus reports whether the certificate of the ingress is issued
+// the reason and message are taken from the cert-manager Certificate, which is named after the TLS secret,
+// a secret provided by the user without a Certificate is accepted once it contains a certificate
+func (r *WordPressSiteReconciler) updateCertificateStatus(ctx context.Context, wp *crmv1.WordPressSite) {
+	if wp.Spec.Ingress == nil || !wp.Spec.Ingress.Enabled || !wp.Spec.Ingress.TLS {
+		wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionTrue, "TLSDisabled", "TLS is disabled")
+		return
+	}
+
+	secretName := wordpress.GetTLSSecretName(wp.Name)
+	if wp.Spec.Ingress.TLSSecretName != "" {
+		secretName = wp.Spec.Ingress.TLSSecretName
+	}
+
+	certificate := &unstructured.Unstructured{}
+	certificate.SetGroupVersionKind(certificateGVK)
+	err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: wp.Namespace}, certificate)
+	switch {
+	case errors.IsNotFound(err) || meta.IsNoMatchError(err):
+		r.updateSecretCertificateStatus(ctx, wp, secretName)
+		return
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get Certificate", "name", secretName)
+		wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionUnknown, "Unknown", err.Error())
+		return
+	}
+
+	conditions, _, _ := unstructured.NestedSlice(certificate.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+
+		reason, _ := condition["reason"].(string)
+		message, _ := condition["message"].(string)
+		if reason == "" {
+			reason = "Unknown"
+		}
+
+		if condition["status"] == string(metav1.ConditionTrue) {
+			wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionTrue, reason, message)
+		} else {
+			wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionFalse, reason, message)
+		}
+		return
+	}
+
+	wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionFalse, "Pending", fmt.Sprintf("Waiting for cert-manager to process the Certificate %s", secretName))
+}
+
+// updateSecretCertificateStatus reports whether the TLS secret contains a certificate, used if there is no Certificate
+func (r *WordPressSiteReconciler) updateSecretCertificateStatus(ctx context.Context, wp *crmv1.WordPressSite, secretName string) {
+	secret := &v1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: wp.Namespace}, secret)
+	switch {
+	case errors.IsNotFound(err):
+		wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionFalse, "CertificateNotFound", fmt.Sprintf("Neither the Certificate nor the TLS secret %s exist", secretName))
+	case err != nil:
+		log.FromContext(ctx).Error(err, "Failed to get TLS secret", "name", secretName)
+		wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionUnknown, "Unknown", err.Error())
+	case len(secret.Data[v1.TLSCertKey]) == 0:
+		wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionFalse, "SecretIncomplete", fmt.Sprintf("The TLS secret %s has no certificate", secretName))
+	default:
+		wordpress.SetCondition(wp, ConditionCertificateIssued, metav1.ConditionTrue, "SecretProvided", fmt.Sprintf("The TLS secret %s contains a certificate", secretName))
+	}
+}
+
+// updateVersions reads the WordPress and the PHP version from the running site
+// the last known versions are kept if they can not be read
+func (r *WordPressSiteReconciler) updateVersions(ctx context.Context, wp *crmv1.WordPressSite) {
+	wordpressVersion, phpVersion, err := wordpress.GetVersions(ctx, wp)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to read WordPress and PHP version", "error", err.Error())
+		return
+	}
+
+	if wordpressVersion != "" {
+		wp.Status.WordPressVersion = wordpressVersion
+	}
+	if phpVersion != "" {
+		wp.Status.PHPVersion = phpVersion
+	}
+}
+
+// updateDatabaseStats collects the size and content statistics of the database through the shared prober
+// and exports them as metrics, the last statistics are kept if they can not be read
+func (r *WordPressSiteReconciler) updateDatabaseStats(ctx context.Context, wp *crmv1.WordPressSite) {
+	creds, err := r.getDatabaseCredentials(ctx, wp)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to read database statistics", "error", err.Error())
+		return
+	}
+
+	stats, err := r.Prober.DatabaseStats(ctx, getProbeKey(wp), creds, wp.GetDatabaseSettings().TablePrefix, databaseStatsTables)
+	if err != nil {
+		log.FromContext(ctx).V(1).Info("Failed to read database statistics", "error", err.Error())
+		return
+	}
+
+	// the statistics are cached by the prober, the time is when they were collected
+	database := &crmv1.DatabaseStats{
+		SizeBytes:      stats.SizeBytes,
+		Tables:         stats.Tables,
+		AutoloadBytes:  stats.AutoloadBytes,
+		Posts:          stats.Posts,
+		Users:          stats.Users,
+		LastUpdateTime: &metav1.Time{Time: stats.CollectedAt},
+	}
+	for _, table := range stats.LargestTables {
+		database.LargestTables = append(database.LargestTables, crmv1.TableStats{
+			Name:      table.Name,
+			Rows:      table.Rows,
+			SizeBytes: table.SizeBytes,
+		})
+	}
+
+	wp.Status.Database = database
+	metrics.SetDatabaseStats(wp.Namespace, wp.Name, database)
+}
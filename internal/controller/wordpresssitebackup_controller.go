@@ -0,0 +1,327 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// WordPressSiteBackup resources
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssitebackups,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssitebackups/status,verbs=get;update;patch
+
+const (
+	BackupPhasePending   = "Pending"   // Backup job is created but not running yet
+	BackupPhaseRunning   = "Running"   // Backup job is running
+	BackupPhaseCompleted = "Completed" // Archive was uploaded to the target
+	BackupPhaseFailed    = "Failed"    // Backup job failed or the backup could not be started
+)
+
+// backupRecordedAnnotation marks backup jobs that already have a WordPressSiteBackup,
+// so scheduled jobs are not recorded again after their backup was removed by the retention
+const backupRecordedAnnotation = "crm.hostzero.de/backup-recorded"
+
+type WordPressSiteBackupReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// Reconcile runs on-demand backups and records the results of backup jobs
+// backups and their jobs share the same name, scheduled jobs created by the backup CronJob
+// get a WordPressSiteBackup with the name of the job
+func (r *WordPressSiteBackupReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	backup := &crmv1.WordPressSiteBackup{}
+	if err := r.Get(ctx, req.NamespacedName, backup); err != nil {
+		if errors.IsNotFound(err) {
+			// no backup resource, this might be a job created by the backup CronJob
+			return ctrl.Result{}, r.recordScheduledBackup(ctx, req.NamespacedName)
+		}
+		logger.Error(err, "Failed to get WordPressSiteBackup")
+		return ctrl.Result{}, err
+	}
+
+	// finished backups are never touched again
+	if backup.Status.Phase == BackupPhaseCompleted || backup.Status.Phase == BackupPhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	wp := &crmv1.WordPressSite{}
+	if err := r.Get(ctx, types.NamespacedName{Name: backup.Spec.SiteName, Namespace: backup.Namespace}, wp); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, r.failBackup(ctx, backup, fmt.Sprintf("WordPressSite %s not found", backup.Spec.SiteName))
+		}
+		logger.Error(err, "Failed to get WordPressSite", "name", backup.Spec.SiteName)
+		return ctrl.Result{}, err
+	}
+
+	job := &batchv1.Job{}
+	err := r.Get(ctx, req.NamespacedName, job)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get backup job")
+		return ctrl.Result{}, err
+	}
+
+	if errors.IsNotFound(err) {
+		// on-demand backup, create the job
+		if wp.Spec.Backup == nil {
+			return ctrl.Result{}, r.failBackup(ctx, backup, fmt.Sprintf("WordPressSite %s has no backup configuration", wp.Name))
+		}
+
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      backup.Name,
+				Namespace: backup.Namespace,
+				Labels: wordpress.GetBackupLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "backup-job",
+				}),
+				Annotations: map[string]string{
+					backupRecordedAnnotation: "true",
+				},
+			},
+			Spec: wordpress.BuildBackupJobSpec(wp),
+		}
+
+		if err := controllerutil.SetControllerReference(backup, job, r.Scheme); err != nil {
+			logger.Error(err, "Unable to set owner reference to backup job", "object", job.GetName())
+			return ctrl.Result{}, err
+		}
+
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create backup job")
+			return ctrl.Result{}, err
+		}
+
+		r.Recorder.Event(backup, v1.EventTypeNormal, "BackupStarted", "Backup job created")
+	}
+
+	if backup.Status.Phase == "" {
+		backup.Status.Phase = BackupPhasePending
+		backup.Status.SiteURL = wordpress.GetSiteUrl(wp)
+		backup.Status.TablePrefix = wp.GetDatabaseSettings().TablePrefix
+	}
+
+	if job.Status.StartTime != nil {
+		backup.Status.Phase = BackupPhaseRunning
+		backup.Status.StartTime = job.Status.StartTime
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			result, err := r.getBackupResult(ctx, job)
+			if err != nil {
+				logger.Error(err, "Failed to read backup result")
+				return ctrl.Result{}, r.failBackup(ctx, backup, err.Error())
+			}
+
+			backup.Status.Phase = BackupPhaseCompleted
+			backup.Status.Message = "Backup uploaded to target"
+			backup.Status.CompletionTime = job.Status.CompletionTime
+			backup.Status.Location = result.Location
+			backup.Status.Size = result.Size
+			backup.Status.Checksum = result.Checksum
+
+			// backups of older versions of the operator don't report the time of the dump
+			if databaseTime, err := time.Parse(time.RFC3339, result.DatabaseTime); err == nil {
+				backup.Status.DatabaseTime = &metav1.Time{Time: databaseTime}
+			}
+			backup.Status.DatabaseGTID = result.DatabaseGTID
+
+			r.Recorder.Event(backup, v1.EventTypeNormal, "BackupCompleted", fmt.Sprintf("Backup uploaded to %s", result.Location))
+		case batchv1.JobFailed:
+			return ctrl.Result{}, r.failBackup(ctx, backup, condition.Message)
+		}
+	}
+
+	if err := r.Status().Update(ctx, backup); err != nil {
+		logger.Error(err, "Failed to update WordPressSiteBackup status")
+		return ctrl.Result{}, err
+	}
+
+	if backup.Status.Phase == BackupPhaseCompleted {
+		if err := r.pruneBackups(ctx, wp); err != nil {
+			logger.Error(err, "Failed to prune old backups")
+			return ctrl.Result{}, err
+		}
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// recordScheduledBackup creates the WordPressSiteBackup for a job created by the backup CronJob
+func (r *WordPressSiteBackupReconciler) recordScheduledBackup(ctx context.Context, name types.NamespacedName) error {
+	logger := log.FromContext(ctx)
+
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, name, job); err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		logger.Error(err, "Failed to get backup job")
+		return err
+	}
+
+	if job.Labels["app.kubernetes.io/component"] != "backup" || job.Annotations[backupRecordedAnnotation] != "" {
+		return nil
+	}
+
+	backup := &crmv1.WordPressSiteBackup{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      job.Name,
+			Namespace: job.Namespace,
+			Labels:    job.Labels,
+		},
+		Spec: crmv1.WordPressSiteBackupSpec{
+			SiteName: job.Labels["app.kubernetes.io/instance"],
+		},
+	}
+
+	if err := r.Create(ctx, backup); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create WordPressSiteBackup for scheduled backup", "job", job.Name)
+		return err
+	}
+
+	if job.Annotations == nil {
+		job.Annotations = map[string]string{}
+	}
+	job.Annotations[backupRecordedAnnotation] = "true"
+
+	if err := r.Update(ctx, job); err != nil {
+		logger.Error(err, "Failed to mark backup job as recorded", "job", job.Name)
+		return err
+	}
+
+	return nil
+}
+
+// getBackupResult reads the archive details from the succeeded pod of the job
+func (r *WordPressSiteBackupReconciler) getBackupResult(ctx context.Context, job *batchv1.Job) (*wordpress.BackupResult, error) {
+	podList := &v1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list backup pods: %w", err)
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == v1.PodSucceeded {
+			return wordpress.GetBackupResult(&pod)
+		}
+	}
+
+	return nil, fmt.Errorf("no succeeded pod found for backup job %s", job.Name)
+}
+
+// pruneBackups removes the oldest completed backups of the site exceeding the retention
+// their archives are removed from the backup target by a job, before the records are deleted
+func (r *WordPressSiteBackupReconciler) pruneBackups(ctx context.Context, wp *crmv1.WordPressSite) error {
+	if wp.Spec.Backup == nil {
+		return nil
+	}
+
+	retention := int(wp.Spec.Backup.Retention)
+	if retention < 1 {
+		retention = 7
+	}
+
+	backupList := &crmv1.WordPressSiteBackupList{}
+	if err := r.List(ctx, backupList, client.InNamespace(wp.Namespace)); err != nil {
+		return err
+	}
+
+	completed := []crmv1.WordPressSiteBackup{}
+	for _, backup := range backupList.Items {
+		if backup.Spec.SiteName == wp.Name && backup.Status.Phase == BackupPhaseCompleted {
+			completed = append(completed, backup)
+		}
+	}
+
+	if len(completed) <= retention {
+		return nil
+	}
+
+	// newest first
+	sort.Slice(completed, func(i, j int) bool {
+		return completed[j].CreationTimestamp.Before(&completed[i].CreationTimestamp)
+	})
+	pruned := completed[retention:]
+
+	locations := []string{}
+	for _, backup := range pruned {
+		if backup.Status.Location != "" {
+			locations = append(locations, backup.Status.Location)
+		}
+	}
+
+	if len(locations) > 0 {
+		job := &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      wordpress.GetBackupPruneJobName(pruned[0].Name),
+				Namespace: wp.Namespace,
+				Labels:    wordpress.GetBackupPruneLabels(wp),
+			},
+			Spec: wordpress.BuildBackupPruneJobSpec(wp, locations),
+		}
+		if err := controllerutil.SetControllerReference(wp, job, r.Scheme); err != nil {
+			return err
+		}
+		if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	for _, backup := range pruned {
+		if err := r.Delete(ctx, &backup); err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// failBackup marks the backup as failed
+func (r *WordPressSiteBackupReconciler) failBackup(ctx context.Context, backup *crmv1.WordPressSiteBackup, message string) error {
+	backup.Status.Phase = BackupPhaseFailed
+	backup.Status.Message = message
+
+	r.Recorder.Event(backup, v1.EventTypeWarning, "BackupFailed", message)
+
+	return r.Status().Update(ctx, backup)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WordPressSiteBackupReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&crmv1.WordPressSiteBackup{}).
+		// backups and their jobs share the same name, this covers on-demand and scheduled jobs
+		Watches(&batchv1.Job{}, handler.EnqueueRequestsFromMapFunc(func(ctx context.Context, obj client.Object) []reconcile.Request {
+			if obj.GetLabels()["app.kubernetes.io/component"] != "backup" {
+				return nil
+			}
+			return []reconcile.Request{{NamespacedName: types.NamespacedName{Name: obj.GetName(), Namespace: obj.GetNamespace()}}}
+		})).
+		Complete(r)
+}
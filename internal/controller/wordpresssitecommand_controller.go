@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/config"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// WordPressSiteCommand resources
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssitecommands,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssitecommands/status,verbs=get;update;patch
+
+const (
+	CommandPhasePending   = "Pending"   // Command job is created but not running yet
+	CommandPhaseRunning   = "Running"   // wp-cli is running
+	CommandPhaseSucceeded = "Succeeded" // wp-cli exited with 0
+	CommandPhaseFailed    = "Failed"    // wp-cli failed or the command was rejected
+)
+
+type WordPressSiteCommandReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// Reconcile runs a WordPressSiteCommand once as a job and records its output,
+// the command is deleted with its job once the TTL after it finished expired
+func (r *WordPressSiteCommandReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	command := &crmv1.WordPressSiteCommand{}
+	if err := r.Get(ctx, req.NamespacedName, command); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get WordPressSiteCommand")
+		return ctrl.Result{}, err
+	}
+
+	// finished commands are only cleaned up
+	if command.Status.Phase == CommandPhaseSucceeded || command.Status.Phase == CommandPhaseFailed {
+		return r.cleanupCommand(ctx, command)
+	}
+
+	wp := &crmv1.WordPressSite{}
+	if err := r.Get(ctx, types.NamespacedName{Name: command.Spec.SiteName, Namespace: command.Namespace}, wp); err != nil {
+		if errors.IsNotFound(err) {
+			return r.failCommand(ctx, command, "CommandFailed", fmt.Sprintf("WordPressSite %s not found", command.Spec.SiteName))
+		}
+		logger.Error(err, "Failed to get WordPressSite", "name", command.Spec.SiteName)
+		return ctrl.Result{}, err
+	}
+
+	jobName := wordpress.GetCommandJobName(command.Name)
+	job := &batchv1.Job{}
+	err := r.Get(ctx, types.NamespacedName{Name: jobName, Namespace: command.Namespace}, job)
+	if err != nil && !errors.IsNotFound(err) {
+		logger.Error(err, "Failed to get command job")
+		return ctrl.Result{}, err
+	}
+
+	if errors.IsNotFound(err) {
+		// the allowlist is checked once, a running command is not stopped when it changes
+		if err := wordpress.ValidateCommandArgs(command.Spec.Args); err != nil {
+			return r.failCommand(ctx, command, "CommandRejected", err.Error())
+		}
+
+		job = &batchv1.Job{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      jobName,
+				Namespace: command.Namespace,
+				Labels: wordpress.GetCommandLabels(wp, map[string]string{
+					"app.kubernetes.io/name": "command-job",
+				}),
+			},
+			Spec: wordpress.BuildCommandJobSpec(wp, command.Spec.Args),
+		}
+
+		if err := controllerutil.SetControllerReference(command, job, r.Scheme); err != nil {
+			logger.Error(err, "Unable to set owner reference to command job", "object", job.GetName())
+			return ctrl.Result{}, err
+		}
+
+		if err := r.Create(ctx, job); err != nil {
+			logger.Error(err, "Failed to create command job")
+			return ctrl.Result{}, err
+		}
+
+		r.Recorder.Event(command, v1.EventTypeNormal, "CommandStarted", fmt.Sprintf("Command job %s created", jobName))
+	}
+
+	if command.Status.Phase == "" {
+		command.Status.Phase = CommandPhasePending
+	}
+
+	if job.Status.StartTime != nil {
+		command.Status.Phase = CommandPhaseRunning
+		command.Status.StartTime = job.Status.StartTime
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue || (condition.Type != batchv1.JobComplete && condition.Type != batchv1.JobFailed) {
+			continue
+		}
+
+		// failed jobs have no completion time
+		completionTime := condition.LastTransitionTime
+		if job.Status.CompletionTime != nil {
+			completionTime = *job.Status.CompletionTime
+		}
+		command.Status.CompletionTime = &completionTime
+		if command.Status.StartTime != nil {
+			command.Status.Duration = &metav1.Duration{Duration: completionTime.Sub(command.Status.StartTime.Time)}
+		}
+
+		result, err := r.getCommandResult(ctx, job)
+		if err != nil {
+			logger.Error(err, "Failed to read command result")
+			message := err.Error()
+			if condition.Type == batchv1.JobFailed {
+				message = condition.Message
+			}
+			return r.failCommand(ctx, command, "CommandFailed", message)
+		}
+
+		command.Status.ExitCode = &result.ExitCode
+		command.Status.Stdout = result.Stdout
+		command.Status.Stderr = result.Stderr
+		command.Status.Truncated = result.Truncated
+
+		if condition.Type == batchv1.JobComplete && result.ExitCode == 0 {
+			command.Status.Phase = CommandPhaseSucceeded
+			command.Status.Message = "wp-cli finished"
+			r.Recorder.Event(command, v1.EventTypeNormal, "CommandSucceeded", "wp-cli finished")
+		} else {
+			return r.failCommand(ctx, command, "CommandFailed", fmt.Sprintf("wp-cli exited with %d", result.ExitCode))
+		}
+	}
+
+	if err := r.Status().Update(ctx, command); err != nil {
+		logger.Error(err, "Failed to update WordPressSiteCommand status")
+		return ctrl.Result{}, err
+	}
+
+	if command.Status.Phase == CommandPhaseSucceeded {
+		return r.cleanupCommand(ctx, command)
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// getCommandResult reads the exit code and output from the finished pod of the job
+func (r *WordPressSiteCommandReconciler) getCommandResult(ctx context.Context, job *batchv1.Job) (*wordpress.CommandResult, error) {
+	podList := &v1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(job.Namespace), client.MatchingLabels{batchv1.JobNameLabel: job.Name}); err != nil {
+		return nil, fmt.Errorf("failed to list command pods: %w", err)
+	}
+
+	for _, pod := range podList.Items {
+		if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+			return wordpress.GetCommandResult(&pod)
+		}
+	}
+
+	return nil, fmt.Errorf("no finished pod found for command job %s", job.Name)
+}
+
+// cleanupCommand deletes the finished command once its TTL expired, its job is removed by the garbage collector
+func (r *WordPressSiteCommandReconciler) cleanupCommand(ctx context.Context, command *crmv1.WordPressSiteCommand) (ctrl.Result, error) {
+	if command.Status.CompletionTime == nil {
+		return ctrl.Result{}, nil
+	}
+
+	ttl := config.AppConfig.CommandTTL
+	if command.Spec.TTLSecondsAfterFinished != nil {
+		ttl = time.Duration(*command.Spec.TTLSecondsAfterFinished) * time.Second
+	}
+
+	remaining := time.Until(command.Status.CompletionTime.Add(ttl))
+	if remaining > 0 {
+		return ctrl.Result{RequeueAfter: remaining}, nil
+	}
+
+	if err := r.Delete(ctx, command, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !errors.IsNotFound(err) {
+		log.FromContext(ctx).Error(err, "Failed to delete expired WordPressSiteCommand")
+		return ctrl.Result{}, err
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// failCommand marks the command as failed and schedules its cleanup
+func (r *WordPressSiteCommandReconciler) failCommand(ctx context.Context, command *crmv1.WordPressSiteCommand, reason string, message string) (ctrl.Result, error) {
+	command.Status.Phase = CommandPhaseFailed
+	command.Status.Message = message
+	if command.Status.CompletionTime == nil {
+		now := metav1.Now()
+		command.Status.CompletionTime = &now
+	}
+
+	r.Recorder.Event(command, v1.EventTypeWarning, reason, message)
+
+	if err := r.Status().Update(ctx, command); err != nil {
+		return ctrl.Result{}, err
+	}
+
+	return r.cleanupCommand(ctx, command)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WordPressSiteCommandReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&crmv1.WordPressSiteCommand{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
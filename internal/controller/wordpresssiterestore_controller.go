@@ -0,0 +1,431 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/record"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// WordPressSiteRestore resources
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssiterestores,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssiterestores/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=crm.hostzero.de,resources=wordpresssiterestores/finalizers,verbs=update
+
+const (
+	RestorePhasePending           = "Pending"             // Waiting for the backup and for the WordPress pods to stop
+	RestorePhaseRestoringDatabase = "RestoringDatabase"   // Database job is running
+	RestorePhaseReplayingBinlogs  = "ReplayingBinaryLogs" // Binary logs are replayed up to the point in time
+	RestorePhaseRestoringFiles    = "RestoringFiles"      // Files job is running
+	RestorePhaseCompleted         = "Completed"           // Site is restored and scaled up again
+	RestorePhaseFailed            = "Failed"              // Restore failed, the site is scaled up again
+)
+
+type WordPressSiteRestoreReconciler struct {
+	client.Client
+	Scheme   *runtime.Scheme
+	Recorder record.EventRecorder
+}
+
+// Reconcile drives a restore through its phases
+// the WordPress deployment is scaled to zero, the database and the files are restored one after another
+// by jobs and the deployment is scaled up again
+func (r *WordPressSiteRestoreReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	logger := log.FromContext(ctx)
+
+	restore := &crmv1.WordPressSiteRestore{}
+	if err := r.Get(ctx, req.NamespacedName, restore); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed to get WordPressSiteRestore")
+		return ctrl.Result{}, err
+	}
+
+	// Handle deletion with finalizer, an unfinished restore must not leave the site scaled down
+	if !restore.ObjectMeta.DeletionTimestamp.IsZero() {
+		if wordpress.ContainsString(restore.ObjectMeta.Finalizers, wordpressFinalizer) {
+			if err := r.releaseSite(ctx, restore); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			// the replay job lives next to the database cluster and is not owned by the restore
+			if err := r.stopReplayJob(ctx, restore); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			restore.ObjectMeta.Finalizers = wordpress.RemoveString(restore.ObjectMeta.Finalizers, wordpressFinalizer)
+			if err := r.Update(ctx, restore); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+		return ctrl.Result{}, nil
+	}
+
+	// finished restores are never touched again
+	if restore.Status.Phase == RestorePhaseCompleted || restore.Status.Phase == RestorePhaseFailed {
+		return ctrl.Result{}, nil
+	}
+
+	if !wordpress.ContainsString(restore.ObjectMeta.Finalizers, wordpressFinalizer) {
+		restore.ObjectMeta.Finalizers = append(restore.ObjectMeta.Finalizers, wordpressFinalizer)
+		if err := r.Update(ctx, restore); err != nil {
+			logger.Error(err, "Failed to add Finalizer to WordPressSiteRestore")
+			return ctrl.Result{}, err
+		}
+	}
+
+	wp := &crmv1.WordPressSite{}
+	if err := r.Get(ctx, types.NamespacedName{Name: restore.Spec.SiteName, Namespace: restore.Namespace}, wp); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, r.failRestore(ctx, restore, fmt.Sprintf("WordPressSite %s not found", restore.Spec.SiteName))
+		}
+		logger.Error(err, "Failed to get WordPressSite", "name", restore.Spec.SiteName)
+		return ctrl.Result{}, err
+	}
+
+	backupNamespace := restore.Spec.BackupNamespace
+	if backupNamespace == "" {
+		backupNamespace = restore.Namespace
+	}
+
+	// a point-in-time restore without a backup starts from the newest backup before the point in time
+	if restore.Status.BackupName == "" {
+		restore.Status.BackupName = restore.Spec.BackupName
+	}
+	if restore.Status.BackupName == "" {
+		if restore.Spec.PointInTime == nil {
+			return ctrl.Result{}, r.failRestore(ctx, restore, "backupName or pointInTime is required")
+		}
+
+		backup, err := r.findPointInTimeBackup(ctx, wp, backupNamespace, restore.Spec.PointInTime.Time)
+		if err != nil {
+			logger.Error(err, "Failed to find a backup for the point in time")
+			return ctrl.Result{}, err
+		}
+		if backup == nil {
+			return ctrl.Result{}, r.failRestore(ctx, restore, fmt.Sprintf("No backup of WordPressSite %s before %s can be restored to the point in time",
+				wp.Name, restore.Spec.PointInTime.UTC().Format(time.RFC3339)))
+		}
+		restore.Status.BackupName = backup.Name
+	}
+
+	backup := &crmv1.WordPressSiteBackup{}
+	if err := r.Get(ctx, types.NamespacedName{Name: restore.Status.BackupName, Namespace: backupNamespace}, backup); err != nil {
+		if errors.IsNotFound(err) {
+			return ctrl.Result{}, r.failRestore(ctx, restore, fmt.Sprintf("WordPressSiteBackup %s not found", restore.Status.BackupName))
+		}
+		logger.Error(err, "Failed to get WordPressSiteBackup", "name", restore.Status.BackupName)
+		return ctrl.Result{}, err
+	}
+
+	switch backup.Status.Phase {
+	case BackupPhaseCompleted:
+	case BackupPhaseFailed:
+		return ctrl.Result{}, r.failRestore(ctx, restore, fmt.Sprintf("WordPressSiteBackup %s failed", backup.Name))
+	default:
+		// the backup may still be running, e.g. if it was created together with the restore
+		return ctrl.Result{RequeueAfter: time.Second * 15}, r.setPhase(ctx, restore, RestorePhasePending, fmt.Sprintf("Waiting for WordPressSiteBackup %s to complete", backup.Name))
+	}
+
+	targetSecretName := restore.Spec.TargetSecretRef
+	if targetSecretName == "" {
+		if wp.Spec.Backup == nil {
+			return ctrl.Result{}, r.failRestore(ctx, restore, fmt.Sprintf("WordPressSite %s has no backup configuration and no target secret is set", wp.Name))
+		}
+		targetSecretName = wp.Spec.Backup.TargetSecretRef
+	}
+
+	switch restore.Status.Phase {
+	case "", RestorePhasePending:
+		if restore.Status.StartTime == nil {
+			restore.Status.StartTime = &metav1.Time{Time: time.Now()}
+		}
+
+		// the tables of the backup would not be found by the site, backups of older versions of the operator have no prefix
+		if prefix := wp.GetDatabaseSettings().TablePrefix; backup.Status.TablePrefix != "" && backup.Status.TablePrefix != prefix {
+			return ctrl.Result{}, r.failRestore(ctx, restore, fmt.Sprintf("WordPressSiteBackup %s has the table prefix %s, but WordPressSite %s uses %s",
+				backup.Name, backup.Status.TablePrefix, wp.Name, prefix))
+		}
+
+		if restore.Spec.PointInTime != nil {
+			source, message, err := r.getPointInTimeSource(ctx, wp, backup, restore.Spec.PointInTime)
+			if err != nil {
+				logger.Error(err, "Failed to get the binary logs for the point in time")
+				return ctrl.Result{}, err
+			}
+			if message != "" {
+				return ctrl.Result{}, r.failRestore(ctx, restore, message)
+			}
+
+			// the site keeps running until the changes up to the point in time are archived
+			if archived := source.cluster.Status.BinaryLogs.LastArchiveTime; archived == nil || archived.Before(restore.Spec.PointInTime) {
+				return ctrl.Result{RequeueAfter: time.Minute}, r.setPhase(ctx, restore, RestorePhasePending,
+					fmt.Sprintf("Waiting for the binary logs up to %s to be archived", restore.Spec.PointInTime.UTC().Format(time.RFC3339)))
+			}
+		}
+
+		message, err := r.validateSiteRestore(ctx, restore, wp)
+		if err != nil {
+			logger.Error(err, "Failed to check for other restores of the site")
+			return ctrl.Result{}, err
+		}
+		if message != "" {
+			return ctrl.Result{}, r.failRestore(ctx, restore, message)
+		}
+
+		stopped, err := r.stopSite(ctx, restore, wp)
+		if err != nil {
+			logger.Error(err, "Failed to scale down WordPress deployment")
+			return ctrl.Result{}, err
+		}
+		if !stopped {
+			return ctrl.Result{RequeueAfter: time.Second * 5}, r.setPhase(ctx, restore, RestorePhasePending, "Waiting for the WordPress pods to stop")
+		}
+
+		if err := r.createJob(ctx, restore, wp, "database", wordpress.BuildRestoreDatabaseJobSpec(wp, backup, targetSecretName)); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, r.setPhase(ctx, restore, RestorePhaseRestoringDatabase, "Restoring the database")
+
+	case RestorePhaseRestoringDatabase:
+		done, err := r.checkJob(ctx, restore, "database", r.getJobKey(restore, "database"))
+		if err != nil || !done {
+			return ctrl.Result{}, err
+		}
+
+		// only the database is restored to a point in time, the files of the backup would be older
+		if restore.Spec.PointInTime != nil {
+			source, message, err := r.getPointInTimeSource(ctx, wp, backup, restore.Spec.PointInTime)
+			if err != nil {
+				logger.Error(err, "Failed to get the binary logs for the point in time")
+				return ctrl.Result{}, err
+			}
+			if message != "" {
+				return ctrl.Result{}, r.failRestore(ctx, restore, message)
+			}
+
+			if err := r.createReplayJob(ctx, restore, wp, backup, source); err != nil {
+				return ctrl.Result{}, err
+			}
+
+			return ctrl.Result{RequeueAfter: time.Second * 15}, r.setPhase(ctx, restore, RestorePhaseReplayingBinlogs,
+				fmt.Sprintf("Replaying the binary logs up to %s", restore.Spec.PointInTime.UTC().Format(time.RFC3339)))
+		}
+
+		if err := r.createJob(ctx, restore, wp, "files", wordpress.BuildRestoreFilesJobSpec(wp, backup, targetSecretName)); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		return ctrl.Result{}, r.setPhase(ctx, restore, RestorePhaseRestoringFiles, "Restoring the files")
+
+	case RestorePhaseReplayingBinlogs:
+		// the job is in the namespace of the cluster and not owned by the restore, so it is polled
+		done, err := r.checkJob(ctx, restore, "binary logs", r.getReplayJobKey(restore, wp))
+		if err != nil || !done {
+			return ctrl.Result{RequeueAfter: time.Second * 15}, err
+		}
+
+		if err := r.releaseSite(ctx, restore); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		r.Recorder.Event(restore, v1.EventTypeNormal, "RestoreCompleted", fmt.Sprintf("Database of WordPressSite %s restored to %s",
+			wp.Name, restore.Spec.PointInTime.UTC().Format(time.RFC3339)))
+		restore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+		return ctrl.Result{}, r.setPhase(ctx, restore, RestorePhaseCompleted, "Restore completed")
+
+	case RestorePhaseRestoringFiles:
+		done, err := r.checkJob(ctx, restore, "files", r.getJobKey(restore, "files"))
+		if err != nil || !done {
+			return ctrl.Result{}, err
+		}
+
+		if err := r.releaseSite(ctx, restore); err != nil {
+			return ctrl.Result{}, err
+		}
+
+		r.Recorder.Event(restore, v1.EventTypeNormal, "RestoreCompleted", fmt.Sprintf("WordPressSite %s restored from %s", wp.Name, backup.Name))
+		restore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+		return ctrl.Result{}, r.setPhase(ctx, restore, RestorePhaseCompleted, "Restore completed")
+	}
+
+	return ctrl.Result{}, nil
+}
+
+// validateSiteRestore checks that no other restore of the site is running
+// returns a message describing the problem, or an empty string if the site can be restored
+func (r *WordPressSiteRestoreReconciler) validateSiteRestore(ctx context.Context, restore *crmv1.WordPressSiteRestore, wp *crmv1.WordPressSite) (string, error) {
+	other := wp.Annotations[wordpress.RestoreInProgressAnnotation]
+	if other == "" || other == restore.Name {
+		return "", nil
+	}
+
+	// the annotation of a deleted or finished restore is taken over
+	running := &crmv1.WordPressSiteRestore{}
+	if err := r.Get(ctx, types.NamespacedName{Name: other, Namespace: wp.Namespace}, running); err != nil {
+		if errors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	if running.Status.Phase == RestorePhaseCompleted || running.Status.Phase == RestorePhaseFailed {
+		return "", nil
+	}
+
+	return fmt.Sprintf("WordPressSite %s is already being restored by %s", wp.Name, other), nil
+}
+
+// stopSite marks the site as restoring and scales its deployment to zero
+// returns true once no WordPress pod is left
+func (r *WordPressSiteRestoreReconciler) stopSite(ctx context.Context, restore *crmv1.WordPressSiteRestore, wp *crmv1.WordPressSite) (bool, error) {
+	if wp.Annotations[wordpress.RestoreInProgressAnnotation] != restore.Name {
+		if wp.Annotations == nil {
+			wp.Annotations = map[string]string{}
+		}
+		wp.Annotations[wordpress.RestoreInProgressAnnotation] = restore.Name
+		if err := r.Update(ctx, wp); err != nil {
+			return false, err
+		}
+	}
+
+	// scale down right away instead of waiting for the WordPressSite reconciliation
+	deployment := &appsv1.Deployment{}
+	err := r.Get(ctx, types.NamespacedName{Name: wordpress.GetResourceName(wp.Name), Namespace: wp.Namespace}, deployment)
+	if err != nil && !errors.IsNotFound(err) {
+		return false, err
+	}
+	if err == nil && (deployment.Spec.Replicas == nil || *deployment.Spec.Replicas != 0) {
+		replicas := int32(0)
+		deployment.Spec.Replicas = &replicas
+		if err := r.Update(ctx, deployment); err != nil {
+			return false, err
+		}
+	}
+
+	podList := &v1.PodList{}
+	if err := r.List(ctx, podList, client.InNamespace(wp.Namespace), client.MatchingLabels(wordpress.GetWordpressLabelsForMatching(wp))); err != nil {
+		return false, err
+	}
+
+	return len(podList.Items) == 0, nil
+}
+
+// releaseSite removes the restore annotation, so the site is scaled up again by its reconciliation
+func (r *WordPressSiteRestoreReconciler) releaseSite(ctx context.Context, restore *crmv1.WordPressSiteRestore) error {
+	wp := &crmv1.WordPressSite{}
+	if err := r.Get(ctx, types.NamespacedName{Name: restore.Spec.SiteName, Namespace: restore.Namespace}, wp); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	if wp.Annotations[wordpress.RestoreInProgressAnnotation] != restore.Name {
+		return nil
+	}
+
+	delete(wp.Annotations, wordpress.RestoreInProgressAnnotation)
+	return r.Update(ctx, wp)
+}
+
+// createJob creates the job for a restore step if it does not exist yet
+func (r *WordPressSiteRestoreReconciler) createJob(ctx context.Context, restore *crmv1.WordPressSiteRestore, wp *crmv1.WordPressSite, step string, spec batchv1.JobSpec) error {
+	logger := log.FromContext(ctx)
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      wordpress.GetRestoreJobName(restore.Name, step),
+			Namespace: restore.Namespace,
+			Labels: wordpress.GetRestoreLabels(wp, map[string]string{
+				"app.kubernetes.io/name": "restore-job",
+			}),
+		},
+		Spec: spec,
+	}
+
+	if err := controllerutil.SetControllerReference(restore, job, r.Scheme); err != nil {
+		logger.Error(err, "Unable to set owner reference to restore job", "object", job.GetName())
+		return err
+	}
+
+	if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create restore job", "step", step)
+		return err
+	}
+
+	return nil
+}
+
+// getJobKey returns the key of the job of a restore step
+func (r *WordPressSiteRestoreReconciler) getJobKey(restore *crmv1.WordPressSiteRestore, step string) types.NamespacedName {
+	return types.NamespacedName{Name: wordpress.GetRestoreJobName(restore.Name, step), Namespace: restore.Namespace}
+}
+
+// checkJob returns true if the job of the restore step completed, a failed job fails the restore
+func (r *WordPressSiteRestoreReconciler) checkJob(ctx context.Context, restore *crmv1.WordPressSiteRestore, step string, key types.NamespacedName) (bool, error) {
+	job := &batchv1.Job{}
+	if err := r.Get(ctx, key, job); err != nil {
+		return false, err
+	}
+
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != v1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, nil
+		case batchv1.JobFailed:
+			return false, r.failRestore(ctx, restore, fmt.Sprintf("Restoring the %s failed: %s", step, condition.Message))
+		}
+	}
+
+	return false, nil
+}
+
+// setPhase updates the phase and message of the restore
+func (r *WordPressSiteRestoreReconciler) setPhase(ctx context.Context, restore *crmv1.WordPressSiteRestore, phase string, message string) error {
+	if restore.Status.Phase == phase && restore.Status.Message == message {
+		return nil
+	}
+
+	restore.Status.Phase = phase
+	restore.Status.Message = message
+
+	return r.Status().Update(ctx, restore)
+}
+
+// failRestore marks the restore as failed and scales the site up again
+func (r *WordPressSiteRestoreReconciler) failRestore(ctx context.Context, restore *crmv1.WordPressSiteRestore, message string) error {
+	if err := r.releaseSite(ctx, restore); err != nil {
+		return err
+	}
+
+	r.Recorder.Event(restore, v1.EventTypeWarning, "RestoreFailed", message)
+	restore.Status.CompletionTime = &metav1.Time{Time: time.Now()}
+
+	return r.setPhase(ctx, restore, RestorePhaseFailed, message)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *WordPressSiteRestoreReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&crmv1.WordPressSiteRestore{}).
+		Owns(&batchv1.Job{}).
+		Complete(r)
+}
@@ -0,0 +1,211 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	mariadbv1alpha1 "github.com/mariadb-operator/mariadb-operator/v25/api/v1alpha1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+	"hostzero.de/m/v2/internal/controller/wordpress"
+)
+
+// pointInTimeSource is the database cluster a point-in-time restore replays the binary logs of
+type pointInTimeSource struct {
+	cluster *crmv1.KubePressDatabaseCluster
+	mariadb *mariadbv1alpha1.MariaDB
+}
+
+// getBinaryLogsCluster returns the KubePressDatabaseCluster of the site if it archives binary logs, nil otherwise
+func getBinaryLogsCluster(ctx context.Context, c client.Client, wp *crmv1.WordPressSite) (*crmv1.KubePressDatabaseCluster, error) {
+	if !wp.Spec.Database.CreateNew {
+		return nil, nil
+	}
+
+	cluster := &crmv1.KubePressDatabaseCluster{}
+	if err := c.Get(ctx, wordpress.GetMariaDBRef(wp), cluster); err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+
+	if cluster.Spec.BinaryLogs == nil || cluster.Status.BinaryLogs == nil || cluster.Status.BinaryLogs.Since == nil {
+		return nil, nil
+	}
+
+	return cluster, nil
+}
+
+// getPointInTimeBackups returns the completed backups of the site that were taken while the binary logs were archived
+// backups without GTID position were taken by older versions of the operator, the replay can't start from them
+func getPointInTimeBackups(ctx context.Context, c client.Client, wp *crmv1.WordPressSite, cluster *crmv1.KubePressDatabaseCluster) ([]crmv1.WordPressSiteBackup, error) {
+	backupList := &crmv1.WordPressSiteBackupList{}
+	if err := c.List(ctx, backupList, client.InNamespace(wp.Namespace)); err != nil {
+		return nil, err
+	}
+
+	backups := []crmv1.WordPressSiteBackup{}
+	for _, backup := range backupList.Items {
+		if backup.Spec.SiteName != wp.Name || backup.Status.Phase != BackupPhaseCompleted || backup.Status.DatabaseTime == nil || backup.Status.DatabaseGTID == "" {
+			continue
+		}
+		if backup.Status.DatabaseTime.Before(cluster.Status.BinaryLogs.Since) {
+			continue
+		}
+		backups = append(backups, backup)
+	}
+
+	return backups, nil
+}
+
+// getEarliestRecoverableTime returns the earliest time the database of the site can be restored to, nil if there is none
+func getEarliestRecoverableTime(ctx context.Context, c client.Client, wp *crmv1.WordPressSite) (*metav1.Time, error) {
+	cluster, err := getBinaryLogsCluster(ctx, c, wp)
+	if err != nil || cluster == nil {
+		return nil, err
+	}
+
+	backups, err := getPointInTimeBackups(ctx, c, wp, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	var earliest *metav1.Time
+	for _, backup := range backups {
+		if earliest == nil || backup.Status.DatabaseTime.Before(earliest) {
+			earliest = backup.Status.DatabaseTime
+		}
+	}
+
+	return earliest, nil
+}
+
+// findPointInTimeBackup returns the newest backup of the site the database can be restored to the point in time from,
+// nil if there is none
+func (r *WordPressSiteRestoreReconciler) findPointInTimeBackup(ctx context.Context, wp *crmv1.WordPressSite, backupNamespace string, pointInTime time.Time) (*crmv1.WordPressSiteBackup, error) {
+	// the binary logs only contain the database of the site under its current name
+	if backupNamespace != wp.Namespace {
+		return nil, nil
+	}
+
+	cluster, err := getBinaryLogsCluster(ctx, r.Client, wp)
+	if err != nil || cluster == nil {
+		return nil, err
+	}
+
+	backups, err := getPointInTimeBackups(ctx, r.Client, wp, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	var newest *crmv1.WordPressSiteBackup
+	for i, backup := range backups {
+		if backup.Status.DatabaseTime.Time.After(pointInTime) {
+			continue
+		}
+		if newest == nil || newest.Status.DatabaseTime.Before(backup.Status.DatabaseTime) {
+			newest = &backups[i]
+		}
+	}
+
+	return newest, nil
+}
+
+// getPointInTimeSource returns the cluster whose binary logs restore the database of the site from the backup to the point in time
+// returns a message instead if the backup can't be restored to the point in time
+func (r *WordPressSiteRestoreReconciler) getPointInTimeSource(ctx context.Context, wp *crmv1.WordPressSite, backup *crmv1.WordPressSiteBackup, pointInTime *metav1.Time) (*pointInTimeSource, string, error) {
+	if pointInTime.After(time.Now()) {
+		return nil, fmt.Sprintf("The point in time %s is in the future", pointInTime.UTC().Format(time.RFC3339)), nil
+	}
+
+	if backup.Namespace != wp.Namespace || backup.Spec.SiteName != wp.Name {
+		return nil, fmt.Sprintf("WordPressSiteBackup %s is not a backup of WordPressSite %s, only its own backups can be restored to a point in time", backup.Name, wp.Name), nil
+	}
+
+	cluster, err := getBinaryLogsCluster(ctx, r.Client, wp)
+	if err != nil {
+		return nil, "", err
+	}
+	if cluster == nil {
+		return nil, fmt.Sprintf("The database of WordPressSite %s is not in a KubePressDatabaseCluster that archives binary logs", wp.Name), nil
+	}
+
+	databaseTime := backup.Status.DatabaseTime
+	if databaseTime == nil || databaseTime.Before(cluster.Status.BinaryLogs.Since) {
+		return nil, fmt.Sprintf("WordPressSiteBackup %s was taken before the binary logs were archived", backup.Name), nil
+	}
+	if backup.Status.DatabaseGTID == "" {
+		return nil, fmt.Sprintf("WordPressSiteBackup %s has no position in the binary logs, take a new backup to restore to a point in time", backup.Name), nil
+	}
+	if databaseTime.After(pointInTime.Time) {
+		return nil, fmt.Sprintf("WordPressSiteBackup %s was taken after the point in time", backup.Name), nil
+	}
+
+	mariadb := &mariadbv1alpha1.MariaDB{}
+	if err := r.Get(ctx, types.NamespacedName{Name: cluster.Name, Namespace: cluster.Namespace}, mariadb); err != nil {
+		if errors.IsNotFound(err) {
+			return nil, fmt.Sprintf("MariaDB %s/%s not found", cluster.Namespace, cluster.Name), nil
+		}
+		return nil, "", err
+	}
+
+	return &pointInTimeSource{cluster: cluster, mariadb: mariadb}, "", nil
+}
+
+// getReplayJobKey returns the key of the job that replays the binary logs of the restore
+func (r *WordPressSiteRestoreReconciler) getReplayJobKey(restore *crmv1.WordPressSiteRestore, wp *crmv1.WordPressSite) types.NamespacedName {
+	return types.NamespacedName{
+		Name:      wordpress.GetBinlogReplayJobName(restore.Namespace, restore.Name),
+		Namespace: wordpress.GetMariaDBRef(wp).Namespace,
+	}
+}
+
+// createReplayJob creates the job that replays the binary logs from the backup up to the point in time
+// the job runs in the namespace of the cluster, where the root password is
+func (r *WordPressSiteRestoreReconciler) createReplayJob(ctx context.Context, restore *crmv1.WordPressSiteRestore, wp *crmv1.WordPressSite, backup *crmv1.WordPressSiteBackup, source *pointInTimeSource) error {
+	logger := log.FromContext(ctx)
+
+	key := r.getReplayJobKey(restore, wp)
+	labels := wordpress.GetRestoreLabels(wp, map[string]string{
+		"app.kubernetes.io/name": "restore-binlogs-job",
+	})
+	labels[wordpress.SiteNamespaceLabel] = wp.Namespace
+
+	job := &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      key.Name,
+			Namespace: key.Namespace,
+			Labels:    labels,
+		},
+		Spec: wordpress.BuildBinlogReplayJobSpec(wp, source.cluster, source.mariadb, backup.Status.DatabaseGTID, *restore.Spec.PointInTime),
+	}
+
+	if err := r.Create(ctx, job); err != nil && !errors.IsAlreadyExists(err) {
+		logger.Error(err, "Failed to create binary log replay job")
+		return err
+	}
+
+	return nil
+}
+
+// stopReplayJob removes the replay job of an unfinished point-in-time restore
+func (r *WordPressSiteRestoreReconciler) stopReplayJob(ctx context.Context, restore *crmv1.WordPressSiteRestore) error {
+	if restore.Status.Phase != RestorePhaseReplayingBinlogs {
+		return nil
+	}
+
+	wp := &crmv1.WordPressSite{}
+	if err := r.Get(ctx, types.NamespacedName{Name: restore.Spec.SiteName, Namespace: restore.Namespace}, wp); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+
+	key := r.getReplayJobKey(restore, wp)
+	job := &batchv1.Job{ObjectMeta: metav1.ObjectMeta{Name: key.Name, Namespace: key.Namespace}}
+
+	return client.IgnoreNotFound(r.Delete(ctx, job, client.PropagationPolicy(metav1.DeletePropagationBackground)))
+}
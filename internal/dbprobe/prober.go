@@ -0,0 +1,353 @@
+package dbprobe
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"golang.org/x/time/rate"
+	corev1 "k8s.io/api/core/v1"
+
+	"hostzero.de/m/v2/internal/metrics"
+)
+
+// DefaultPort is used if the secret has no databasePort key
+const DefaultPort = 3306
+
+// ErrRateLimited is returned if a probe is needed but the rate limit is exhausted
+var ErrRateLimited = errors.New("database probe rate limit exceeded")
+
+// Options configure the prober, zero values are replaced with the defaults
+type Options struct {
+	// TTL of successful results
+	TTL time.Duration
+	// StatsTTL of successful database statistics, they are more expensive to collect
+	StatsTTL time.Duration
+	// NegativeTTL of failed probes and sites that are not installed yet, short so new sites become ready quickly
+	NegativeTTL time.Duration
+	// Rate is the number of probes per second over all sites, Burst the number of probes allowed at once
+	Rate  float64
+	Burst int
+	// MaxOpenConns is the size of each connection pool
+	MaxOpenConns int
+	// PoolIdleTimeout closes pools that were not used for this long
+	PoolIdleTimeout time.Duration
+	// Timeout of a single probe
+	Timeout time.Duration
+}
+
+// SSL modes of the databaseSSLMode key, they follow the --ssl-mode option of the MySQL client
+const (
+	SSLModeDisabled       = "DISABLED"        // plain connection, the default
+	SSLModeRequired       = "REQUIRED"        // encrypted, the certificate is not verified
+	SSLModeVerifyCA       = "VERIFY_CA"       // like VERIFY_IDENTITY, PHP can't verify the certificate without the host
+	SSLModeVerifyIdentity = "VERIFY_IDENTITY" // encrypted, the certificate is signed by a trusted CA and matches the host
+)
+
+// Credentials are the connection details of the database of a site
+type Credentials struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	Database string
+	// SSLMode is one of the SSL modes, empty means disabled
+	SSLMode string
+	// CA are PEM encoded certificates trusted in addition to the system ones when the certificate is verified
+	CA []byte
+}
+
+// ValidateSSLMode returns an error if the mode is not one of the SSL modes, empty is allowed
+func ValidateSSLMode(mode string) error {
+	switch mode {
+	case "", SSLModeDisabled, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity:
+		return nil
+	}
+	return fmt.Errorf("invalid database SSL mode %q, must be one of %s, %s, %s or %s",
+		mode, SSLModeDisabled, SSLModeRequired, SSLModeVerifyCA, SSLModeVerifyIdentity)
+}
+
+// CredentialsFromSecret reads the connection details from the admin secret of a site
+// the password is taken from databasePassword and falls back to password, the CA is not part of the secret
+func CredentialsFromSecret(secret *corev1.Secret) (Credentials, error) {
+	creds := Credentials{
+		Host:     string(secret.Data["databaseHost"]),
+		Port:     DefaultPort,
+		User:     string(secret.Data["databaseUsername"]),
+		Password: string(secret.Data["databasePassword"]),
+		Database: string(secret.Data["database"]),
+		SSLMode:  string(secret.Data["databaseSSLMode"]),
+	}
+
+	if creds.Host == "" {
+		return creds, fmt.Errorf("failed to get database host")
+	}
+	if creds.Database == "" {
+		return creds, fmt.Errorf("empty database name")
+	}
+	if creds.User == "" {
+		return creds, fmt.Errorf("empty database username")
+	}
+	if creds.Password == "" {
+		creds.Password = string(secret.Data["password"])
+	}
+	if creds.Password == "" {
+		return creds, fmt.Errorf("empty database password")
+	}
+
+	if err := ValidateSSLMode(creds.SSLMode); err != nil {
+		return creds, err
+	}
+
+	if port := string(secret.Data["databasePort"]); port != "" {
+		p, err := strconv.Atoi(port)
+		if err != nil || p < 1 || p > 65535 {
+			return creds, fmt.Errorf("invalid database port %q", port)
+		}
+		creds.Port = p
+	}
+
+	return creds, nil
+}
+
+// Prober runs the status probes against the databases of the sites
+// it keeps one bounded connection pool per host, port and user, caches the results per site
+// and limits the number of probes over all sites
+type Prober struct {
+	opts    Options
+	limiter *rate.Limiter
+
+	mu    sync.Mutex
+	pools map[string]*pool
+	cache map[string]result
+}
+
+// pool is a connection pool for one database user
+type pool struct {
+	db       *sql.DB
+	password string
+	sslMode  string
+	ca       string
+	lastUsed time.Time
+}
+
+// result is a cached probe result
+type result struct {
+	value   string
+	err     error
+	expires time.Time
+}
+
+// NewProber creates a prober, the pools are opened on first use
+func NewProber(opts Options) *Prober {
+	if opts.TTL == 0 {
+		opts.TTL = 5 * time.Minute
+	}
+	if opts.StatsTTL == 0 {
+		opts.StatsTTL = 15 * time.Minute
+	}
+	if opts.NegativeTTL == 0 {
+		opts.NegativeTTL = 15 * time.Second
+	}
+	if opts.Rate == 0 {
+		opts.Rate = 10
+	}
+	if opts.Burst == 0 {
+		opts.Burst = 20
+	}
+	if opts.MaxOpenConns == 0 {
+		opts.MaxOpenConns = 2
+	}
+	if opts.PoolIdleTimeout == 0 {
+		opts.PoolIdleTimeout = 30 * time.Minute
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
+	}
+
+	return &Prober{
+		opts:    opts,
+		limiter: rate.NewLimiter(rate.Limit(opts.Rate), opts.Burst),
+		pools:   map[string]*pool{},
+		cache:   map[string]result{},
+	}
+}
+
+// IsWordPressInstalled checks whether the options table with the siteurl option exists
+// site identifies the site in the cache, usually namespace/name, tablePrefix is the prefix of the WordPress tables
+func (p *Prober) IsWordPressInstalled(ctx context.Context, site string, creds Credentials, tablePrefix string) (bool, error) {
+	value, err := p.probe(ctx, site+"/installed", creds, p.opts.TTL, func(ctx context.Context, db *sql.DB) (string, bool, error) {
+		var siteURL string
+		err := db.QueryRowContext(ctx,
+			fmt.Sprintf("SELECT option_value FROM %s.%s WHERE option_name = 'siteurl' LIMIT 1",
+				quoteIdentifier(creds.Database), quoteIdentifier(tablePrefix+"options"))).Scan(&siteURL)
+		if err != nil {
+			var mysqlErr *mysql.MySQLError
+			// no siteurl option or no options table (ER_NO_SUCH_TABLE) means not installed yet
+			if errors.Is(err, sql.ErrNoRows) || (errors.As(err, &mysqlErr) && mysqlErr.Number == 1146) {
+				return "false", false, nil
+			}
+			return "", false, fmt.Errorf("failed to query WordPress installation status: %w", err)
+		}
+		return "true", true, nil
+	})
+
+	return value == "true", err
+}
+
+// ServerVersion returns the version of the database server
+func (p *Prober) ServerVersion(ctx context.Context, site string, creds Credentials) (string, error) {
+	return p.probe(ctx, site+"/version", creds, p.opts.TTL, func(ctx context.Context, db *sql.DB) (string, bool, error) {
+		var version string
+		if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+			return "", false, fmt.Errorf("failed to query MySQL version: %w", err)
+		}
+		return version, true, nil
+	})
+}
+
+// DatabaseStats returns the size and content statistics of the database of a site
+// tablePrefix is the prefix of the WordPress tables, limit the number of largest tables that are returned
+func (p *Prober) DatabaseStats(ctx context.Context, site string, creds Credentials, tablePrefix string, limit int) (Stats, error) {
+	var stats Stats
+	value, err := p.probe(ctx, site+"/stats", creds, p.opts.StatsTTL, func(ctx context.Context, db *sql.DB) (string, bool, error) {
+		collected, err := queryStats(ctx, db, creds.Database, tablePrefix, limit)
+		if err != nil {
+			return "", false, err
+		}
+		collected.CollectedAt = time.Now()
+
+		value, err := json.Marshal(collected)
+		if err != nil {
+			return "", false, err
+		}
+		return string(value), true, nil
+	})
+	if err != nil {
+		return stats, err
+	}
+
+	err = json.Unmarshal([]byte(value), &stats)
+	return stats, err
+}
+
+// Forget drops the cached results of a site, e.g. when it is deleted
+func (p *Prober) Forget(site string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key := range p.cache {
+		if strings.HasPrefix(key, site+"/") {
+			delete(p.cache, key)
+		}
+	}
+}
+
+// probe returns the cached result or runs the query, the query reports whether the result is positive
+// positive results are cached for ttl
+func (p *Prober) probe(ctx context.Context, key string, creds Credentials, ttl time.Duration,
+	query func(context.Context, *sql.DB) (string, bool, error)) (string, error) {
+	now := time.Now()
+
+	p.mu.Lock()
+	cached, found := p.cache[key]
+	p.mu.Unlock()
+
+	if found && now.Before(cached.expires) {
+		return cached.value, cached.err
+	}
+
+	if !p.limiter.Allow() {
+		// a stale result is better than none
+		if found {
+			return cached.value, cached.err
+		}
+		return "", ErrRateLimited
+	}
+
+	db, err := p.getPool(creds)
+	if err != nil {
+		return "", err
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, p.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	value, positive, err := query(queryCtx, db)
+	metrics.ObserveDatabaseProbe(start, err)
+
+	if err != nil || !positive {
+		ttl = p.opts.NegativeTTL
+	}
+
+	p.mu.Lock()
+	p.cache[key] = result{value: value, err: err, expires: time.Now().Add(ttl)}
+	p.mu.Unlock()
+
+	return value, err
+}
+
+// getPool returns the pool for the credentials, pools with a changed password or TLS setting are replaced
+// and pools that were not used for a while are closed
+func (p *Prober) getPool(creds Credentials) (*sql.DB, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	for key, pl := range p.pools {
+		if now.Sub(pl.lastUsed) > p.opts.PoolIdleTimeout {
+			_ = pl.db.Close()
+			delete(p.pools, key)
+		}
+	}
+
+	key := fmt.Sprintf("%s:%d/%s", creds.Host, creds.Port, creds.User)
+	if pl, ok := p.pools[key]; ok {
+		if pl.password == creds.Password && pl.sslMode == creds.SSLMode && pl.ca == string(creds.CA) {
+			pl.lastUsed = now
+			return pl.db, nil
+		}
+		_ = pl.db.Close()
+		delete(p.pools, key)
+	}
+
+	config := mysql.NewConfig()
+	config.User = creds.User
+	config.Passwd = creds.Password
+	config.Net = "tcp"
+	config.Addr = fmt.Sprintf("%s:%d", creds.Host, creds.Port)
+	config.Timeout = p.opts.Timeout
+
+	tlsConfig, err := getTLSConfig(creds)
+	if err != nil {
+		return nil, err
+	}
+	config.TLS = tlsConfig
+
+	connector, err := mysql.NewConnector(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open MySQL connection: %w", err)
+	}
+
+	db := sql.OpenDB(connector)
+	db.SetMaxOpenConns(p.opts.MaxOpenConns)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxIdleTime(5 * time.Minute)
+
+	p.pools[key] = &pool{db: db, password: creds.Password, sslMode: creds.SSLMode, ca: string(creds.CA), lastUsed: now}
+
+	return db, nil
+}
+
+// quoteIdentifier quotes a database name for use in a query
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
@@ -0,0 +1,82 @@
+package dbprobe
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Stats are the size and content statistics of the database of a site
+type Stats struct {
+	SizeBytes     int64        `json:"sizeBytes"`
+	Tables        int32        `json:"tables"`
+	LargestTables []TableStats `json:"largestTables,omitempty"`
+	AutoloadBytes int64        `json:"autoloadBytes"`
+	Posts         int64        `json:"posts"`
+	Users         int64        `json:"users"`
+	// CollectedAt is the time the statistics were queried, cached statistics keep it
+	CollectedAt time.Time `json:"collectedAt"`
+}
+
+// TableStats are the size and the row count of a table, the row count is an estimate of the storage engine
+type TableStats struct {
+	Name      string `json:"name"`
+	Rows      int64  `json:"rows"`
+	SizeBytes int64  `json:"sizeBytes"`
+}
+
+// queryStats reads the sizes from information_schema and the counts from the WordPress tables
+func queryStats(ctx context.Context, db *sql.DB, database string, tablePrefix string, limit int) (Stats, error) {
+	stats := Stats{}
+
+	err := db.QueryRowContext(ctx,
+		"SELECT COUNT(*), COALESCE(SUM(DATA_LENGTH + INDEX_LENGTH), 0) FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?",
+		database).Scan(&stats.Tables, &stats.SizeBytes)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query database size: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx,
+		"SELECT TABLE_NAME, COALESCE(TABLE_ROWS, 0), COALESCE(DATA_LENGTH + INDEX_LENGTH, 0) FROM information_schema.TABLES "+
+			"WHERE TABLE_SCHEMA = ? ORDER BY DATA_LENGTH + INDEX_LENGTH DESC LIMIT ?",
+		database, limit)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query table sizes: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		table := TableStats{}
+		if err := rows.Scan(&table.Name, &table.Rows, &table.SizeBytes); err != nil {
+			return stats, fmt.Errorf("failed to read table sizes: %w", err)
+		}
+		stats.LargestTables = append(stats.LargestTables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("failed to read table sizes: %w", err)
+	}
+
+	// WordPress 6.6 replaced "yes" with "on", "auto-on" and "auto" for autoloaded options
+	err = db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT COALESCE(SUM(LENGTH(option_value)), 0) FROM %s.%s WHERE autoload IN ('yes', 'on', 'auto-on', 'auto')",
+			quoteIdentifier(database), quoteIdentifier(tablePrefix+"options"))).Scan(&stats.AutoloadBytes)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query autoload options size: %w", err)
+	}
+
+	err = db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM %s.%s WHERE post_type = 'post' AND post_status = 'publish'",
+			quoteIdentifier(database), quoteIdentifier(tablePrefix+"posts"))).Scan(&stats.Posts)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query number of posts: %w", err)
+	}
+
+	err = db.QueryRowContext(ctx,
+		fmt.Sprintf("SELECT COUNT(*) FROM %s.%s", quoteIdentifier(database), quoteIdentifier(tablePrefix+"users"))).Scan(&stats.Users)
+	if err != nil {
+		return stats, fmt.Errorf("failed to query number of users: %w", err)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,40 @@
+package dbprobe
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+)
+
+var errNoCertificate = errors.New("the database CA bundle contains no PEM encoded certificate")
+
+// ValidateCA returns an error if the CA bundle contains no certificate
+func ValidateCA(ca []byte) error {
+	if !x509.NewCertPool().AppendCertsFromPEM(ca) {
+		return errNoCertificate
+	}
+	return nil
+}
+
+// getTLSConfig returns the TLS configuration for the SSL mode of the credentials, nil if TLS is disabled
+func getTLSConfig(creds Credentials) (*tls.Config, error) {
+	switch creds.SSLMode {
+	case "", SSLModeDisabled:
+		return nil, nil
+	case SSLModeRequired:
+		// REQUIRED only asks for encryption
+		return &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: true}, nil
+	}
+
+	roots, err := x509.SystemCertPool()
+	if err != nil {
+		roots = x509.NewCertPool()
+	}
+	if len(creds.CA) > 0 && !roots.AppendCertsFromPEM(creds.CA) {
+		return nil, errNoCertificate
+	}
+
+	// VERIFY_CA checks the host name as well, like PHP does in the WordPress pods,
+	// so the probe does not report a database as reachable that WordPress can't connect to
+	return &tls.Config{MinVersion: tls.VersionTLS12, RootCAs: roots, ServerName: creds.Host}, nil
+}
@@ -0,0 +1,123 @@
+package dbprobe
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCA returns a PEM encoded self-signed CA certificate
+func testCA(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "kubepress test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestGetTLSConfig(t *testing.T) {
+	ca := testCA(t)
+
+	tests := []struct {
+		name       string
+		mode       string
+		ca         []byte
+		disabled   bool
+		verify     bool
+		wantErr    bool
+		serverName string
+	}{
+		{name: "no mode", mode: "", disabled: true},
+		{name: "disabled", mode: SSLModeDisabled, disabled: true},
+		{name: "required", mode: SSLModeRequired},
+		{name: "verify CA", mode: SSLModeVerifyCA, verify: true, serverName: "db.example.com"},
+		{name: "verify identity", mode: SSLModeVerifyIdentity, verify: true, serverName: "db.example.com"},
+		{name: "verify identity with CA bundle", mode: SSLModeVerifyIdentity, ca: ca, verify: true, serverName: "db.example.com"},
+		{name: "CA bundle without certificate", mode: SSLModeVerifyCA, ca: []byte("not a certificate"), wantErr: true},
+		{name: "CA bundle is ignored without verification", mode: SSLModeRequired, ca: []byte("not a certificate")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config, err := getTLSConfig(Credentials{Host: "db.example.com", SSLMode: tt.mode, CA: tt.ca})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("getTLSConfig() = %v, want an error", config)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("getTLSConfig() = %v, want nil", err)
+			}
+
+			if tt.disabled {
+				if config != nil {
+					t.Errorf("getTLSConfig() = %v, want nil", config)
+				}
+				return
+			}
+			if config == nil {
+				t.Fatal("getTLSConfig() = nil, want a TLS configuration")
+			}
+			if config.InsecureSkipVerify == tt.verify {
+				t.Errorf("InsecureSkipVerify = %t, want %t", config.InsecureSkipVerify, !tt.verify)
+			}
+			if config.ServerName != tt.serverName {
+				t.Errorf("ServerName = %q, want %q", config.ServerName, tt.serverName)
+			}
+			if tt.verify && config.RootCAs == nil {
+				t.Error("RootCAs = nil, want the system and the bundled certificates")
+			}
+		})
+	}
+}
+
+func TestValidateSSLMode(t *testing.T) {
+	tests := []struct {
+		mode  string
+		valid bool
+	}{
+		{mode: "", valid: true},
+		{mode: SSLModeDisabled, valid: true},
+		{mode: SSLModeRequired, valid: true},
+		{mode: SSLModeVerifyCA, valid: true},
+		{mode: SSLModeVerifyIdentity, valid: true},
+		{mode: "required", valid: false},
+		{mode: "PREFERRED", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			err := ValidateSSLMode(tt.mode)
+			if tt.valid && err != nil {
+				t.Errorf("ValidateSSLMode(%q) = %v, want nil", tt.mode, err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("ValidateSSLMode(%q) = nil, want an error", tt.mode)
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+	crmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+// namespace of all metrics, they are served by the controller-runtime metrics server
+const namespace = "kubepress"
+
+var (
+	// TimeToReady is the time from the creation of a site until it was ready and deployed for the first time
+	TimeToReady = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "site_time_to_ready_seconds",
+		Help:      "Time from the creation of a WordPressSite until it is ready and deployed for the first time.",
+		Buckets:   prometheus.ExponentialBuckets(15, 2, 10), // 15s to about 2h
+	})
+
+	// ReconcileStepDuration is the duration of the steps of the site reconciliation
+	ReconcileStepDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reconcile_step_duration_seconds",
+		Help:      "Duration of the steps of the WordPressSite reconciliation.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"step"})
+
+	// ValidationFailures counts the sites that failed the validation by the reason
+	ValidationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_failures_total",
+		Help:      "Number of WordPressSite validation failures by reason.",
+	}, []string{"reason"})
+
+	// DatabaseProbeDuration is the duration of the database probes, cached results are not counted
+	DatabaseProbeDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "database_probe_duration_seconds",
+		Help:      "Duration of the database probes checking the installation, the server version and the statistics of the sites.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5},
+	}, []string{"result"})
+
+	// DatabaseSize is the size of the data and the indexes of the database of each site
+	DatabaseSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "site_database_size_bytes",
+		Help:      "Size of the data and the indexes of the database of a WordPressSite.",
+	}, []string{"namespace", "site"})
+
+	// DatabaseTableSize is the size of the largest tables of each site
+	DatabaseTableSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "site_database_table_size_bytes",
+		Help:      "Size of the data and the indexes of the largest tables of a WordPressSite.",
+	}, []string{"namespace", "site", "table"})
+
+	// DatabaseTableRows is the estimated row count of the largest tables of each site
+	DatabaseTableRows = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "site_database_table_rows",
+		Help:      "Estimated number of rows of the largest tables of a WordPressSite.",
+	}, []string{"namespace", "site", "table"})
+
+	// DatabaseAutoloadSize is the size of the autoloaded options of each site
+	DatabaseAutoloadSize = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "site_database_autoload_bytes",
+		Help:      "Size of the options WordPress loads on every request of a WordPressSite.",
+	}, []string{"namespace", "site"})
+
+	// SitePosts is the number of published posts of each site
+	SitePosts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "site_posts",
+		Help:      "Number of published posts of a WordPressSite.",
+	}, []string{"namespace", "site"})
+
+	// SiteUsers is the number of WordPress users of each site
+	SiteUsers = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "site_users",
+		Help:      "Number of WordPress users of a WordPressSite.",
+	}, []string{"namespace", "site"})
+)
+
+func init() {
+	crmetrics.Registry.MustRegister(TimeToReady, ReconcileStepDuration, ValidationFailures, DatabaseProbeDuration,
+		DatabaseSize, DatabaseTableSize, DatabaseTableRows, DatabaseAutoloadSize, SitePosts, SiteUsers)
+}
+
+// TimeReconcileStep runs a step of the reconciliation and records its duration
+func TimeReconcileStep(step string, fn func() error) error {
+	start := time.Now()
+	err := fn()
+	ReconcileStepDuration.WithLabelValues(step).Observe(time.Since(start).Seconds())
+	return err
+}
+
+// ObserveDatabaseProbe records the duration of a database probe that started at start
+func ObserveDatabaseProbe(start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	DatabaseProbeDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+}
+
+// SetDatabaseStats exports the database statistics of a site, the tables that are no longer among the largest are removed
+func SetDatabaseStats(namespace, site string, stats *crmv1.DatabaseStats) {
+	labels := prometheus.Labels{"namespace": namespace, "site": site}
+	DatabaseTableSize.DeletePartialMatch(labels)
+	DatabaseTableRows.DeletePartialMatch(labels)
+
+	DatabaseSize.With(labels).Set(float64(stats.SizeBytes))
+	DatabaseAutoloadSize.With(labels).Set(float64(stats.AutoloadBytes))
+	SitePosts.With(labels).Set(float64(stats.Posts))
+	SiteUsers.With(labels).Set(float64(stats.Users))
+	for _, table := range stats.LargestTables {
+		DatabaseTableSize.WithLabelValues(namespace, site, table.Name).Set(float64(table.SizeBytes))
+		DatabaseTableRows.WithLabelValues(namespace, site, table.Name).Set(float64(table.Rows))
+	}
+}
+
+// DeleteDatabaseStats removes the database statistics of a deleted site
+func DeleteDatabaseStats(namespace, site string) {
+	labels := prometheus.Labels{"namespace": namespace, "site": site}
+	for _, gauge := range []*prometheus.GaugeVec{DatabaseSize, DatabaseTableSize, DatabaseTableRows, DatabaseAutoloadSize, SitePosts, SiteUsers} {
+		gauge.DeletePartialMatch(labels)
+	}
+}
+
+// siteCollector counts the sites by namespace and deployment status when the metrics are scraped,
+// so deleted sites and sites that are not reconciled any more are counted correctly
+type siteCollector struct {
+	reader client.Reader
+	desc   *prometheus.Desc
+}
+
+// RegisterSiteCollector registers the kubepress_sites_total gauge, the sites are listed from the reader
+func RegisterSiteCollector(reader client.Reader) error {
+	return crmetrics.Registry.Register(&siteCollector{
+		reader: reader,
+		desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, "", "sites_total"),
+			"Number of WordPressSites by namespace and deployment status.",
+			[]string{"namespace", "status"}, nil),
+	})
+}
+
+// Describe implements prometheus.Collector
+func (c *siteCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector
+func (c *siteCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	siteList := &crmv1.WordPressSiteList{}
+	if err := c.reader.List(ctx, siteList); err != nil {
+		log.Log.WithName("metrics").Error(err, "Failed to list WordPress sites")
+		return
+	}
+
+	type key struct{ namespace, status string }
+	counts := map[key]int{}
+	for _, site := range siteList.Items {
+		status := site.Status.DeploymentStatus
+		if status == "" {
+			status = "Unknown"
+		}
+		counts[key{site.Namespace, status}]++
+	}
+
+	for k, count := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(count), k.namespace, k.status)
+	}
+}
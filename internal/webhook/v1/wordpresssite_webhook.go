@@ -0,0 +1,219 @@
+package v1
+
+import (
+	"context"
+	"fmt"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+
+	crmv1 "hostzero.de/m/v2/api/v1"
+)
+
+// DomainLabel holds the host of a site, the controller looks up sites with the same host by it
+const DomainLabel = "hostzero.com/domain"
+
+var wordpresssitelog = logf.Log.WithName("wordpresssite-resource")
+
+// SetupWordPressSiteWebhookWithManager registers the webhook for WordPressSite in the manager.
+func SetupWordPressSiteWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).For(&crmv1.WordPressSite{}).
+		WithValidator(&WordPressSiteCustomValidator{Client: mgr.GetClient()}).
+		WithDefaulter(&WordPressSiteCustomDefaulter{}).
+		Complete()
+}
+
+// +kubebuilder:webhook:path=/mutate-crm-hostzero-de-v1-wordpresssite,mutating=true,failurePolicy=fail,sideEffects=None,groups=crm.hostzero.de,resources=wordpresssites,verbs=create;update,versions=v1,name=mwordpresssite-v1.kb.io,admissionReviewVersions=v1
+
+// WordPressSiteCustomDefaulter sets default values on WordPressSite resources when they are created or updated
+type WordPressSiteCustomDefaulter struct{}
+
+var _ webhook.CustomDefaulter = &WordPressSiteCustomDefaulter{}
+
+// Default implements webhook.CustomDefaulter so a webhook will be registered for the Kind WordPressSite.
+func (d *WordPressSiteCustomDefaulter) Default(_ context.Context, obj runtime.Object) error {
+	wp, ok := obj.(*crmv1.WordPressSite)
+	if !ok {
+		return fmt.Errorf("expected a WordPressSite object but got %T", obj)
+	}
+	wordpresssitelog.V(1).Info("Defaulting for WordPressSite", "name", wp.GetName())
+
+	wp.SetDefaults()
+
+	// keep the domain label in sync with the host, hosts longer than a label value can not be labeled
+	if wp.Spec.Ingress != nil && len(validation.IsValidLabelValue(wp.Spec.Ingress.Host)) == 0 {
+		if wp.Labels == nil {
+			wp.Labels = map[string]string{}
+		}
+		wp.Labels[DomainLabel] = wp.Spec.Ingress.Host
+	}
+
+	return nil
+}
+
+// +kubebuilder:webhook:path=/validate-crm-hostzero-de-v1-wordpresssite,mutating=false,failurePolicy=fail,sideEffects=None,groups=crm.hostzero.de,resources=wordpresssites,verbs=create;update,versions=v1,name=vwordpresssite-v1.kb.io,admissionReviewVersions=v1
+
+// WordPressSiteCustomValidator validates WordPressSite resources when they are created or updated
+// the same checks are done by the controller, the webhook rejects invalid sites before they are stored
+type WordPressSiteCustomValidator struct {
+	Client client.Client
+}
+
+var _ webhook.CustomValidator = &WordPressSiteCustomValidator{}
+
+// ValidateCreate implements webhook.CustomValidator so a webhook will be registered for the type WordPressSite.
+func (v *WordPressSiteCustomValidator) ValidateCreate(ctx context.Context, obj runtime.Object) (admission.Warnings, error) {
+	wp, ok := obj.(*crmv1.WordPressSite)
+	if !ok {
+		return nil, fmt.Errorf("expected a WordPressSite object but got %T", obj)
+	}
+	wordpresssitelog.V(1).Info("Validation for WordPressSite upon creation", "name", wp.GetName())
+
+	allErrs := wp.ValidateQuantities()
+	allErrs = append(allErrs, wp.ValidateExtensions()...)
+
+	hostErrs, err := v.validateHost(ctx, wp)
+	if err != nil {
+		return nil, err
+	}
+	allErrs = append(allErrs, hostErrs...)
+
+	return nil, toInvalidError(wp, allErrs)
+}
+
+// ValidateUpdate implements webhook.CustomValidator so a webhook will be registered for the type WordPressSite.
+func (v *WordPressSiteCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj runtime.Object) (admission.Warnings, error) {
+	wp, ok := newObj.(*crmv1.WordPressSite)
+	if !ok {
+		return nil, fmt.Errorf("expected a WordPressSite object for the newObj but got %T", newObj)
+	}
+	old, ok := oldObj.(*crmv1.WordPressSite)
+	if !ok {
+		return nil, fmt.Errorf("expected a WordPressSite object for the oldObj but got %T", oldObj)
+	}
+	wordpresssitelog.V(1).Info("Validation for WordPressSite upon update", "name", wp.GetName())
+
+	// never block the removal of the finalizer or changes to the deletion policy of a terminating site
+	if !wp.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+
+	allErrs := wp.ValidateQuantities()
+	allErrs = append(allErrs, wp.ValidateExtensions()...)
+
+	hostErrs, err := v.validateHost(ctx, wp)
+	if err != nil {
+		return nil, err
+	}
+	allErrs = append(allErrs, hostErrs...)
+	allErrs = append(allErrs, validateStorageSize(old, wp)...)
+	allErrs = append(allErrs, validateImmutableFields(old, wp)...)
+	allErrs = append(allErrs, wp.ValidateDatabaseSettings()...)
+
+	return nil, toInvalidError(wp, allErrs)
+}
+
+// ValidateDelete implements webhook.CustomValidator so a webhook will be registered for the type WordPressSite.
+func (v *WordPressSiteCustomValidator) ValidateDelete(_ context.Context, _ runtime.Object) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateHost rejects a host that is already used by another site
+func (v *WordPressSiteCustomValidator) validateHost(ctx context.Context, wp *crmv1.WordPressSite) (field.ErrorList, error) {
+	if wp.Spec.Ingress == nil || wp.Spec.Ingress.Host == "" {
+		return nil, nil
+	}
+
+	siteList := &crmv1.WordPressSiteList{}
+	if err := v.Client.List(ctx, siteList); err != nil {
+		return nil, fmt.Errorf("failed to list WordPress sites: %w", err)
+	}
+
+	for _, other := range siteList.Items {
+		if other.Namespace == wp.Namespace && other.Name == wp.Name {
+			continue
+		}
+		if other.Spec.Ingress != nil && other.Spec.Ingress.Host == wp.Spec.Ingress.Host {
+			return field.ErrorList{field.Duplicate(field.NewPath("spec", "ingress", "host"),
+				fmt.Sprintf("%s is already used by %s/%s", wp.Spec.Ingress.Host, other.Namespace, other.Name))}, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// validateStorageSize rejects shrinking the storage, PVCs can not be scaled down
+func validateStorageSize(old, wp *crmv1.WordPressSite) field.ErrorList {
+	oldSize, err := resource.ParseQuantity(old.Spec.WordPress.StorageSize)
+	if err != nil {
+		// the old value was never valid, nothing to compare with
+		return nil
+	}
+	newSize, err := resource.ParseQuantity(wp.Spec.WordPress.StorageSize)
+	if err != nil {
+		// reported by ValidateQuantities
+		return nil
+	}
+
+	if newSize.Cmp(oldSize) < 0 {
+		return field.ErrorList{field.Forbidden(field.NewPath("spec", "wordpress", "storageSize"),
+			fmt.Sprintf("storage can not be shrunk from %s to %s", oldSize.String(), newSize.String()))}
+	}
+
+	return nil
+}
+
+// validateImmutableFields rejects changes to fields that only have an effect on creation
+func validateImmutableFields(old, wp *crmv1.WordPressSite) field.ErrorList {
+	var allErrs field.ErrorList
+
+	specPath := field.NewPath("spec")
+
+	if wp.Spec.SiteTitle != old.Spec.SiteTitle {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("siteTitle"), "field is immutable"))
+	}
+
+	if wp.Spec.AdminEmail != old.Spec.AdminEmail {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("adminEmail"), "field is immutable"))
+	}
+
+	if getIngressClassName(wp) != getIngressClassName(old) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("ingress", "ingressClassName"), "field is immutable"))
+	}
+
+	if (wp.Spec.Database.MariaDBRef == nil) != (old.Spec.Database.MariaDBRef == nil) ||
+		(wp.Spec.Database.MariaDBRef != nil && *wp.Spec.Database.MariaDBRef != *old.Spec.Database.MariaDBRef) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("database", "mariaDBRef"), "field is immutable"))
+	}
+
+	if (wp.Spec.CloneFrom == nil) != (old.Spec.CloneFrom == nil) ||
+		(wp.Spec.CloneFrom != nil && *wp.Spec.CloneFrom != *old.Spec.CloneFrom) {
+		allErrs = append(allErrs, field.Forbidden(specPath.Child("cloneFrom"), "field is immutable"))
+	}
+
+	return allErrs
+}
+
+func getIngressClassName(wp *crmv1.WordPressSite) string {
+	if wp.Spec.Ingress == nil {
+		return ""
+	}
+	return wp.Spec.Ingress.IngressClassName
+}
+
+// toInvalidError turns the field errors into an Invalid API error, or nil if there are none
+func toInvalidError(wp *crmv1.WordPressSite, allErrs field.ErrorList) error {
+	if len(allErrs) == 0 {
+		return nil
+	}
+
+	return apierrors.NewInvalid(crmv1.GroupVersion.WithKind("WordPressSite").GroupKind(), wp.Name, allErrs)
+}